@@ -1,8 +1,12 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"strconv"
 
+	"github.com/ophymx/s3d/internal/policy"
 	"github.com/ophymx/s3d/internal/s3"
 )
 
@@ -15,13 +19,61 @@ type config struct {
 	Credentials []s3.Credential
 }
 
+// credentialsFile is a JSON config file of credentials and the identity
+// policies attached to them.
+type credentialsFile struct {
+	Credentials []struct {
+		AccessKeyID string
+		SecretKey   string
+		CanonicalID string
+		DisplayName string
+		Policies    []json.RawMessage
+	}
+}
+
+// loadCredentials adds the credentials of a config file.
+func (c *config) loadCredentials(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file credentialsFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	for _, entry := range file.Credentials {
+		if entry.AccessKeyID == "" || entry.SecretKey == "" {
+			return fmt.Errorf("%s: credentials need an AccessKeyID and SecretKey", path)
+		}
+		cred := s3.Credential{
+			AccessKeyID: entry.AccessKeyID,
+			SecretKey:   entry.SecretKey,
+			Account:     s3.Account{CanonicalID: entry.CanonicalID, DisplayName: entry.DisplayName},
+		}
+		for _, doc := range entry.Policies {
+			p, err := policy.ParseIdentityPolicy(doc)
+			if err != nil {
+				return fmt.Errorf("%s: policy of %s: %s", path, entry.AccessKeyID, err)
+			}
+			cred.Policies = append(cred.Policies, p)
+		}
+		c.Credentials = append(c.Credentials, cred)
+	}
+	return nil
+}
+
 func (c config) listenAddr() string {
 	return ":" + strconv.Itoa(c.Port)
 }
 
+// getCredentialsMap looks up credentials by access key. Credentials without
+// a canonical ID get their own account, identified by their access key.
 func (c config) getCredentialsMap() map[string]s3.Credential {
 	lookup := make(map[string]s3.Credential)
 	for _, cred := range c.Credentials {
+		if cred.CanonicalID == "" {
+			cred.CanonicalID = s3.NewCanonicalID(cred.AccessKeyID)
+		}
 		lookup[cred.AccessKeyID] = cred
 	}
 	return lookup
@@ -18,6 +18,9 @@ const (
 type Authorization interface {
 	GetAccessKeyID() string
 	Verify(secretKey string, req *http.Request) error
+	// CheckDate rejects a request that has expired or whose date is too
+	// far from now.
+	CheckDate(now time.Time) error
 }
 
 type Resource interface {
@@ -2,11 +2,23 @@ package auth
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
 
-const ISO8601 = "20060102T150405Z0700"
+const (
+	ISO8601 = "20060102T150405Z0700"
+	// MaxSkew is how far the date of a signed request may be from the
+	// time it is received.
+	MaxSkew = 15 * time.Minute
+	// MaxExpires is the longest a presigned V4 request may be valid for.
+	MaxExpires   = 7 * 24 * time.Hour
+	serverTime   = "2006-01-02T15:04:05Z"
+	errExpired   = "Request has expired"
+	errNotYet    = "Request is not valid yet"
+	errTooSkewed = "The difference between the request time and the current time is too large."
+)
 
 var (
 	dateHeaders    = []string{strings.ToLower(AmzDate), AmzDate, hdrDate}
@@ -39,3 +51,34 @@ func parseDate(value string) (date time.Time, err error) {
 	}
 	return
 }
+
+// checkSkew rejects a request whose date is too far from now.
+func checkSkew(date, now time.Time) error {
+	if skew := now.Sub(date); skew > MaxSkew || skew < -MaxSkew {
+		return AuthError{
+			Code:    ErrRequestTimeTooSkewed,
+			Message: errTooSkewed,
+			Params: map[string]string{
+				"RequestTime":                date.UTC().Format(ISO8601),
+				"ServerTime":                 now.UTC().Format(serverTime),
+				"MaxAllowedSkewMilliseconds": strconv.FormatInt(int64(MaxSkew/time.Millisecond), 10),
+			},
+		}
+	}
+	return nil
+}
+
+// checkExpires rejects a presigned request that is used after it expires.
+func checkExpires(expires, now time.Time) error {
+	if now.After(expires) {
+		return AuthError{
+			Code:    ErrAccessDenied,
+			Message: errExpired,
+			Params: map[string]string{
+				"Expires":    expires.UTC().Format(serverTime),
+				"ServerTime": now.UTC().Format(serverTime),
+			},
+		}
+	}
+	return nil
+}
@@ -13,6 +13,10 @@ const (
 	ErrAccessDenied                              = iota
 	ErrInvalidAccessKeyID                        = iota
 	ErrSignatureDoesNotMatch                     = iota
+	ErrIncompleteBody                            = iota
+	ErrMissingContentLength                      = iota
+	ErrRequestTimeTooSkewed                      = iota
+	ErrMaxMessageLengthExceeded                  = iota
 )
 
 const (
@@ -65,6 +69,27 @@ func AccessDenied(msg string) AuthError {
 	}
 }
 
+func IncompleteBody(msg string) AuthError {
+	return AuthError{
+		Code:    ErrIncompleteBody,
+		Message: msg,
+	}
+}
+
+func MissingContentLength(msg string) AuthError {
+	return AuthError{
+		Code:    ErrMissingContentLength,
+		Message: msg,
+	}
+}
+
+func MaxMessageLengthExceeded(msg string) AuthError {
+	return AuthError{
+		Code:    ErrMaxMessageLengthExceeded,
+		Message: msg,
+	}
+}
+
 func AuthorizationQueryParametersError(msg string) AuthError {
 	return AuthError{
 		Code:    ErrAuthorizationQueryParametersError,
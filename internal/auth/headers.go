@@ -1,16 +1,18 @@
 package auth
 
 const (
-	AmzAlgorithm     = "X-Amz-Algorithm"
-	AmzContentSHA256 = "X-Amz-Content-Sha256"
-	AmzCredential    = "X-Amz-Credential"
-	AmzDate          = "X-Amz-Date"
-	AmzExpires       = "X-Amz-Expires"
-	AmzSignedHeaders = "X-Amz-SignedHeaders"
-	AmzSignature     = "X-Amz-Signature"
-	hdrDate          = "Date"
-	hdrHost          = "Host"
-	hdrAuthorization = "Authorization"
-	hdrContentMD5    = "Content-MD5"
-	hdrContentType   = "ContentType"
+	AmzAlgorithm            = "X-Amz-Algorithm"
+	AmzContentSHA256        = "X-Amz-Content-Sha256"
+	AmzCredential           = "X-Amz-Credential"
+	AmzDate                 = "X-Amz-Date"
+	AmzDecodedContentLength = "X-Amz-Decoded-Content-Length"
+	AmzExpires              = "X-Amz-Expires"
+	AmzSecurityToken        = "X-Amz-Security-Token"
+	AmzSignedHeaders        = "X-Amz-SignedHeaders"
+	AmzSignature            = "X-Amz-Signature"
+	hdrDate                 = "Date"
+	hdrHost                 = "Host"
+	hdrAuthorization        = "Authorization"
+	hdrContentMD5           = "Content-MD5"
+	hdrContentType          = "ContentType"
 )
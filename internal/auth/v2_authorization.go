@@ -67,6 +67,13 @@ func (auth AuthorizationV2) GetAccessKeyID() string {
 	return auth.AccessKeyID
 }
 
+func (auth AuthorizationV2) CheckDate(now time.Time) error {
+	if auth.Expires != 0 {
+		return checkExpires(time.Unix(auth.Expires, 0), now)
+	}
+	return checkSkew(auth.Date, now)
+}
+
 func (auth AuthorizationV2) Verify(secretKey string, req *http.Request) error {
 	canonicalReq := CanonicalRequestV2{
 		Method:      req.Method,
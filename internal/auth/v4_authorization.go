@@ -1,8 +1,11 @@
 package auth
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"strconv"
@@ -14,20 +17,39 @@ var (
 	errQueryV4Missing     = AuthorizationQueryParametersError("Query-string authentication version 4 requires the X-Amz-Algorithm, X-Amz-Credential, X-Amz-Signature, X-Amz-Date, X-Amz-SignedHeaders, and X-Amz-Expires parameters.")
 	errQueryV4Unsupported = AuthorizationQueryParametersError(`X-Amz-Algorithm only supports "AWS4-HMAC-SHA256"`)
 	errExpiresFormat      = AuthorizationQueryParametersError("X-Amz-Expires should be a number")
+	errExpiresNegative    = AuthorizationQueryParametersError("X-Amz-Expires must be non-negative")
+	errExpiresTooLong     = AuthorizationQueryParametersError("X-Amz-Expires must be less than a week (in seconds) that is; 604800")
+	errBodyTooLong        = MaxMessageLengthExceeded("Your request was too big.")
 )
 
+// maxHashedBodySize limits the bodies hashed to verify a signature, which
+// are small forms such as STS requests.
+const maxHashedBodySize = 1 << 20
+
 type AuthorizationV4 struct {
 	Credential    Credential
 	Date          time.Time
 	Expires       int
 	SignedHeaders []string
 	Signature     string
+	// Presigned is set when the authorization is given in the query.
+	Presigned bool
 }
 
 func (auth AuthorizationV4) GetAccessKeyID() string {
 	return auth.Credential.AccessKeyID
 }
 
+func (auth AuthorizationV4) CheckDate(now time.Time) error {
+	if !auth.Presigned {
+		return checkSkew(auth.Date, now)
+	}
+	if auth.Date.Sub(now) > MaxSkew {
+		return AccessDenied(errNotYet)
+	}
+	return checkExpires(auth.Date.Add(time.Duration(auth.Expires)*time.Second), now)
+}
+
 func (auth AuthorizationV4) Verify(secretKey string, req *http.Request) error {
 	canonicalReq := CanonicalRequest{
 		Method:        req.Method,
@@ -38,6 +60,13 @@ func (auth AuthorizationV4) Verify(secretKey string, req *http.Request) error {
 		Date:          auth.Date.Format(ISO8601),
 		PayloadHash:   req.Header.Get(AmzContentSHA256),
 	}
+	if canonicalReq.PayloadHash == "" && auth.Credential.Service != "s3" && !auth.Presigned {
+		hash, err := payloadHash(req)
+		if err != nil {
+			return err
+		}
+		canonicalReq.PayloadHash = hash
+	}
 	canonicalReq.Headers[hdrHost] = req.Host
 	for _, header := range auth.SignedHeaders {
 		if header != "host" {
@@ -62,6 +91,26 @@ func (auth AuthorizationV4) Verify(secretKey string, req *http.Request) error {
 	return SignatureDoesNotMatch(auth.GetAccessKeyID(), sts, auth.Signature)
 }
 
+// payloadHash hashes the body of req, which services other than S3 always
+// sign, and puts it back to be read again. Bodies over maxHashedBodySize
+// are rejected.
+func payloadHash(req *http.Request) (string, error) {
+	if req.Body == nil {
+		return emptySHA256, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, maxHashedBodySize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(body) > maxHashedBodySize {
+		return "", errBodyTooLong
+	}
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	digest := sha256.Sum256(body)
+	return string(hexEncode(digest[:])), nil
+}
+
 func ParseAuthorizationV4(param string, date time.Time, values Values) (auth AuthorizationV4, err error) {
 	auth.Date = date
 	for _, component := range strings.Split(param, ",") {
@@ -105,6 +154,7 @@ func ParseAuthorizationQueryV4(values Values) (auth AuthorizationV4, err error)
 	if algorithm != Aws4HmacSha256 {
 		return AuthorizationV4{}, errQueryV4Unsupported
 	}
+	auth.Presigned = true
 
 	if cred := values.Get(AmzCredential); cred == "" {
 		return AuthorizationV4{}, errQueryV4Missing
@@ -137,6 +187,10 @@ func ParseAuthorizationQueryV4(values Values) (auth AuthorizationV4, err error)
 func parseExpires(value string) (expires int, err error) {
 	if expires, err = strconv.Atoi(value); err != nil {
 		err = errExpiresFormat
+	} else if expires < 0 {
+		err = errExpiresNegative
+	} else if time.Duration(expires)*time.Second > MaxExpires {
+		err = errExpiresTooLong
 	}
 	return
 }
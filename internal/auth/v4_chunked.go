@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	V4PayloadStreamingHmacSha256Trailer = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD-TRAILER"
+	V4PayloadStreamingUnsignedTrailer   = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	v4PayloadStreamingPrefix            = "STREAMING-"
+	v4ChunkAlgorithm                    = "AWS4-HMAC-SHA256-PAYLOAD"
+	v4TrailerAlgorithm                  = "AWS4-HMAC-SHA256-TRAILER"
+	chunkSignature                      = "chunk-signature"
+	trailerSignature                    = "x-amz-trailer-signature"
+	emptySHA256                         = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// maxChunkSize limits the size of a chunk, which is held in memory until
+// its signature is verified. SDKs send chunks of 8 MiB at most.
+const maxChunkSize = 16 << 20
+
+var (
+	errDecodedLength   = MissingContentLength("You must provide the Content-Length HTTP header.")
+	errIncompleteBody  = IncompleteBody("You did not provide the number of bytes specified by the Content-Length HTTP header.")
+	errChunkFormat     = IncompleteBody("The request body is not a valid aws-chunked body.")
+	errStreamingScheme = "x-amz-content-sha256 must be UNSIGNED-PAYLOAD, STREAMING-AWS4-HMAC-SHA256-PAYLOAD, or a valid sha256 value."
+)
+
+// DecodeBody returns the payload of req. An aws-chunked body, named by a
+// STREAMING- x-amz-content-sha256, is decoded as it is read, and its chunk
+// signatures are verified against the seed signature of authorization.
+// Trailing headers are added to req.Trailer once the body has been read.
+func DecodeBody(authorization Authorization, secretKey string, req *http.Request) (io.ReadCloser, error) {
+	payload := req.Header.Get(AmzContentSHA256)
+	if !strings.HasPrefix(payload, v4PayloadStreamingPrefix) {
+		return req.Body, nil
+	}
+
+	decodedLength, err := strconv.ParseInt(req.Header.Get(AmzDecodedContentLength), 10, 64)
+	if err != nil || decodedLength < 0 {
+		return nil, errDecodedLength
+	}
+	if req.Trailer == nil {
+		req.Trailer = http.Header{}
+	}
+	reader := &ChunkedReader{
+		reader:        bufio.NewReader(req.Body),
+		closer:        req.Body,
+		trailer:       req.Trailer,
+		decodedLength: decodedLength,
+	}
+
+	switch payload {
+	case V4PayloadStreamingUnsignedTrailer:
+		return reader, nil
+	case V4PayloadStreamingHmacSha256, V4PayloadStreamingHmacSha256Trailer:
+		v4, ok := authorization.(AuthorizationV4)
+		if !ok || v4.Presigned {
+			return nil, InvalidArgument(errStreamingScheme, AmzContentSHA256, payload)
+		}
+		reader.signer = &chunkSigner{
+			key:       v4.Credential.SigningKey(secretKey),
+			accessKey: v4.GetAccessKeyID(),
+			prefix:    strings.Join([]string{v4.Date.Format(ISO8601), v4.Credential.Scope()}, "\n"),
+			previous:  v4.Signature,
+		}
+		reader.signedTrailer = payload == V4PayloadStreamingHmacSha256Trailer
+		return reader, nil
+	default:
+		return nil, InvalidArgument(errStreamingScheme, AmzContentSHA256, payload)
+	}
+}
+
+// ChunkedReader decodes an aws-chunked body. Each chunk is framed as
+// hex-size[;chunk-signature=signature]\r\ndata\r\n and the body ends with
+// a zero sized chunk followed by any trailing headers and an empty line.
+type ChunkedReader struct {
+	reader        *bufio.Reader
+	closer        io.Closer
+	trailer       http.Header
+	signer        *chunkSigner
+	signedTrailer bool
+	chunk         []byte
+	decoded       int64
+	decodedLength int64
+	err           error
+}
+
+func (r *ChunkedReader) Read(p []byte) (n int, err error) {
+	for len(r.chunk) == 0 && r.err == nil {
+		r.err = r.next()
+	}
+	if len(r.chunk) == 0 {
+		return 0, r.err
+	}
+	n = copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+func (r *ChunkedReader) Close() error {
+	return r.closer.Close()
+}
+
+// next reads the next chunk, verifying its signature before any of its
+// data is returned.
+func (r *ChunkedReader) next() error {
+	line, err := r.readLine()
+	if err != nil {
+		return err
+	}
+
+	var signature string
+	if i := strings.IndexByte(line, ';'); i >= 0 {
+		extension := strings.SplitN(line[i+1:], "=", 2)
+		if len(extension) != 2 || extension[0] != chunkSignature {
+			return errChunkFormat
+		}
+		line, signature = line[:i], extension[1]
+	}
+	size, err := strconv.ParseInt(line, 16, 64)
+	if err != nil || size < 0 {
+		return errChunkFormat
+	}
+	if r.decoded+size > r.decodedLength {
+		return errIncompleteBody
+	}
+	if size > maxChunkSize {
+		return errChunkFormat
+	}
+
+	chunk := make([]byte, size)
+	if _, err = io.ReadFull(r.reader, chunk); err != nil {
+		return errIncompleteBody
+	}
+	if size > 0 {
+		if line, err = r.readLine(); err != nil || line != "" {
+			return errChunkFormat
+		}
+	}
+	if r.signer != nil {
+		if err = r.signer.verifyChunk(chunk, signature); err != nil {
+			return err
+		}
+	}
+	r.decoded += size
+	r.chunk = chunk
+
+	if size == 0 {
+		return r.readTrailer()
+	}
+	return nil
+}
+
+// readTrailer reads the trailing headers after the last chunk.
+func (r *ChunkedReader) readTrailer() error {
+	var trailer bytes.Buffer
+	var signature string
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			break
+		}
+		header := strings.SplitN(line, ":", 2)
+		if len(header) != 2 {
+			return errChunkFormat
+		}
+		name, value := strings.ToLower(strings.TrimSpace(header[0])), strings.TrimSpace(header[1])
+		if name == trailerSignature {
+			signature = value
+			continue
+		}
+		r.trailer.Set(name, value)
+		trailer.WriteString(name + ":" + value + "\n")
+	}
+
+	if r.signedTrailer {
+		if err := r.signer.verifyTrailer(trailer.Bytes(), signature); err != nil {
+			return err
+		}
+	}
+	if r.decoded != r.decodedLength {
+		return errIncompleteBody
+	}
+	return io.EOF
+}
+
+// readLine reads a CRLF terminated line of the framing.
+func (r *ChunkedReader) readLine() (string, error) {
+	line, err := r.reader.ReadSlice('\n')
+	if err == io.EOF {
+		return "", errIncompleteBody
+	} else if err != nil {
+		return "", errChunkFormat
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return "", errChunkFormat
+	}
+	return string(line[:len(line)-2]), nil
+}
+
+// chunkSigner verifies the chain of chunk signatures, each of which signs
+// the chunk along with the signature before it, starting from the seed
+// signature of the request.
+type chunkSigner struct {
+	key       SigningKey
+	accessKey string
+	prefix    string
+	previous  string
+}
+
+func (s *chunkSigner) verifyChunk(chunk []byte, signature string) error {
+	digest := sha256.Sum256(chunk)
+	sts := strings.Join([]string{v4ChunkAlgorithm, s.prefix, s.previous, emptySHA256, string(hexEncode(digest[:]))}, "\n")
+	return s.verify(sts, signature)
+}
+
+func (s *chunkSigner) verifyTrailer(trailer []byte, signature string) error {
+	digest := sha256.Sum256(trailer)
+	sts := strings.Join([]string{v4TrailerAlgorithm, s.prefix, s.previous, string(hexEncode(digest[:]))}, "\n")
+	return s.verify(sts, signature)
+}
+
+func (s *chunkSigner) verify(sts, signature string) error {
+	if !s.key.Verify(sts, signature) {
+		return SignatureDoesNotMatch(s.accessKey, sts, signature)
+	}
+	s.previous = signature
+	return nil
+}
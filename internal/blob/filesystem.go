@@ -26,6 +26,23 @@ func (fs fsStore) Get(resource Resource) (object io.ReadCloser, err error) {
 	return os.Open(fs.path(resource))
 }
 
+func (fs fsStore) GetRange(resource Resource, offset, length int64) (object io.ReadCloser, err error) {
+	file, err := os.Open(fs.path(resource))
+	if err != nil {
+		return
+	}
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return
+	}
+	return limitedFile{Reader: io.LimitReader(file, length), Closer: file}, nil
+}
+
+type limitedFile struct {
+	io.Reader
+	io.Closer
+}
+
 func (fs fsStore) Copy(src, dst Resource) (err error) {
 	if src.Bucket() == dst.Bucket() && src.Key() == dst.Key() {
 		return
@@ -43,6 +60,29 @@ func (fs fsStore) Copy(src, dst Resource) (err error) {
 	return os.Link(fs.path(src), fs.path(dst))
 }
 
+func (fs fsStore) CopyRange(src, dst Resource, offset, length int64) (err error) {
+	file, err := os.Open(fs.path(src))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		return
+	}
+
+	writer, err := fs.Create(dst)
+	if err != nil {
+		return
+	}
+	defer writer.Close()
+
+	if _, err = io.CopyN(writer, file, length); err != nil {
+		return
+	}
+	return writer.Close()
+}
+
 func (fs fsStore) Create(resource Resource) (writer io.WriteCloser, err error) {
 	if err = fs.mkParent(resource); err != nil {
 		return
@@ -65,6 +105,11 @@ func (fs fsStore) CreateBucket(bucket string) (err error) {
 }
 
 func (fs fsStore) DeleteBucket(bucket string) (err error) {
+	for _, dir := range []string{uploadsBucket, stagingBucket, versionsBucket} {
+		if err = os.RemoveAll(filepath.Join(fs.root, dir, bucket)); err != nil {
+			return
+		}
+	}
 	return os.RemoveAll(filepath.Join(fs.root, bucket))
 }
 
@@ -92,6 +137,39 @@ func (fs fsStore) MD5(resource Resource) (result string, err error) {
 	return hex.EncodeToString(digest.Sum(nil)), nil
 }
 
+func (fs fsStore) Concat(dst Resource, srcs []Resource) (err error) {
+	writer, err := fs.Create(dst)
+	if err != nil {
+		return
+	}
+	defer writer.Close()
+
+	for _, src := range srcs {
+		if err = fs.appendTo(writer, src); err != nil {
+			return
+		}
+	}
+	return writer.Close()
+}
+
+func (fs fsStore) Rename(src, dst Resource) (err error) {
+	if err = fs.mkParent(dst); err != nil {
+		return
+	}
+	return os.Rename(fs.path(src), fs.path(dst))
+}
+
+func (fs fsStore) appendTo(writer io.Writer, src Resource) (err error) {
+	file, err := os.Open(fs.path(src))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	_, err = io.Copy(writer, file)
+	return
+}
+
 func (fs fsStore) mkParent(resource Resource) (err error) {
 	return os.MkdirAll(filepath.Dir(fs.path(resource)), dirMode)
 }
@@ -1,6 +1,7 @@
 package blob
 
 import (
+	"fmt"
 	"io"
 )
 
@@ -12,6 +13,9 @@ type Store interface {
 	// Get fetches object from store.
 	Get(resource Resource) (object io.ReadCloser, err error)
 
+	// GetRange fetches length bytes of object starting at offset from store.
+	GetRange(resource Resource, offset, length int64) (object io.ReadCloser, err error)
+
 	// Copy copies object in store.
 	Copy(src, dst Resource) (err error)
 
@@ -35,6 +39,15 @@ type Store interface {
 
 	// Compute MD5 of object in store.
 	MD5(resource Resource) (md5 string, err error)
+
+	// Concat concatenates srcs, in order, into dst.
+	Concat(dst Resource, srcs []Resource) (err error)
+
+	// CopyRange copies length bytes of src starting at offset into dst.
+	CopyRange(src, dst Resource, offset, length int64) (err error)
+
+	// Rename atomically replaces dst with src.
+	Rename(src, dst Resource) (err error)
 }
 
 // Info interface to read metadata of an object in store.
@@ -46,3 +59,65 @@ type Resource interface {
 	Bucket() string
 	Key() string
 }
+
+// uploadsBucket holds parts of multipart uploads.
+// Bucket names must start with a letter or number so it can't collide.
+const uploadsBucket = ".uploads"
+
+// stagingBucket holds objects being written until they are renamed into place.
+const stagingBucket = ".staging"
+
+// versionsBucket holds the versions of objects in versioned buckets.
+const versionsBucket = ".versions"
+
+type part struct {
+	key string
+}
+
+// Part is the Resource in store for a part of multipart upload uploadID in bucket.
+func Part(bucket, uploadID string, partNumber int) Resource {
+	return part{key: fmt.Sprintf("%s/%s/%05d", bucket, uploadID, partNumber)}
+}
+
+func (p part) Bucket() string {
+	return uploadsBucket
+}
+
+func (p part) Key() string {
+	return p.key
+}
+
+type version struct {
+	key string
+}
+
+// Version is the Resource in store for version versionID of key in bucket.
+// The null version is stored as the object itself.
+func Version(bucket, key, versionID string) Resource {
+	return version{key: fmt.Sprintf("%s/%s/%s", bucket, versionID, key)}
+}
+
+func (v version) Bucket() string {
+	return versionsBucket
+}
+
+func (v version) Key() string {
+	return v.key
+}
+
+type staging struct {
+	key string
+}
+
+// Staging is the Resource in store for an object being written to bucket.
+func Staging(bucket, id string) Resource {
+	return staging{key: fmt.Sprintf("%s/%s", bucket, id)}
+}
+
+func (s staging) Bucket() string {
+	return stagingBucket
+}
+
+func (s staging) Key() string {
+	return s.key
+}
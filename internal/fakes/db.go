@@ -9,12 +9,17 @@ import (
 type Bucket struct {
 	Meta    meta.BucketData
 	Objects map[string]meta.ObjectData
+	// Versions holds the noncurrent versions of each key, newest first.
+	Versions map[string][]meta.ObjectData
+	Uploads  map[string]map[string]meta.UploadData
 }
 
 func NewBucket(data meta.BucketData) *Bucket {
 	return &Bucket{
-		Meta:    data,
-		Objects: make(map[string]meta.ObjectData),
+		Meta:     data,
+		Objects:  make(map[string]meta.ObjectData),
+		Versions: make(map[string][]meta.ObjectData),
+		Uploads:  make(map[string]map[string]meta.UploadData),
 	}
 }
 
@@ -28,6 +33,9 @@ func (l lazy) Get() (meta.ObjectData, error) {
 
 type DB struct {
 	Buckets map[string]*Bucket
+	// CommitErr, when set, fails PutIf and PutVersion after their
+	// precondition passes, as a failed transaction would.
+	CommitErr error
 }
 
 func NewDB() *DB {
@@ -55,6 +63,22 @@ func (db *DB) Put(target meta.Target, data meta.ObjectData) (err error) {
 	return
 }
 
+func (db *DB) PutIf(target meta.Target, data meta.ObjectData, precondition meta.Precondition) (err error) {
+	bucket, found := db.Buckets[target.Bucket()]
+	if !found {
+		return meta.ErrBucketNotFound
+	}
+	current, found := bucket.Objects[target.Key()]
+	if err = precondition(current, found); err != nil {
+		return
+	}
+	if db.CommitErr != nil {
+		return db.CommitErr
+	}
+	bucket.Objects[target.Key()] = data
+	return
+}
+
 func (db *DB) Delete(target meta.Target) (err error) {
 	if bucket, found := db.Buckets[target.Bucket()]; found {
 		if _, found := bucket.Objects[target.Key()]; found {
@@ -66,15 +90,177 @@ func (db *DB) Delete(target meta.Target) (err error) {
 	return meta.ErrBucketNotFound
 }
 
+func (db *DB) GetVersion(target meta.Target, versionID string) (data meta.ObjectData, err error) {
+	bucket, found := db.Buckets[target.Bucket()]
+	if !found {
+		err = meta.ErrBucketNotFound
+		return
+	}
+	if obj, found := bucket.Objects[target.Key()]; found && obj.VersionID == versionID {
+		return obj, nil
+	}
+	if i := bucket.findVersion(target.Key(), versionID); i >= 0 {
+		return bucket.Versions[target.Key()][i], nil
+	}
+	err = meta.ErrVersionNotFound
+	return
+}
+
+func (db *DB) PutVersion(target meta.Target, data meta.ObjectData, precondition meta.Precondition) (err error) {
+	bucket, found := db.Buckets[target.Bucket()]
+	if !found {
+		return meta.ErrBucketNotFound
+	}
+	key := target.Key()
+	current, found := bucket.Objects[key]
+	if err = precondition(current, found); err != nil {
+		return
+	}
+	if db.CommitErr != nil {
+		return db.CommitErr
+	}
+
+	if i := bucket.findVersion(key, data.VersionID); i >= 0 {
+		bucket.removeVersion(key, i)
+	}
+	if found && current.VersionID != data.VersionID {
+		bucket.archive(key, current)
+	}
+	if data.DeleteMarker {
+		delete(bucket.Objects, key)
+		bucket.archive(key, data)
+		return
+	}
+	bucket.Objects[key] = data
+	return
+}
+
+func (db *DB) ReplaceVersion(target meta.Target, data meta.ObjectData, precondition meta.Precondition) (err error) {
+	bucket, found := db.Buckets[target.Bucket()]
+	if !found {
+		return meta.ErrBucketNotFound
+	}
+	key := target.Key()
+	if current, found := bucket.Objects[key]; found && current.VersionID == data.VersionID {
+		if err = precondition(current, true); err != nil {
+			return
+		}
+		bucket.Objects[key] = data
+		return
+	}
+	i := bucket.findVersion(key, data.VersionID)
+	if i < 0 {
+		return meta.ErrVersionNotFound
+	}
+	if err = precondition(bucket.Versions[key][i], true); err != nil {
+		return
+	}
+	bucket.Versions[key][i] = data
+	return
+}
+
+func (db *DB) DeleteVersion(target meta.Target, versionID string) (data meta.ObjectData, err error) {
+	bucket, found := db.Buckets[target.Bucket()]
+	if !found {
+		err = meta.ErrBucketNotFound
+		return
+	}
+	key := target.Key()
+	if obj, found := bucket.Objects[key]; found && obj.VersionID == versionID {
+		delete(bucket.Objects, key)
+		bucket.promote(key)
+		return obj, nil
+	}
+	i := bucket.findVersion(key, versionID)
+	if i < 0 {
+		err = meta.ErrVersionNotFound
+		return
+	}
+	data = bucket.removeVersion(key, i)
+	if _, found := bucket.Objects[key]; !found {
+		bucket.promote(key)
+	}
+	return
+}
+
+func (b *Bucket) findVersion(key, versionID string) int {
+	for i, version := range b.Versions[key] {
+		if version.VersionID == versionID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *Bucket) archive(key string, data meta.ObjectData) {
+	b.Versions[key] = append([]meta.ObjectData{data}, b.Versions[key]...)
+}
+
+func (b *Bucket) removeVersion(key string, i int) meta.ObjectData {
+	versions := b.Versions[key]
+	removed := versions[i]
+	versions = append(versions[:i:i], versions[i+1:]...)
+	if len(versions) == 0 {
+		delete(b.Versions, key)
+	} else {
+		b.Versions[key] = versions
+	}
+	return removed
+}
+
+func (b *Bucket) promote(key string) {
+	versions := b.Versions[key]
+	if len(versions) == 0 || versions[0].DeleteMarker {
+		return
+	}
+	b.Objects[key] = b.removeVersion(key, 0)
+}
+
 func (db *DB) CreateBucket(bucket string, data meta.BucketData) (err error) {
 	if _, found := db.Buckets[bucket]; found {
-		return
+		return meta.ErrBucketExists
 	}
 	db.Buckets[bucket] = NewBucket(data)
 	return
 }
 
+func (db *DB) GetBucket(bucket string) (data meta.BucketData, err error) {
+	if b, found := db.Buckets[bucket]; found {
+		return b.Meta, nil
+	}
+	err = meta.ErrBucketNotFound
+	return
+}
+
+func (db *DB) PutBucket(bucket string, data meta.BucketData) error {
+	b, found := db.Buckets[bucket]
+	if !found {
+		return meta.ErrBucketNotFound
+	}
+	b.Meta = data
+	return nil
+}
+
 func (db *DB) DeleteBucket(bucket string) (err error) {
+	if b, found := db.Buckets[bucket]; found {
+		if len(b.Objects) > 0 {
+			return meta.ErrBucketNotEmpty
+		}
+		for _, versions := range b.Versions {
+			if len(versions) > 0 {
+				return meta.ErrBucketNotEmpty
+			}
+		}
+		for _, uploads := range b.Uploads {
+			if len(uploads) > 0 {
+				return meta.ErrBucketNotEmpty
+			}
+		}
+	}
+	return db.ForceDeleteBucket(bucket)
+}
+
+func (db *DB) ForceDeleteBucket(bucket string) (err error) {
 	if _, found := db.Buckets[bucket]; found {
 		delete(db.Buckets, bucket)
 		return
@@ -99,6 +285,13 @@ func (db *DB) ListBuckets() (buckets []meta.Bucket, err error) {
 }
 
 func (db *DB) ForEachInBucket(name, seek string, forEach meta.ForEachFunc) (err error) {
+	return db.ScanBucket(name, seek, func(key string, obj meta.LazyObject) (string, bool, error) {
+		next, err := forEach(key, obj)
+		return "", next, err
+	})
+}
+
+func (db *DB) ScanBucket(name, seek string, scan meta.ScanFunc) (err error) {
 	bucket, found := db.Buckets[name]
 	if !found {
 		return meta.ErrBucketNotFound
@@ -114,7 +307,7 @@ func (db *DB) ForEachInBucket(name, seek string, forEach meta.ForEachFunc) (err
 		if key < seek {
 			continue
 		}
-		next, err = forEach(key, lazy{bucket.Objects[key]})
+		seek, next, err = scan(key, lazy{bucket.Objects[key]})
 		if err != nil {
 			return
 		}
@@ -125,6 +318,124 @@ func (db *DB) ForEachInBucket(name, seek string, forEach meta.ForEachFunc) (err
 	return
 }
 
+func (db *DB) ForEachVersion(name, seek string, forEach meta.ForEachVersionFunc) (err error) {
+	bucket, found := db.Buckets[name]
+	if !found {
+		return meta.ErrBucketNotFound
+	}
+	keys := make([]string, 0, len(bucket.Objects)+len(bucket.Versions))
+	for key := range bucket.Objects {
+		keys = append(keys, key)
+	}
+	for key := range bucket.Versions {
+		if _, found := bucket.Objects[key]; !found {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key < seek {
+			continue
+		}
+		versions := bucket.Versions[key]
+		if current, found := bucket.Objects[key]; found {
+			versions = append([]meta.ObjectData{current}, versions...)
+		}
+		for i, version := range versions {
+			ahead, next, err := forEach(key, version, i == 0)
+			if err != nil || !next {
+				return err
+			}
+			if ahead > key {
+				seek = ahead
+				break
+			}
+		}
+	}
+	return
+}
+
+func (db *DB) CreateUpload(target meta.Target, uploadID string, data meta.UploadData) (err error) {
+	bucket, found := db.Buckets[target.Bucket()]
+	if !found {
+		return meta.ErrBucketNotFound
+	}
+	if _, found := bucket.Uploads[target.Key()]; !found {
+		bucket.Uploads[target.Key()] = make(map[string]meta.UploadData)
+	}
+	bucket.Uploads[target.Key()][uploadID] = data
+	return
+}
+
+func (db *DB) GetUpload(target meta.Target, uploadID string) (data meta.UploadData, err error) {
+	bucket, found := db.Buckets[target.Bucket()]
+	if !found {
+		err = meta.ErrBucketNotFound
+		return
+	}
+	if data, found = bucket.Uploads[target.Key()][uploadID]; !found {
+		err = meta.ErrUploadNotFound
+	}
+	return
+}
+
+func (db *DB) PutPart(target meta.Target, uploadID string, partNumber int, part meta.PartData) (err error) {
+	data, err := db.GetUpload(target, uploadID)
+	if err != nil {
+		return
+	}
+	if data.Parts == nil {
+		data.Parts = make(map[int]meta.PartData)
+	}
+	data.Parts[partNumber] = part
+	db.Buckets[target.Bucket()].Uploads[target.Key()][uploadID] = data
+	return
+}
+
+func (db *DB) DeleteUpload(target meta.Target, uploadID string) (err error) {
+	if _, err = db.GetUpload(target, uploadID); err != nil {
+		return
+	}
+	uploads := db.Buckets[target.Bucket()].Uploads
+	delete(uploads[target.Key()], uploadID)
+	if len(uploads[target.Key()]) == 0 {
+		delete(uploads, target.Key())
+	}
+	return
+}
+
+func (db *DB) ForEachUpload(name, seek string, forEach meta.ForEachUploadFunc) (err error) {
+	bucket, found := db.Buckets[name]
+	if !found {
+		return meta.ErrBucketNotFound
+	}
+	keys := make([]string, 0, len(bucket.Uploads))
+	for key := range bucket.Uploads {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key < seek {
+			continue
+		}
+		uploadIDs := make([]string, 0, len(bucket.Uploads[key]))
+		for uploadID := range bucket.Uploads[key] {
+			uploadIDs = append(uploadIDs, uploadID)
+		}
+		sort.Strings(uploadIDs)
+
+		for _, uploadID := range uploadIDs {
+			next, err := forEach(key, uploadID, bucket.Uploads[key][uploadID])
+			if err != nil || !next {
+				return err
+			}
+		}
+	}
+	return
+}
+
 func (db *DB) Close() (err error) {
 	return
 }
@@ -50,6 +50,52 @@ func (s *Store) Copy(src, dst blob.Resource) (err error) {
 	return ErrNoSuchBucket
 }
 
+func (s *Store) Concat(dst blob.Resource, srcs []blob.Resource) (err error) {
+	buffer := new(bytes.Buffer)
+	for _, src := range srcs {
+		bucket, found := s.Buckets[src.Bucket()]
+		if !found {
+			return ErrNoSuchBucket
+		}
+		b, found := bucket[src.Key()]
+		if !found {
+			return ErrNoSuchKey
+		}
+		buffer.Write(b.Bytes())
+	}
+	s.CreateBucket(dst.Bucket())
+	s.Buckets[dst.Bucket()][dst.Key()] = buffer
+	return
+}
+
+func (s *Store) CopyRange(src, dst blob.Resource, offset, length int64) (err error) {
+	if bucket, found := s.Buckets[src.Bucket()]; found {
+		if b, found := bucket[src.Key()]; found {
+			if offset+length > int64(b.Len()) {
+				return io.ErrUnexpectedEOF
+			}
+			s.CreateBucket(dst.Bucket())
+			s.Buckets[dst.Bucket()][dst.Key()] = bytes.NewBuffer(append([]byte{}, b.Bytes()[offset:offset+length]...))
+			return nil
+		}
+		return ErrNoSuchKey
+	}
+	return ErrNoSuchBucket
+}
+
+func (s *Store) Rename(src, dst blob.Resource) (err error) {
+	if bucket, found := s.Buckets[src.Bucket()]; found {
+		if b, found := bucket[src.Key()]; found {
+			delete(bucket, src.Key())
+			s.CreateBucket(dst.Bucket())
+			s.Buckets[dst.Bucket()][dst.Key()] = b
+			return nil
+		}
+		return ErrNoSuchKey
+	}
+	return ErrNoSuchBucket
+}
+
 func (s *Store) Create(resource blob.Resource) (writer io.WriteCloser, err error) {
 	s.CreateBucket(resource.Bucket())
 	bucket := s.Buckets[resource.Bucket()]
@@ -84,7 +130,17 @@ func (s *Store) DeleteBucket(bucket string) (err error) {
 func (s *Store) Get(resource blob.Resource) (reader io.ReadCloser, err error) {
 	if bucket, found := s.Buckets[resource.Bucket()]; found {
 		if b, found := bucket[resource.Key()]; found {
-			return ioutil.NopCloser(b), nil
+			return ioutil.NopCloser(bytes.NewBuffer(b.Bytes())), nil
+		}
+		return nil, ErrNoSuchKey
+	}
+	return nil, ErrNoSuchBucket
+}
+
+func (s *Store) GetRange(resource blob.Resource, offset, length int64) (reader io.ReadCloser, err error) {
+	if bucket, found := s.Buckets[resource.Bucket()]; found {
+		if b, found := bucket[resource.Key()]; found {
+			return ioutil.NopCloser(bytes.NewBuffer(b.Bytes()[offset : offset+length])), nil
 		}
 		return nil, ErrNoSuchKey
 	}
@@ -11,18 +11,49 @@ var (
 	BucketCreationData = time.Date(2017, 8, 1, 2, 9, 8, 0, time.UTC)
 )
 
+const (
+	OwnerID          = "75aa57f09aa0c8caeab4f8c24e99d10f8e7faeebf76c078efc7c6caea54ba06a"
+	OwnerDisplayName = "CustomersName@amazon.com"
+)
+
+func Owner() meta.Owner {
+	return meta.Owner{ID: OwnerID, DisplayName: OwnerDisplayName}
+}
+
+func OwnerGrant() meta.Grant {
+	return meta.Grant{
+		Type:        "CanonicalUser",
+		Grantee:     OwnerID,
+		DisplayName: OwnerDisplayName,
+		Permission:  "FULL_CONTROL",
+	}
+}
+
+const BucketPolicy = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":"s3:GetObject","Resource":"arn:aws:s3:::foo/*"}]}`
+
 func BucketMetadata() meta.BucketData {
 	return meta.BucketData{
 		CreationDate: BucketCreationData,
+		Policy:       BucketPolicy,
+		Owner:        Owner(),
+		ACL:          []meta.Grant{OwnerGrant()},
+		Versioning:   meta.VersioningEnabled,
+		Location:     "EU",
 	}
 }
 
 const (
-	ObjectContentMD5         = "4672ce371fb3c1170a9e71bc4b2810b9"
-	ObjectCacheControl       = "max-age=31536000"
-	ObjectContentType        = "application/x-iso9660-image"
-	ObjectVersionID          = "222222"
-	ObjectSize         int64 = 718274560
+	ObjectContentMD5               = "4672ce371fb3c1170a9e71bc4b2810b9"
+	ObjectCacheControl             = "max-age=31536000"
+	ObjectContentType              = "application/x-iso9660-image"
+	ObjectVersionID                = "222222"
+	ObjectSize               int64 = 718274560
+	ObjectContentDisposition       = `attachment; filename="ubuntu-17.04-server-amd64.iso"`
+	ObjectContentEncoding          = "identity"
+	ObjectContentLanguage          = "en-US"
+	ObjectExpires                  = "Thu, 01 Dec 2094 16:00:00 GMT"
+	ObjectChecksumAlgorithm        = "CRC32C"
+	ObjectChecksum                 = "yZRlqg=="
 )
 
 var (
@@ -31,13 +62,25 @@ var (
 
 func ObjectMetadata() meta.ObjectData {
 	return meta.ObjectData{
-		ContentMD5:   ObjectContentMD5,
-		Size:         ObjectSize,
-		CacheControl: ObjectCacheControl,
-		LastModified: ObjectLastModified,
-		ContentType:  ObjectContentType,
-		VersionID:    ObjectVersionID,
-		UserDefined:  ObjectUserDefined(),
+		ContentMD5:         ObjectContentMD5,
+		Size:               ObjectSize,
+		CacheControl:       ObjectCacheControl,
+		LastModified:       ObjectLastModified,
+		ContentType:        ObjectContentType,
+		VersionID:          ObjectVersionID,
+		UserDefined:        ObjectUserDefined(),
+		ContentDisposition: ObjectContentDisposition,
+		ContentEncoding:    ObjectContentEncoding,
+		ContentLanguage:    ObjectContentLanguage,
+		Expires:            ObjectExpires,
+		Tags:               ObjectTags(),
+		ChecksumAlgorithm:  ObjectChecksumAlgorithm,
+		Checksum:           ObjectChecksum,
+		Owner:              Owner(),
+		ACL: []meta.Grant{
+			OwnerGrant(),
+			{Type: "Group", Grantee: "http://acs.amazonaws.com/groups/global/AllUsers", Permission: "READ"},
+		},
 	}
 }
 
@@ -49,3 +92,38 @@ func ObjectUserDefined() map[string]string {
 		"version": "17.04",
 	}
 }
+
+func ObjectTags() map[string]string {
+	return map[string]string{
+		"release": "zesty",
+	}
+}
+
+var (
+	UploadInitiated = time.Date(2017, 2, 11, 4, 58, 12, 0, time.UTC)
+)
+
+func UploadMetadata() meta.UploadData {
+	return meta.UploadData{
+		Initiated: UploadInitiated,
+		Object: meta.ObjectData{
+			ContentType:       ObjectContentType,
+			UserDefined:       ObjectUserDefined(),
+			ChecksumAlgorithm: ObjectChecksumAlgorithm,
+		},
+		Parts: map[int]meta.PartData{
+			1: {
+				ContentMD5:   "a54357aff0632cce46d942af68356b38",
+				Size:         5242880,
+				LastModified: Time1,
+				Checksum:     "4waSgw==",
+			},
+			2: {
+				ContentMD5:   "0c78aef83f66abc1fa1e8477f296d394",
+				Size:         1024,
+				LastModified: Time2,
+				Checksum:     "WSEBpA==",
+			},
+		},
+	}
+}
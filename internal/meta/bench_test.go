@@ -0,0 +1,90 @@
+package meta_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ophymx/s3d/internal/meta"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+const benchPrefixes = 20
+
+var benchBuckets struct {
+	sync.Once
+	db meta.DB
+}
+
+// benchDB holds buckets with benchPrefixes common prefixes of 10, 100 and
+// 1000 keys each. It is shared by the benchmarks as it is slow to fill,
+// and its file is removed up front as it stays open until the test exits.
+func benchDB() meta.DB {
+	benchBuckets.Do(func() {
+		var dbpath string
+		dbpath, benchBuckets.db = setup()
+		must(os.Remove(dbpath))
+		for _, keys := range []int{10, 100, 1000} {
+			bucket := fmt.Sprintf("keys-%d", keys)
+			must(benchBuckets.db.CreateBucket(bucket, meta.BucketData{}))
+			for i := 0; i < benchPrefixes; i++ {
+				for j := 0; j < keys; j++ {
+					key := fmt.Sprintf("prefix-%02d/key-%04d", i, j)
+					must(benchBuckets.db.Put(s3.NewResource(bucket, key), meta.ObjectData{Size: int64(j)}))
+				}
+			}
+		}
+	})
+	return benchBuckets.db
+}
+
+// listPrefixes rolls up the keys of bucket at the first "/", seeking past
+// each common prefix listed when seekAhead is set.
+func listPrefixes(db meta.DB, bucket string, seekAhead bool) (prefixes int, err error) {
+	last := ""
+	err = db.ScanBucket(bucket, "", func(key string, _ meta.LazyObject) (string, bool, error) {
+		prefix := key[:strings.Index(key, "/")+1]
+		if prefix != last {
+			prefixes++
+			last = prefix
+		}
+		if seekAhead {
+			// "0" follows "/", so seeks past every key under prefix.
+			return prefix[:len(prefix)-1] + "0", true, nil
+		}
+		return "", true, nil
+	})
+	return
+}
+
+func benchmarkListPrefixes(b *testing.B, seekAhead bool) {
+	db := benchDB()
+	for _, keys := range []int{10, 100, 1000} {
+		bucket := fmt.Sprintf("keys-%d", keys)
+		b.Run(bucket, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				prefixes, err := listPrefixes(db, bucket, seekAhead)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if prefixes != benchPrefixes {
+					b.Fatalf("listed %d common prefixes, expected %d", prefixes, benchPrefixes)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkListPrefixesScan reads every key under each common prefix, so
+// it slows down as the prefixes grow.
+func BenchmarkListPrefixesScan(b *testing.B) {
+	benchmarkListPrefixes(b, false)
+}
+
+// BenchmarkListPrefixesSeek reads one key per common prefix, so it keeps
+// pace however many keys each prefix holds.
+func BenchmarkListPrefixesSeek(b *testing.B) {
+	benchmarkListPrefixes(b, true)
+}
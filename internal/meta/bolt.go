@@ -1,13 +1,22 @@
 package meta
 
 import (
+	"bytes"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/boltdb/bolt"
 )
 
+// openTimeout bounds how long NewDB waits for another process to let go
+// of the database.
+const openTimeout = time.Second
+
 const (
 	bucketMetadataKey = "%%%%meta%%%%"
+	bucketUploadsKey  = "%%%%uploads%%%%"
+	bucketVersionsKey = "%%%%versions%%%%"
 )
 
 type boltDB struct {
@@ -15,10 +24,13 @@ type boltDB struct {
 	encoding Encoding
 }
 
-// NewDB returns a DB backed by bolt.DB.
+// NewDB returns a DB backed by bolt.DB. It fails with ErrLocked while
+// another process has the database open.
 func NewDB(root string, encoding Encoding) (db DB, err error) {
-	bdb, err := bolt.Open(root, 0640, nil)
-	if err != nil {
+	bdb, err := bolt.Open(root, 0640, &bolt.Options{Timeout: openTimeout})
+	if err == bolt.ErrTimeout {
+		return nil, ErrLocked
+	} else if err != nil {
 		return
 	}
 	return boltDB{bdb: bdb, encoding: encoding}, nil
@@ -63,6 +75,36 @@ func (db boltDB) Put(target Target, data ObjectData) error {
 	})
 }
 
+func (db boltDB) PutIf(target Target, data ObjectData, precondition Precondition) error {
+	bucket := target.Bucket()
+	key := target.Key()
+	return db.bdb.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			log.Printf("PutIf: bucket not found: %s", bucket)
+			return ErrBucketNotFound
+		}
+
+		var current ObjectData
+		objBytes := b.Get([]byte(key))
+		if objBytes != nil {
+			var err error
+			if current, err = db.encoding.DecodeObject(objBytes); err != nil {
+				return err
+			}
+		}
+		if err := precondition(current, objBytes != nil); err != nil {
+			return err
+		}
+
+		objBytes, err := db.encoding.EncodeObject(data)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), objBytes)
+	})
+}
+
 func (db boltDB) Delete(target Target) error {
 	bucket := target.Bucket()
 	key := target.Key()
@@ -76,11 +118,234 @@ func (db boltDB) Delete(target Target) error {
 	})
 }
 
+// GetVersion fetches the version of target with versionID, current or not.
+// The null version has an empty versionID.
+func (db boltDB) GetVersion(target Target, versionID string) (data ObjectData, err error) {
+	err = db.bdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(target.Bucket()))
+		if b == nil {
+			log.Printf("GetVersion: bucket not found: %s", target.Bucket())
+			return ErrBucketNotFound
+		}
+
+		if objBytes := b.Get([]byte(target.Key())); objBytes != nil {
+			current, err := db.encoding.DecodeObject(objBytes)
+			if err != nil {
+				return err
+			}
+			if current.VersionID == versionID {
+				data = current
+				return nil
+			}
+		}
+		versions := b.Bucket([]byte(bucketVersionsKey))
+		if versions == nil {
+			return ErrVersionNotFound
+		}
+		_, found, err := db.findVersion(versions, target, versionID)
+		data = found
+		return err
+	})
+	return
+}
+
+// PutVersion makes data the newest version of target, provided
+// precondition holds for the current version. The current version is kept
+// as a noncurrent version, and any version with the same version ID as
+// data, which can only be the null version, is replaced. Delete markers are
+// only ever kept as noncurrent versions, leaving target without a current
+// version.
+func (db boltDB) PutVersion(target Target, data ObjectData, precondition Precondition) error {
+	return db.bdb.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(target.Bucket()))
+		if b == nil {
+			log.Printf("PutVersion: bucket not found: %s", target.Bucket())
+			return ErrBucketNotFound
+		}
+		versions, err := b.CreateBucketIfNotExists([]byte(bucketVersionsKey))
+		if err != nil {
+			return err
+		}
+
+		key := []byte(target.Key())
+		var current ObjectData
+		objBytes := b.Get(key)
+		if objBytes != nil {
+			if current, err = db.encoding.DecodeObject(objBytes); err != nil {
+				return err
+			}
+		}
+		if err = precondition(current, objBytes != nil); err != nil {
+			return err
+		}
+
+		if k, _, err := db.findVersion(versions, target, data.VersionID); err == nil {
+			if err = versions.Delete(k); err != nil {
+				return err
+			}
+		} else if err != ErrVersionNotFound {
+			return err
+		}
+		if objBytes != nil && current.VersionID != data.VersionID {
+			if err = db.archive(versions, target, append([]byte{}, objBytes...)); err != nil {
+				return err
+			}
+		}
+
+		if objBytes, err = db.encoding.EncodeObject(data); err != nil {
+			return err
+		}
+		if data.DeleteMarker {
+			if err = b.Delete(key); err != nil {
+				return err
+			}
+			return db.archive(versions, target, objBytes)
+		}
+		return b.Put(key, objBytes)
+	})
+}
+
+// ReplaceVersion rewrites the version of target with the version ID of
+// data, provided precondition holds for it. A missing version is reported
+// as ErrVersionNotFound rather than to precondition.
+func (db boltDB) ReplaceVersion(target Target, data ObjectData, precondition Precondition) error {
+	return db.bdb.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(target.Bucket()))
+		if b == nil {
+			log.Printf("ReplaceVersion: bucket not found: %s", target.Bucket())
+			return ErrBucketNotFound
+		}
+		objBytes, err := db.encoding.EncodeObject(data)
+		if err != nil {
+			return err
+		}
+
+		key := []byte(target.Key())
+		if currentBytes := b.Get(key); currentBytes != nil {
+			current, err := db.encoding.DecodeObject(currentBytes)
+			if err != nil {
+				return err
+			}
+			if current.VersionID == data.VersionID {
+				if err = precondition(current, true); err != nil {
+					return err
+				}
+				return b.Put(key, objBytes)
+			}
+		}
+		versions := b.Bucket([]byte(bucketVersionsKey))
+		if versions == nil {
+			return ErrVersionNotFound
+		}
+		k, version, err := db.findVersion(versions, target, data.VersionID)
+		if err != nil {
+			return err
+		}
+		if err = precondition(version, true); err != nil {
+			return err
+		}
+		return versions.Put(k, objBytes)
+	})
+}
+
+// DeleteVersion deletes the version of target with versionID and returns
+// it. Once target has no current version, the newest noncurrent version
+// becomes current, unless it is a delete marker.
+func (db boltDB) DeleteVersion(target Target, versionID string) (data ObjectData, err error) {
+	err = db.bdb.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(target.Bucket()))
+		if b == nil {
+			log.Printf("DeleteVersion: bucket not found: %s", target.Bucket())
+			return ErrBucketNotFound
+		}
+		versions := b.Bucket([]byte(bucketVersionsKey))
+
+		key := []byte(target.Key())
+		if objBytes := b.Get(key); objBytes != nil {
+			current, err := db.encoding.DecodeObject(objBytes)
+			if err != nil {
+				return err
+			}
+			if current.VersionID == versionID {
+				data = current
+				if err = b.Delete(key); err != nil {
+					return err
+				}
+				return db.promote(b, versions, target)
+			}
+		}
+		if versions == nil {
+			return ErrVersionNotFound
+		}
+
+		k, found, err := db.findVersion(versions, target, versionID)
+		if err != nil {
+			return err
+		}
+		data = found
+		if err = versions.Delete(k); err != nil {
+			return err
+		}
+		if b.Get(key) == nil {
+			return db.promote(b, versions, target)
+		}
+		return nil
+	})
+	return
+}
+
+// findVersion finds the noncurrent version of target with versionID and
+// the key it is stored under.
+func (db boltDB) findVersion(versions *bolt.Bucket, target Target, versionID string) (key []byte, data ObjectData, err error) {
+	prefix := versionPrefix(target)
+	c := versions.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if data, err = db.encoding.DecodeObject(v); err != nil {
+			return
+		}
+		if data.VersionID == versionID {
+			return k, data, nil
+		}
+	}
+	return nil, ObjectData{}, ErrVersionNotFound
+}
+
+// archive keeps objBytes as the newest noncurrent version of target.
+func (db boltDB) archive(versions *bolt.Bucket, target Target, objBytes []byte) error {
+	sequence, err := versions.NextSequence()
+	if err != nil {
+		return err
+	}
+	return versions.Put(versionKey(target, sequence), objBytes)
+}
+
+// promote makes the newest noncurrent version of target current, unless it
+// is a delete marker.
+func (db boltDB) promote(b, versions *bolt.Bucket, target Target) error {
+	if versions == nil {
+		return nil
+	}
+	prefix := versionPrefix(target)
+	k, v := versions.Cursor().Seek(prefix)
+	if k == nil || !bytes.HasPrefix(k, prefix) {
+		return nil
+	}
+	data, err := db.encoding.DecodeObject(v)
+	if err != nil || data.DeleteMarker {
+		return err
+	}
+	v = append([]byte{}, v...)
+	if err = versions.Delete(k); err != nil {
+		return err
+	}
+	return b.Put([]byte(target.Key()), v)
+}
+
 func (db boltDB) CreateBucket(bucket string, data BucketData) error {
 	return db.bdb.Update(func(tx *bolt.Tx) error {
 		b, err := tx.CreateBucket([]byte(bucket))
 		if err == bolt.ErrBucketExists {
-			return nil
+			return ErrBucketExists
 		} else if err != nil {
 			return err
 		}
@@ -94,7 +359,52 @@ func (db boltDB) CreateBucket(bucket string, data BucketData) error {
 	})
 }
 
+func (db boltDB) GetBucket(bucket string) (data BucketData, err error) {
+	err = db.bdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrBucketNotFound
+		}
+		dataBytes := b.Get([]byte(bucketMetadataKey))
+		if len(dataBytes) == 0 {
+			return ErrMissingBucketMetadata
+		}
+		var encErr error
+		data, encErr = db.encoding.DecodeBucket(dataBytes)
+		return encErr
+	})
+	return
+}
+
+func (db boltDB) PutBucket(bucket string, data BucketData) error {
+	return db.bdb.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrBucketNotFound
+		}
+		dataBytes, err := db.encoding.EncodeBucket(data)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(bucketMetadataKey), dataBytes)
+	})
+}
+
 func (db boltDB) DeleteBucket(bucket string) error {
+	return db.bdb.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			log.Printf("DeleteBucket: bucket not found: %s", bucket)
+			return ErrBucketNotFound
+		}
+		if !isEmpty(b) {
+			return ErrBucketNotEmpty
+		}
+		return tx.DeleteBucket([]byte(bucket))
+	})
+}
+
+func (db boltDB) ForceDeleteBucket(bucket string) error {
 	return db.bdb.Update(func(tx *bolt.Tx) error {
 		err := tx.DeleteBucket([]byte(bucket))
 		if err == bolt.ErrBucketNotFound {
@@ -104,6 +414,24 @@ func (db boltDB) DeleteBucket(bucket string) error {
 	})
 }
 
+// isEmpty reports whether b holds no objects, and its nested versions and
+// uploads buckets are empty.
+func isEmpty(b *bolt.Bucket) bool {
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if string(k) == bucketMetadataKey {
+			continue
+		}
+		if v != nil {
+			return false
+		}
+		if first, _ := b.Bucket(k).Cursor().First(); first != nil {
+			return false
+		}
+	}
+	return true
+}
+
 func (db boltDB) ListBuckets() (buckets []Bucket, err error) {
 	err = db.bdb.View(func(tx *bolt.Tx) error {
 		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
@@ -132,31 +460,262 @@ func (db boltDB) ListBuckets() (buckets []Bucket, err error) {
 }
 
 func (db boltDB) ForEachInBucket(bucket, seek string, fn ForEachFunc) error {
+	return db.ScanBucket(bucket, seek, func(key string, obj LazyObject) (string, bool, error) {
+		next, err := fn(key, obj)
+		return "", next, err
+	})
+}
+
+// ScanBucket iterates over the objects in bucket from the first key of at
+// least seek, seeking ahead whenever fn asks to.
+func (db boltDB) ScanBucket(bucket, seek string, fn ScanFunc) error {
 	return db.bdb.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucket))
 		if b == nil {
-			log.Printf("Put: bucket not found: %s", bucket)
+			log.Printf("ScanBucket: bucket not found: %s", bucket)
 			return ErrBucketNotFound
 		}
 
 		c := b.Cursor()
-		for k, v := c.Seek([]byte(seek)); k != nil; k, v = c.Next() {
+		for k, v := c.Seek([]byte(seek)); k != nil; {
 			key := string(k)
-			if key == bucketMetadataKey {
+			if key == bucketMetadataKey || v == nil {
+				k, v = c.Next()
 				continue
 			}
-			next, err := fn(key, lazyObject{data: v, encoding: db.encoding})
+			ahead, next, err := fn(key, lazyObject{data: v, encoding: db.encoding})
 			if err != nil {
 				return err
 			}
 			if !next {
 				break
 			}
+			if ahead > key {
+				k, v = c.Seek([]byte(ahead))
+			} else {
+				k, v = c.Next()
+			}
 		}
 		return nil
 	})
 }
 
+func (db boltDB) CreateUpload(target Target, uploadID string, data UploadData) error {
+	bucket := target.Bucket()
+	return db.bdb.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			log.Printf("CreateUpload: bucket not found: %s", bucket)
+			return ErrBucketNotFound
+		}
+		uploads, err := b.CreateBucketIfNotExists([]byte(bucketUploadsKey))
+		if err != nil {
+			return err
+		}
+
+		dataBytes, err := db.encoding.EncodeUpload(data)
+		if err != nil {
+			return err
+		}
+		return uploads.Put(uploadKey(target, uploadID), dataBytes)
+	})
+}
+
+func (db boltDB) GetUpload(target Target, uploadID string) (data UploadData, err error) {
+	err = db.bdb.View(func(tx *bolt.Tx) error {
+		uploads, err := db.uploads(tx, target)
+		if err != nil {
+			return err
+		}
+
+		dataBytes := uploads.Get(uploadKey(target, uploadID))
+		if dataBytes == nil {
+			return ErrUploadNotFound
+		}
+		data, err = db.encoding.DecodeUpload(dataBytes)
+		return err
+	})
+	return
+}
+
+func (db boltDB) PutPart(target Target, uploadID string, partNumber int, part PartData) error {
+	return db.bdb.Update(func(tx *bolt.Tx) error {
+		uploads, err := db.uploads(tx, target)
+		if err != nil {
+			return err
+		}
+
+		key := uploadKey(target, uploadID)
+		dataBytes := uploads.Get(key)
+		if dataBytes == nil {
+			return ErrUploadNotFound
+		}
+		data, err := db.encoding.DecodeUpload(dataBytes)
+		if err != nil {
+			return err
+		}
+
+		if data.Parts == nil {
+			data.Parts = make(map[int]PartData)
+		}
+		data.Parts[partNumber] = part
+		if dataBytes, err = db.encoding.EncodeUpload(data); err != nil {
+			return err
+		}
+		return uploads.Put(key, dataBytes)
+	})
+}
+
+func (db boltDB) DeleteUpload(target Target, uploadID string) error {
+	return db.bdb.Update(func(tx *bolt.Tx) error {
+		uploads, err := db.uploads(tx, target)
+		if err != nil {
+			return err
+		}
+
+		key := uploadKey(target, uploadID)
+		if uploads.Get(key) == nil {
+			return ErrUploadNotFound
+		}
+		return uploads.Delete(key)
+	})
+}
+
+// ForEachUpload iterates over uploads ordered by key then upload ID,
+// starting at the first upload with a key of at least seek.
+func (db boltDB) ForEachUpload(bucket, seek string, fn ForEachUploadFunc) error {
+	return db.bdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			log.Printf("ForEachUpload: bucket not found: %s", bucket)
+			return ErrBucketNotFound
+		}
+		uploads := b.Bucket([]byte(bucketUploadsKey))
+		if uploads == nil {
+			return nil
+		}
+
+		c := uploads.Cursor()
+		for k, v := c.Seek([]byte(seek)); k != nil; k, v = c.Next() {
+			data, err := db.encoding.DecodeUpload(v)
+			if err != nil {
+				return err
+			}
+			idx := bytes.LastIndexByte(k, 0)
+			next, err := fn(string(k[:idx]), string(k[idx+1:]), data)
+			if err != nil {
+				return err
+			}
+			if !next {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// ForEachVersion iterates over the versions and delete markers of objects
+// ordered by key then newest first, starting at the first key of at least
+// seek and seeking ahead whenever fn asks to.
+func (db boltDB) ForEachVersion(bucket, seek string, fn ForEachVersionFunc) error {
+	return db.bdb.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			log.Printf("ForEachVersion: bucket not found: %s", bucket)
+			return ErrBucketNotFound
+		}
+
+		current := b.Cursor()
+		k, v := current.Seek([]byte(seek))
+		var noncurrent *bolt.Cursor
+		var nk, nv []byte
+		if versions := b.Bucket([]byte(bucketVersionsKey)); versions != nil {
+			noncurrent = versions.Cursor()
+			nk, nv = noncurrent.Seek([]byte(seek))
+		}
+		emit := func(key string, v []byte, latest bool) (string, bool, error) {
+			data, err := db.encoding.DecodeObject(v)
+			if err != nil {
+				return "", false, err
+			}
+			return fn(key, data, latest)
+		}
+
+		for {
+			for k != nil && (string(k) == bucketMetadataKey || v == nil) {
+				k, v = current.Next()
+			}
+			if k == nil && nk == nil {
+				return nil
+			}
+			key := k
+			if nk != nil && (k == nil || bytes.Compare(versionedKey(nk), k) < 0) {
+				key = versionedKey(nk)
+			}
+			name := string(key)
+
+			var ahead string
+			var next bool
+			var err error
+			latest := true
+			if k != nil && bytes.Equal(k, key) {
+				if ahead, next, err = emit(name, v, true); err != nil || !next {
+					return err
+				}
+				latest = false
+				k, v = current.Next()
+			}
+			for ahead <= name && nk != nil && bytes.Equal(versionedKey(nk), key) {
+				if ahead, next, err = emit(name, nv, latest); err != nil || !next {
+					return err
+				}
+				latest = false
+				nk, nv = noncurrent.Next()
+			}
+			if ahead > name {
+				k, v = current.Seek([]byte(ahead))
+				if noncurrent != nil {
+					nk, nv = noncurrent.Seek([]byte(ahead))
+				}
+			}
+		}
+	})
+}
+
+// uploads fetches the nested bolt bucket of multipart uploads for target's bucket.
+func (db boltDB) uploads(tx *bolt.Tx, target Target) (*bolt.Bucket, error) {
+	b := tx.Bucket([]byte(target.Bucket()))
+	if b == nil {
+		log.Printf("uploads: bucket not found: %s", target.Bucket())
+		return nil, ErrBucketNotFound
+	}
+	uploads := b.Bucket([]byte(bucketUploadsKey))
+	if uploads == nil {
+		return nil, ErrUploadNotFound
+	}
+	return uploads, nil
+}
+
+// uploadKey orders uploads by object key then upload ID.
+func uploadKey(target Target, uploadID string) []byte {
+	return []byte(target.Key() + "\x00" + uploadID)
+}
+
+func versionPrefix(target Target) []byte {
+	return []byte(target.Key() + "\x00")
+}
+
+// versionedKey is the object key of a noncurrent version's key.
+func versionedKey(k []byte) []byte {
+	return k[:bytes.LastIndexByte(k, 0)]
+}
+
+// versionKey orders the noncurrent versions of a key newest first, by the
+// inverse of the sequence number they were archived with.
+func versionKey(target Target, sequence uint64) []byte {
+	return append(versionPrefix(target), fmt.Sprintf("%016x", ^sequence)...)
+}
+
 func (db boltDB) Close() error {
 	return db.bdb.Close()
 }
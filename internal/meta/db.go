@@ -6,19 +6,51 @@ import (
 )
 
 var (
+	ErrBucketExists          = errors.New("metadata bucket already exists")
 	ErrBucketNotFound        = errors.New("metadata bucket not found")
+	ErrBucketNotEmpty        = errors.New("metadata bucket not empty")
 	ErrKeyNotFound           = errors.New("metadata key not found")
+	ErrLocked                = errors.New("metadata database locked by another process")
 	ErrMissingBucketMetadata = errors.New("bucket metadata not found")
+	ErrUploadNotFound        = errors.New("metadata upload not found")
+	ErrVersionNotFound       = errors.New("metadata version not found")
+)
+
+// Versioning states of a bucket. Buckets that never had versioning enabled
+// are in neither.
+const (
+	VersioningEnabled   = "Enabled"
+	VersioningSuspended = "Suspended"
 )
 
 type DB interface {
 	Get(target Target) (data ObjectData, err error)
 	Put(target Target, data ObjectData) error
+	PutIf(target Target, data ObjectData, precondition Precondition) error
 	Delete(target Target) error
+	GetVersion(target Target, versionID string) (data ObjectData, err error)
+	PutVersion(target Target, data ObjectData, precondition Precondition) error
+	// ReplaceVersion rewrites the version of target with the version ID of
+	// data in place, whether it is current or not.
+	ReplaceVersion(target Target, data ObjectData, precondition Precondition) error
+	DeleteVersion(target Target, versionID string) (data ObjectData, err error)
 	CreateBucket(bucket string, data BucketData) error
+	GetBucket(bucket string) (data BucketData, err error)
+	PutBucket(bucket string, data BucketData) error
+	// DeleteBucket deletes bucket, unless objects, versions or uploads
+	// remain in it.
 	DeleteBucket(bucket string) error
+	// ForceDeleteBucket deletes bucket and everything in it.
+	ForceDeleteBucket(bucket string) error
 	ListBuckets() (buckets []Bucket, err error)
 	ForEachInBucket(bucket, seek string, forEach ForEachFunc) error
+	ScanBucket(bucket, seek string, scan ScanFunc) error
+	ForEachVersion(bucket, seek string, forEach ForEachVersionFunc) error
+	CreateUpload(target Target, uploadID string, data UploadData) error
+	GetUpload(target Target, uploadID string) (data UploadData, err error)
+	PutPart(target Target, uploadID string, partNumber int, data PartData) error
+	DeleteUpload(target Target, uploadID string) error
+	ForEachUpload(bucket, seek string, forEach ForEachUploadFunc) error
 	Close() error
 }
 
@@ -31,8 +63,23 @@ type LazyObject interface {
 	Get() (obj ObjectData, err error)
 }
 
+// Precondition is called with the object currently stored, if found, in the
+// same transaction as the write. Returning an error aborts the write.
+type Precondition func(current ObjectData, found bool) error
+
 type ForEachFunc func(key string, obj LazyObject) (next bool, err error)
 
+// ScanFunc is called like ForEachFunc, but may return a key to seek ahead
+// to, skipping the keys before it. An empty seek moves to the next key.
+type ScanFunc func(key string, obj LazyObject) (seek string, next bool, err error)
+
+// ForEachVersionFunc is called with each version of an object, latest is
+// set for the newest one. Like ScanFunc, it may return a key to seek ahead
+// to, skipping the versions of the keys before it.
+type ForEachVersionFunc func(key string, version ObjectData, latest bool) (seek string, next bool, err error)
+
+type ForEachUploadFunc func(key, uploadID string, upload UploadData) (next bool, err error)
+
 type Bucket struct {
 	Name     string
 	Metadata BucketData
@@ -40,16 +87,69 @@ type Bucket struct {
 
 type BucketData struct {
 	CreationDate time.Time
+	// Policy is the JSON bucket policy, if one has been set.
+	Policy string
+	Owner  Owner
+	ACL    []Grant
+	// Versioning is the versioning state, if versioning was ever enabled.
+	Versioning string
+	// Location is the LocationConstraint the bucket was created with,
+	// which is empty for us-east-1.
+	Location string
+}
+
+// Owner identifies the account a bucket or object belongs to. It is empty
+// for anything created anonymously.
+type Owner struct {
+	ID          string
+	DisplayName string
+}
+
+// Grant gives a grantee a permission. Grantee holds the canonical ID, group
+// URI or email address of the grantee, depending on Type.
+type Grant struct {
+	Type        string
+	Grantee     string
+	DisplayName string
+	Permission  string
 }
 
 type ObjectData struct {
+	ContentMD5         string
+	Size               int64
+	CacheControl       string
+	LastModified       time.Time
+	ContentType        string
+	VersionID          string
+	UserDefined        map[string]string
+	PartSizes          []int64
+	ContentDisposition string
+	ContentEncoding    string
+	ContentLanguage    string
+	Expires            string
+	Tags               map[string]string
+	ChecksumAlgorithm  string
+	Checksum           string
+	Owner              Owner
+	ACL                []Grant
+	// DeleteMarker is set on the versions that mark an object as deleted.
+	// They are never the current version of an object.
+	DeleteMarker bool
+}
+
+// UploadData is an in-progress multipart upload.
+// Object holds the metadata given when the upload was initiated.
+type UploadData struct {
+	Initiated time.Time
+	Object    ObjectData
+	Parts     map[int]PartData
+}
+
+type PartData struct {
 	ContentMD5   string
 	Size         int64
-	CacheControl string
 	LastModified time.Time
-	ContentType  string
-	VersionID    string
-	UserDefined  map[string]string
+	Checksum     string
 }
 
 type Encoding interface {
@@ -57,4 +157,6 @@ type Encoding interface {
 	DecodeBucket(b []byte) (BucketData, error)
 	EncodeObject(data ObjectData) ([]byte, error)
 	DecodeObject(b []byte) (ObjectData, error)
+	EncodeUpload(data UploadData) ([]byte, error)
+	DecodeUpload(b []byte) (UploadData, error)
 }
@@ -1,11 +1,14 @@
 package meta_test
 
 import (
+	"errors"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/ophymx/s3d/internal/fixtures"
 	"github.com/ophymx/s3d/internal/meta"
+	"github.com/ophymx/s3d/internal/meta/dbenc"
 	"github.com/ophymx/s3d/internal/s3"
 )
 
@@ -21,6 +24,13 @@ var _ = Describe("DB", func() {
 	BeforeEach(func() { dbpath, db = setup() })
 	AfterEach(func() { tearDown(dbpath, db) })
 
+	Describe("NewDB", func() {
+		It("returns a locked error while the database is open", func() {
+			_, err := meta.NewDB(dbpath, dbenc.MsgPack)
+			Expect(err).To(Equal(meta.ErrLocked))
+		})
+	})
+
 	Describe("ListBuckets", func() {
 		Context("when no buckets exist", func() {
 			It("returns an empty list of buckets", func() {
@@ -42,9 +52,9 @@ var _ = Describe("DB", func() {
 		})
 		Context("when bucket already exists", func() {
 			BeforeEach(func() { must(db.CreateBucket("foo", meta.BucketData{})) })
-			It("does not error", func() {
+			It("returns a bucket exists error and keeps the bucket", func() {
 				Expect(db.CreateBucket("foo", meta.BucketData{CreationDate: bucketDate})).
-					ToNot(HaveOccurred())
+					To(Equal(meta.ErrBucketExists))
 				Expect(db.ListBuckets()).To(Equal([]meta.Bucket{{
 					Name:     "foo",
 					Metadata: meta.BucketData{},
@@ -57,7 +67,61 @@ var _ = Describe("DB", func() {
 		Context("when a bucket does not already exist", func() {
 			It("returns a bucket not found error", func() {
 				Expect(db.DeleteBucket("foo")).To(Equal(meta.ErrBucketNotFound))
+				Expect(db.ForceDeleteBucket("foo")).To(Equal(meta.ErrBucketNotFound))
+			})
+		})
+		Context("when a bucket exists", func() {
+			target := s3.NewResource("foo", "bar")
+			BeforeEach(func() { must(db.CreateBucket("foo", meta.BucketData{})) })
+			It("deletes the bucket when it is empty", func() {
+				must(db.Put(target, meta.ObjectData{}))
+				must(db.Delete(target))
+				Expect(db.DeleteBucket("foo")).To(Succeed())
+				Expect(db.ListBuckets()).To(BeEmpty())
+			})
+			It("refuses to delete the bucket while objects remain", func() {
+				must(db.Put(target, meta.ObjectData{}))
+				Expect(db.DeleteBucket("foo")).To(Equal(meta.ErrBucketNotEmpty))
+			})
+			It("refuses to delete the bucket while delete markers remain", func() {
+				must(db.PutVersion(target, meta.ObjectData{VersionID: "m1", DeleteMarker: true}, func(meta.ObjectData, bool) error { return nil }))
+				Expect(db.DeleteBucket("foo")).To(Equal(meta.ErrBucketNotEmpty))
+			})
+			It("refuses to delete the bucket while uploads remain", func() {
+				must(db.CreateUpload(target, "upload1", meta.UploadData{}))
+				Expect(db.DeleteBucket("foo")).To(Equal(meta.ErrBucketNotEmpty))
+				must(db.DeleteUpload(target, "upload1"))
+				Expect(db.DeleteBucket("foo")).To(Succeed())
 			})
+			It("force deletes the bucket along with everything in it", func() {
+				must(db.Put(target, meta.ObjectData{}))
+				must(db.CreateUpload(target, "upload1", meta.UploadData{}))
+				Expect(db.ForceDeleteBucket("foo")).To(Succeed())
+				Expect(db.ListBuckets()).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("GetBucket", func() {
+		It("returns a bucket not found error when the bucket does not exist", func() {
+			_, err := db.GetBucket("foo")
+			Expect(err).To(Equal(meta.ErrBucketNotFound))
+		})
+		It("returns the bucket metadata", func() {
+			must(db.CreateBucket("foo", meta.BucketData{CreationDate: bucketDate}))
+			Expect(db.GetBucket("foo")).To(Equal(meta.BucketData{CreationDate: bucketDate}))
+		})
+	})
+
+	Describe("PutBucket", func() {
+		It("returns a bucket not found error when the bucket does not exist", func() {
+			Expect(db.PutBucket("foo", meta.BucketData{})).To(Equal(meta.ErrBucketNotFound))
+		})
+		It("replaces the bucket metadata", func() {
+			must(db.CreateBucket("foo", meta.BucketData{CreationDate: bucketDate}))
+			data := meta.BucketData{CreationDate: bucketDate, Policy: fixtures.BucketPolicy}
+			Expect(db.PutBucket("foo", data)).To(Succeed())
+			Expect(db.GetBucket("foo")).To(Equal(data))
 		})
 	})
 
@@ -85,4 +149,303 @@ var _ = Describe("DB", func() {
 			})
 		})
 	})
+
+	Describe("PutIf", func() {
+		var target = s3.NewResource("foo", "bar")
+		var errRejected = errors.New("rejected")
+		BeforeEach(func() {
+			db.CreateBucket("foo", meta.BucketData{CreationDate: bucketDate})
+		})
+
+		It("passes the object currently stored to the precondition", func() {
+			Expect(db.PutIf(target, meta.ObjectData{Size: 1}, func(current meta.ObjectData, found bool) error {
+				Expect(found).To(BeFalse())
+				return nil
+			})).To(Succeed())
+			Expect(db.PutIf(target, meta.ObjectData{Size: 2}, func(current meta.ObjectData, found bool) error {
+				Expect(found).To(BeTrue())
+				Expect(current.Size).To(Equal(int64(1)))
+				return nil
+			})).To(Succeed())
+			current, _ := db.Get(target)
+			Expect(current.Size).To(Equal(int64(2)))
+		})
+
+		It("does not write when the precondition fails", func() {
+			db.Put(target, meta.ObjectData{Size: 1})
+			Expect(db.PutIf(target, meta.ObjectData{Size: 2}, func(meta.ObjectData, bool) error {
+				return errRejected
+			})).To(Equal(errRejected))
+			current, _ := db.Get(target)
+			Expect(current.Size).To(Equal(int64(1)))
+		})
+	})
+
+	Describe("ScanBucket", func() {
+		var scanned []string
+		scan := func(key string, _ meta.LazyObject) (string, bool, error) {
+			scanned = append(scanned, key)
+			if key == "a/1" {
+				return "a0", true, nil
+			}
+			return "", true, nil
+		}
+		BeforeEach(func() {
+			scanned = nil
+			must(db.CreateBucket("foo", meta.BucketData{}))
+			for _, key := range []string{"a", "a/1", "a/2", "a/3", "a0", "b"} {
+				must(db.Put(s3.NewResource("foo", key), meta.ObjectData{}))
+			}
+		})
+
+		It("returns a bucket not found error when the bucket does not exist", func() {
+			Expect(db.ScanBucket("bar", "", scan)).To(Equal(meta.ErrBucketNotFound))
+		})
+		It("seeks ahead to the key returned", func() {
+			Expect(db.ScanBucket("foo", "", scan)).To(Succeed())
+			Expect(scanned).To(Equal([]string{"a", "a/1", "a0", "b"}))
+		})
+		It("does not seek backwards", func() {
+			Expect(db.ScanBucket("foo", "a/", func(key string, _ meta.LazyObject) (string, bool, error) {
+				scanned = append(scanned, key)
+				return "a", len(scanned) < 3, nil
+			})).To(Succeed())
+			Expect(scanned).To(Equal([]string{"a/1", "a/2", "a/3"}))
+		})
+	})
+
+	Describe("Versions", func() {
+		var target = s3.NewResource("foo", "bar")
+		accept := func(meta.ObjectData, bool) error { return nil }
+		version := func(versionID string) meta.ObjectData {
+			return meta.ObjectData{VersionID: versionID, LastModified: bucketDate}
+		}
+		marker := func(versionID string) meta.ObjectData {
+			return meta.ObjectData{VersionID: versionID, LastModified: bucketDate, DeleteMarker: true}
+		}
+		versionIDs := func(target meta.Target, versionIDs ...string) []string {
+			found := []string{}
+			for _, versionID := range versionIDs {
+				if _, err := db.GetVersion(target, versionID); err == nil {
+					found = append(found, versionID)
+				}
+			}
+			return found
+		}
+		currentVersionID := func() string {
+			current, err := db.Get(target)
+			if err != nil {
+				return "none"
+			}
+			return current.VersionID
+		}
+
+		It("returns a bucket not found error when the bucket does not exist", func() {
+			Expect(db.PutVersion(target, version("v1"), accept)).To(Equal(meta.ErrBucketNotFound))
+			_, err := db.GetVersion(target, "v1")
+			Expect(err).To(Equal(meta.ErrBucketNotFound))
+			_, err = db.DeleteVersion(target, "v1")
+			Expect(err).To(Equal(meta.ErrBucketNotFound))
+		})
+
+		Context("when the bucket exists", func() {
+			BeforeEach(func() { must(db.CreateBucket("foo", meta.BucketData{})) })
+
+			It("returns a version not found error", func() {
+				_, err := db.GetVersion(target, "v1")
+				Expect(err).To(Equal(meta.ErrVersionNotFound))
+				_, err = db.DeleteVersion(target, "v1")
+				Expect(err).To(Equal(meta.ErrVersionNotFound))
+			})
+			It("keeps the versions it replaces", func() {
+				must(db.Put(target, version("")))
+				must(db.PutVersion(target, version("v1"), accept))
+				must(db.PutVersion(target, version("v2"), accept))
+				Expect(currentVersionID()).To(Equal("v2"))
+				Expect(versionIDs(target, "", "v1", "v2")).To(Equal([]string{"", "v1", "v2"}))
+				Expect(versionIDs(s3.NewResource("foo", "ba"), "", "v1", "v2")).To(BeEmpty())
+			})
+			It("replaces the null version", func() {
+				must(db.Put(target, version("")))
+				must(db.PutVersion(target, version("v1"), accept))
+				must(db.PutVersion(target, meta.ObjectData{Size: 1}, accept))
+				Expect(currentVersionID()).To(Equal(""))
+				Expect(versionIDs(target, "", "v1")).To(Equal([]string{"", "v1"}))
+				current, _ := db.Get(target)
+				Expect(current.Size).To(Equal(int64(1)))
+			})
+			It("does not write when the precondition fails", func() {
+				errRejected := errors.New("rejected")
+				must(db.PutVersion(target, version("v1"), accept))
+				Expect(db.PutVersion(target, version("v2"), func(current meta.ObjectData, found bool) error {
+					Expect(found).To(BeTrue())
+					Expect(current.VersionID).To(Equal("v1"))
+					return errRejected
+				})).To(Equal(errRejected))
+				Expect(versionIDs(target, "v1", "v2")).To(Equal([]string{"v1"}))
+			})
+			It("replaces versions in place", func() {
+				errRejected := errors.New("rejected")
+				must(db.PutVersion(target, version("v1"), accept))
+				must(db.PutVersion(target, version("v2"), accept))
+				for _, versionID := range []string{"v1", "v2"} {
+					replaced := version(versionID)
+					replaced.Size = 1
+					Expect(db.ReplaceVersion(target, replaced, func(current meta.ObjectData, found bool) error {
+						Expect(found).To(BeTrue())
+						Expect(current).To(Equal(version(versionID)))
+						return errRejected
+					})).To(Equal(errRejected))
+					Expect(db.GetVersion(target, versionID)).To(Equal(version(versionID)))
+					must(db.ReplaceVersion(target, replaced, accept))
+					Expect(db.GetVersion(target, versionID)).To(Equal(replaced))
+				}
+				Expect(currentVersionID()).To(Equal("v2"))
+				Expect(db.ReplaceVersion(target, version("v3"), accept)).To(Equal(meta.ErrVersionNotFound))
+				Expect(db.ReplaceVersion(s3.NewResource("bar", "baz"), version("v1"), accept)).To(Equal(meta.ErrBucketNotFound))
+			})
+			It("hides deleted objects behind delete markers", func() {
+				must(db.PutVersion(target, version("v1"), accept))
+				must(db.PutVersion(target, marker("m1"), accept))
+				Expect(currentVersionID()).To(Equal("none"))
+				Expect(db.GetVersion(target, "m1")).To(Equal(marker("m1")))
+				Expect(versionIDs(target, "v1", "m1")).To(Equal([]string{"v1", "m1"}))
+
+				keys := []string{}
+				Expect(db.ForEachInBucket("foo", "", func(key string, _ meta.LazyObject) (bool, error) {
+					keys = append(keys, key)
+					return true, nil
+				})).ToNot(HaveOccurred())
+				Expect(keys).To(BeEmpty())
+			})
+			It("restores the previous version when the newest is deleted", func() {
+				must(db.PutVersion(target, version("v1"), accept))
+				must(db.PutVersion(target, version("v2"), accept))
+				must(db.PutVersion(target, marker("m1"), accept))
+				must(db.PutVersion(target, marker("m2"), accept))
+
+				Expect(db.DeleteVersion(target, "m2")).To(Equal(marker("m2")))
+				Expect(currentVersionID()).To(Equal("none"))
+				Expect(db.DeleteVersion(target, "m1")).To(Equal(marker("m1")))
+				Expect(currentVersionID()).To(Equal("v2"))
+				Expect(db.DeleteVersion(target, "v2")).To(Equal(version("v2")))
+				Expect(currentVersionID()).To(Equal("v1"))
+				Expect(versionIDs(target, "v1", "v2", "m1", "m2")).To(Equal([]string{"v1"}))
+			})
+			It("keeps the current version when an older one is deleted", func() {
+				must(db.PutVersion(target, version("v1"), accept))
+				must(db.PutVersion(target, version("v2"), accept))
+				Expect(db.DeleteVersion(target, "v1")).To(Equal(version("v1")))
+				Expect(currentVersionID()).To(Equal("v2"))
+			})
+			It("iterates over versions by key then newest first", func() {
+				other := s3.NewResource("foo", "bar/baz")
+				must(db.PutVersion(s3.NewResource("foo", "ba"), version("a1"), accept))
+				must(db.PutVersion(target, version("v1"), accept))
+				must(db.PutVersion(other, version("o1"), accept))
+				must(db.PutVersion(target, version("v2"), accept))
+				must(db.PutVersion(other, marker("o2"), accept))
+				must(db.PutVersion(target, marker("v3"), accept))
+				must(db.PutVersion(target, version("v4"), accept))
+
+				listed := []string{}
+				forEach := func(key string, version meta.ObjectData, latest bool) (string, bool, error) {
+					if latest {
+						key += "*"
+					}
+					listed = append(listed, key+" "+version.VersionID)
+					return "", len(listed) < 5, nil
+				}
+				Expect(db.ForEachVersion("foo", "", forEach)).ToNot(HaveOccurred())
+				Expect(listed).To(Equal([]string{"ba* a1", "bar* v4", "bar v3", "bar v2", "bar v1"}))
+
+				listed = []string{}
+				Expect(db.ForEachVersion("foo", "bar/", forEach)).ToNot(HaveOccurred())
+				Expect(listed).To(Equal([]string{"bar/baz* o2", "bar/baz o1"}))
+				Expect(db.ForEachVersion("bar", "", forEach)).To(Equal(meta.ErrBucketNotFound))
+			})
+			It("seeks ahead past versions when asked to", func() {
+				must(db.PutVersion(target, version("v1"), accept))
+				must(db.PutVersion(target, version("v2"), accept))
+				must(db.PutVersion(s3.NewResource("foo", "bar/baz"), version("o1"), accept))
+				must(db.PutVersion(s3.NewResource("foo", "bar0"), version("z1"), accept))
+				must(db.PutVersion(s3.NewResource("foo", "bar0"), version("z2"), accept))
+
+				listed := []string{}
+				Expect(db.ForEachVersion("foo", "", func(key string, version meta.ObjectData, _ bool) (string, bool, error) {
+					listed = append(listed, key+" "+version.VersionID)
+					if key == "bar" {
+						return "bar0", true, nil
+					}
+					return "", true, nil
+				})).ToNot(HaveOccurred())
+				Expect(listed).To(Equal([]string{"bar v2", "bar0 z2", "bar0 z1"}))
+			})
+		})
+	})
+
+	Describe("Uploads", func() {
+		var target = s3.NewResource("foo", "bar")
+
+		Context("when bucket does not exist", func() {
+			It("returns a bucket not found error", func() {
+				Expect(db.CreateUpload(target, "upload1", meta.UploadData{})).
+					To(Equal(meta.ErrBucketNotFound))
+				_, err := db.GetUpload(target, "upload1")
+				Expect(err).To(Equal(meta.ErrBucketNotFound))
+			})
+		})
+		Context("when bucket exists but upload does not", func() {
+			BeforeEach(func() { must(db.CreateBucket("foo", meta.BucketData{})) })
+			It("returns an upload not found error", func() {
+				_, err := db.GetUpload(target, "upload1")
+				Expect(err).To(Equal(meta.ErrUploadNotFound))
+				Expect(db.PutPart(target, "upload1", 1, meta.PartData{})).
+					To(Equal(meta.ErrUploadNotFound))
+				Expect(db.DeleteUpload(target, "upload1")).
+					To(Equal(meta.ErrUploadNotFound))
+			})
+		})
+		Context("when upload exists", func() {
+			BeforeEach(func() {
+				must(db.CreateBucket("foo", meta.BucketData{}))
+				must(db.CreateUpload(target, "upload1", meta.UploadData{
+					Initiated: fixtures.UploadInitiated,
+					Object:    fixtures.UploadMetadata().Object,
+				}))
+			})
+			It("can add parts", func() {
+				for partNumber, part := range fixtures.UploadMetadata().Parts {
+					Expect(db.PutPart(target, "upload1", partNumber, part)).ToNot(HaveOccurred())
+				}
+				Expect(db.GetUpload(target, "upload1")).To(Equal(fixtures.UploadMetadata()))
+			})
+			It("is only found under the same key", func() {
+				_, err := db.GetUpload(s3.NewResource("foo", "baz"), "upload1")
+				Expect(err).To(Equal(meta.ErrUploadNotFound))
+			})
+			It("is not listed as an object", func() {
+				keys := []string{}
+				Expect(db.ForEachInBucket("foo", "", func(key string, _ meta.LazyObject) (bool, error) {
+					keys = append(keys, key)
+					return true, nil
+				})).ToNot(HaveOccurred())
+				Expect(keys).To(BeEmpty())
+			})
+			It("can be iterated over", func() {
+				must(db.CreateUpload(s3.NewResource("foo", "baa"), "upload2", meta.UploadData{}))
+				uploads := []string{}
+				Expect(db.ForEachUpload("foo", "", func(key, uploadID string, _ meta.UploadData) (bool, error) {
+					uploads = append(uploads, key+"/"+uploadID)
+					return true, nil
+				})).ToNot(HaveOccurred())
+				Expect(uploads).To(Equal([]string{"baa/upload2", "bar/upload1"}))
+			})
+			It("can be deleted", func() {
+				Expect(db.DeleteUpload(target, "upload1")).ToNot(HaveOccurred())
+				_, err := db.GetUpload(target, "upload1")
+				Expect(err).To(Equal(meta.ErrUploadNotFound))
+			})
+		})
+	})
 })
@@ -17,13 +17,28 @@ var MsgPack = msgpEncoding{}
 type bucketField uint8
 
 const (
-	bucketCreation bucketField = 1
+	bucketCreation   bucketField = 1
+	bucketPolicy                 = 2
+	bucketOwner                  = 3
+	bucketACL                    = 4
+	bucketVersioning             = 5
+	bucketLocation               = 6
 )
 
 func (e msgpEncoding) EncodeBucket(data meta.BucketData) (b []byte, err error) {
-	b = msgp.AppendMapHeader(nil, 1)
+	b = msgp.AppendMapHeader(nil, 6)
 	b = e.appendBucketField(b, bucketCreation)
 	b = e.appendTime(b, data.CreationDate)
+	b = e.appendBucketField(b, bucketPolicy)
+	b = msgp.AppendString(b, data.Policy)
+	b = e.appendBucketField(b, bucketOwner)
+	b = e.appendOwner(b, data.Owner)
+	b = e.appendBucketField(b, bucketACL)
+	b = e.appendGrants(b, data.ACL)
+	b = e.appendBucketField(b, bucketVersioning)
+	b = msgp.AppendString(b, data.Versioning)
+	b = e.appendBucketField(b, bucketLocation)
+	b = msgp.AppendString(b, data.Location)
 	return
 }
 
@@ -40,6 +55,16 @@ func (e msgpEncoding) DecodeBucket(b []byte) (data meta.BucketData, err error) {
 		switch field {
 		case bucketCreation:
 			data.CreationDate, b, err = e.readTime(b)
+		case bucketPolicy:
+			data.Policy, b, err = msgp.ReadStringBytes(b)
+		case bucketOwner:
+			data.Owner, b, err = e.readOwner(b)
+		case bucketACL:
+			data.ACL, b, err = e.readGrants(b)
+		case bucketVersioning:
+			data.Versioning, b, err = msgp.ReadStringBytes(b)
+		case bucketLocation:
+			data.Location, b, err = msgp.ReadStringBytes(b)
 		}
 		if err != nil {
 			return
@@ -51,17 +76,28 @@ func (e msgpEncoding) DecodeBucket(b []byte) (data meta.BucketData, err error) {
 type objectField uint8
 
 const (
-	objectContentMD5   objectField = 1
-	objectSize                     = 2
-	objectCacheControl             = 3
-	objectLastModified             = 4
-	objectContentType              = 5
-	objectVersionID                = 6
-	objectUserDefined              = 7
+	objectContentMD5         objectField = 1
+	objectSize                           = 2
+	objectCacheControl                   = 3
+	objectLastModified                   = 4
+	objectContentType                    = 5
+	objectVersionID                      = 6
+	objectUserDefined                    = 7
+	objectPartSizes                      = 8
+	objectContentDisposition             = 9
+	objectContentEncoding                = 10
+	objectContentLanguage                = 11
+	objectExpires                        = 12
+	objectTags                           = 13
+	objectChecksumAlgorithm              = 14
+	objectChecksum                       = 15
+	objectOwner                          = 16
+	objectACL                            = 17
+	objectDeleteMarker                   = 18
 )
 
 func (e msgpEncoding) EncodeObject(data meta.ObjectData) (b []byte, err error) {
-	b = msgp.AppendMapHeader(nil, 7)
+	b = msgp.AppendMapHeader(nil, 18)
 
 	b = e.appendObjectField(b, objectContentMD5)
 	md5, err := hex.DecodeString(data.ContentMD5)
@@ -86,14 +122,44 @@ func (e msgpEncoding) EncodeObject(data meta.ObjectData) (b []byte, err error) {
 	b = msgp.AppendString(b, data.VersionID)
 
 	b = e.appendObjectField(b, objectUserDefined)
-	b = msgp.AppendMapHeader(b, uint32(len(data.UserDefined)))
-	if data.UserDefined != nil {
-		for k, v := range data.UserDefined {
-			b = msgp.AppendString(b, k)
-			b = msgp.AppendString(b, v)
-		}
+	b = e.appendMapStrStr(b, data.UserDefined)
+
+	b = e.appendObjectField(b, objectPartSizes)
+	b = msgp.AppendArrayHeader(b, uint32(len(data.PartSizes)))
+	for _, size := range data.PartSizes {
+		b = msgp.AppendInt64(b, size)
 	}
 
+	b = e.appendObjectField(b, objectContentDisposition)
+	b = msgp.AppendString(b, data.ContentDisposition)
+
+	b = e.appendObjectField(b, objectContentEncoding)
+	b = msgp.AppendString(b, data.ContentEncoding)
+
+	b = e.appendObjectField(b, objectContentLanguage)
+	b = msgp.AppendString(b, data.ContentLanguage)
+
+	b = e.appendObjectField(b, objectExpires)
+	b = msgp.AppendString(b, data.Expires)
+
+	b = e.appendObjectField(b, objectTags)
+	b = e.appendMapStrStr(b, data.Tags)
+
+	b = e.appendObjectField(b, objectChecksumAlgorithm)
+	b = msgp.AppendString(b, data.ChecksumAlgorithm)
+
+	b = e.appendObjectField(b, objectChecksum)
+	b = msgp.AppendString(b, data.Checksum)
+
+	b = e.appendObjectField(b, objectOwner)
+	b = e.appendOwner(b, data.Owner)
+
+	b = e.appendObjectField(b, objectACL)
+	b = e.appendGrants(b, data.ACL)
+
+	b = e.appendObjectField(b, objectDeleteMarker)
+	b = msgp.AppendBool(b, data.DeleteMarker)
+
 	return
 }
 
@@ -125,6 +191,168 @@ func (e msgpEncoding) DecodeObject(b []byte) (data meta.ObjectData, err error) {
 			data.VersionID, b, err = msgp.ReadStringBytes(b)
 		case objectUserDefined:
 			data.UserDefined, b, err = e.readMapStrStr(b)
+		case objectPartSizes:
+			data.PartSizes, b, err = e.readInt64s(b)
+		case objectContentDisposition:
+			data.ContentDisposition, b, err = msgp.ReadStringBytes(b)
+		case objectContentEncoding:
+			data.ContentEncoding, b, err = msgp.ReadStringBytes(b)
+		case objectContentLanguage:
+			data.ContentLanguage, b, err = msgp.ReadStringBytes(b)
+		case objectExpires:
+			data.Expires, b, err = msgp.ReadStringBytes(b)
+		case objectTags:
+			data.Tags, b, err = e.readMapStrStr(b)
+		case objectChecksumAlgorithm:
+			data.ChecksumAlgorithm, b, err = msgp.ReadStringBytes(b)
+		case objectChecksum:
+			data.Checksum, b, err = msgp.ReadStringBytes(b)
+		case objectOwner:
+			data.Owner, b, err = e.readOwner(b)
+		case objectACL:
+			data.ACL, b, err = e.readGrants(b)
+		case objectDeleteMarker:
+			data.DeleteMarker, b, err = msgp.ReadBoolBytes(b)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+type uploadField uint8
+
+const (
+	uploadInitiated uploadField = 1
+	uploadObject                = 2
+	uploadParts                 = 3
+)
+
+type partField uint8
+
+const (
+	partContentMD5   partField = 1
+	partSize                   = 2
+	partLastModified           = 3
+	partChecksum               = 4
+)
+
+func (e msgpEncoding) EncodeUpload(data meta.UploadData) (b []byte, err error) {
+	b = msgp.AppendMapHeader(nil, 3)
+
+	b = e.appendUploadField(b, uploadInitiated)
+	b = e.appendTime(b, data.Initiated)
+
+	b = e.appendUploadField(b, uploadObject)
+	obj, err := e.EncodeObject(data.Object)
+	if err != nil {
+		return
+	}
+	b = msgp.AppendBytes(b, obj)
+
+	b = e.appendUploadField(b, uploadParts)
+	b = msgp.AppendMapHeader(b, uint32(len(data.Parts)))
+	for partNumber, part := range data.Parts {
+		b = msgp.AppendInt(b, partNumber)
+		if b, err = e.appendPart(b, part); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (e msgpEncoding) DecodeUpload(b []byte) (data meta.UploadData, err error) {
+	var sz, i uint32
+	if sz, b, err = msgp.ReadMapHeaderBytes(b); err != nil {
+		return
+	}
+	for i = 0; i < sz; i++ {
+		var field uploadField
+		if field, b, err = e.readUploadField(b); err != nil {
+			return
+		}
+		switch field {
+		case uploadInitiated:
+			data.Initiated, b, err = e.readTime(b)
+		case uploadObject:
+			var obj []byte
+			if obj, b, err = msgp.ReadBytesZC(b); err == nil {
+				data.Object, err = e.DecodeObject(obj)
+			}
+		case uploadParts:
+			data.Parts, b, err = e.readParts(b)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (e msgpEncoding) appendPart(b []byte, part meta.PartData) ([]byte, error) {
+	b = msgp.AppendMapHeader(b, 4)
+
+	b = e.appendPartField(b, partContentMD5)
+	md5, err := hex.DecodeString(part.ContentMD5)
+	if err != nil {
+		return b, err
+	}
+	b = msgp.AppendBytes(b, md5)
+
+	b = e.appendPartField(b, partSize)
+	b = msgp.AppendInt64(b, part.Size)
+
+	b = e.appendPartField(b, partLastModified)
+	b = e.appendTime(b, part.LastModified)
+
+	b = e.appendPartField(b, partChecksum)
+	b = msgp.AppendString(b, part.Checksum)
+	return b, nil
+}
+
+func (e msgpEncoding) readParts(in []byte) (parts map[int]meta.PartData, b []byte, err error) {
+	var sz, i uint32
+	if sz, b, err = msgp.ReadMapHeaderBytes(in); err != nil {
+		return
+	}
+	parts = make(map[int]meta.PartData, int(sz))
+	for i = 0; i < sz; i++ {
+		var partNumber int
+		if partNumber, b, err = msgp.ReadIntBytes(b); err != nil {
+			return
+		}
+		var part meta.PartData
+		if part, b, err = e.readPart(b); err != nil {
+			return
+		}
+		parts[partNumber] = part
+	}
+	return
+}
+
+func (e msgpEncoding) readPart(in []byte) (part meta.PartData, b []byte, err error) {
+	var sz, i uint32
+	if sz, b, err = msgp.ReadMapHeaderBytes(in); err != nil {
+		return
+	}
+	for i = 0; i < sz; i++ {
+		var field partField
+		if field, b, err = e.readPartField(b); err != nil {
+			return
+		}
+		switch field {
+		case partContentMD5:
+			var md5 []byte
+			if md5, b, err = msgp.ReadBytesBytes(b, nil); err == nil {
+				part.ContentMD5 = hex.EncodeToString(md5)
+			}
+		case partSize:
+			part.Size, b, err = msgp.ReadInt64Bytes(b)
+		case partLastModified:
+			part.LastModified, b, err = e.readTime(b)
+		case partChecksum:
+			part.Checksum, b, err = msgp.ReadStringBytes(b)
 		}
 		if err != nil {
 			return
@@ -133,11 +361,110 @@ func (e msgpEncoding) DecodeObject(b []byte) (data meta.ObjectData, err error) {
 	return
 }
 
+func (e msgpEncoding) readInt64s(in []byte) (s []int64, b []byte, err error) {
+	var sz, i uint32
+	if sz, b, err = msgp.ReadArrayHeaderBytes(in); err != nil {
+		return
+	}
+	if sz == 0 {
+		return
+	}
+	s = make([]int64, int(sz))
+	for i = 0; i < sz; i++ {
+		if s[i], b, err = msgp.ReadInt64Bytes(b); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (e msgpEncoding) appendOwner(b []byte, owner meta.Owner) []byte {
+	b = msgp.AppendArrayHeader(b, 2)
+	b = msgp.AppendString(b, owner.ID)
+	return msgp.AppendString(b, owner.DisplayName)
+}
+
+func (e msgpEncoding) readOwner(in []byte) (owner meta.Owner, b []byte, err error) {
+	var strs []string
+	if strs, b, err = e.readStrings(in, 2); err == nil {
+		owner.ID, owner.DisplayName = strs[0], strs[1]
+	}
+	return
+}
+
+// appendGrants encodes each grant as an array of its type, grantee,
+// display name and permission.
+func (e msgpEncoding) appendGrants(b []byte, grants []meta.Grant) []byte {
+	b = msgp.AppendArrayHeader(b, uint32(len(grants)))
+	for _, grant := range grants {
+		b = msgp.AppendArrayHeader(b, 4)
+		b = msgp.AppendString(b, grant.Type)
+		b = msgp.AppendString(b, grant.Grantee)
+		b = msgp.AppendString(b, grant.DisplayName)
+		b = msgp.AppendString(b, grant.Permission)
+	}
+	return b
+}
+
+func (e msgpEncoding) readGrants(in []byte) (grants []meta.Grant, b []byte, err error) {
+	var sz, i uint32
+	if sz, b, err = msgp.ReadArrayHeaderBytes(in); err != nil {
+		return
+	}
+	if sz == 0 {
+		return
+	}
+	grants = make([]meta.Grant, int(sz))
+	for i = 0; i < sz; i++ {
+		var strs []string
+		if strs, b, err = e.readStrings(b, 4); err != nil {
+			return
+		}
+		grants[i] = meta.Grant{
+			Type:        strs[0],
+			Grantee:     strs[1],
+			DisplayName: strs[2],
+			Permission:  strs[3],
+		}
+	}
+	return
+}
+
+// readStrings reads an array of exactly n strings.
+func (e msgpEncoding) readStrings(in []byte, n uint32) (strs []string, b []byte, err error) {
+	var sz, i uint32
+	if sz, b, err = msgp.ReadArrayHeaderBytes(in); err != nil {
+		return
+	}
+	if sz != n {
+		return nil, b, msgp.ArrayError{Wanted: n, Got: sz}
+	}
+	strs = make([]string, int(sz))
+	for i = 0; i < sz; i++ {
+		if strs[i], b, err = msgp.ReadStringBytes(b); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (e msgpEncoding) appendMapStrStr(b []byte, m map[string]string) []byte {
+	b = msgp.AppendMapHeader(b, uint32(len(m)))
+	for k, v := range m {
+		b = msgp.AppendString(b, k)
+		b = msgp.AppendString(b, v)
+	}
+	return b
+}
+
 func (e msgpEncoding) readMapStrStr(in []byte) (m map[string]string, b []byte, err error) {
 	var sz, i uint32
 	if sz, b, err = msgp.ReadMapHeaderBytes(in); err != nil {
 		return
 	}
+	if sz == 0 {
+		return
+	}
 	m = make(map[string]string, int(sz))
 	for i = 0; i < sz; i++ {
 		var k, v string
@@ -176,6 +503,30 @@ func (e msgpEncoding) readObjectField(b []byte) (objectField, []byte, error) {
 	return objectField(i), b, err
 }
 
+func (e msgpEncoding) appendUploadField(b []byte, field uploadField) []byte {
+	return msgp.AppendUint8(b, uint8(field))
+}
+
+func (e msgpEncoding) readUploadField(b []byte) (uploadField, []byte, error) {
+	i, b, err := msgp.ReadUint8Bytes(b)
+	if err != nil {
+		return 0, b, err
+	}
+	return uploadField(i), b, err
+}
+
+func (e msgpEncoding) appendPartField(b []byte, field partField) []byte {
+	return msgp.AppendUint8(b, uint8(field))
+}
+
+func (e msgpEncoding) readPartField(b []byte) (partField, []byte, error) {
+	i, b, err := msgp.ReadUint8Bytes(b)
+	if err != nil {
+		return 0, b, err
+	}
+	return partField(i), b, err
+}
+
 func (e msgpEncoding) appendTime(b []byte, t time.Time) []byte {
 	b, _ = msgp.AppendExtension(b, newTime(t))
 	return b
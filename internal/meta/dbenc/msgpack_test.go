@@ -4,6 +4,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/ophymx/s3d/internal/fixtures"
+	"github.com/ophymx/s3d/internal/meta"
 	"github.com/ophymx/s3d/internal/meta/dbenc"
 )
 
@@ -25,5 +26,21 @@ var _ = Describe("MsgPack", func() {
 
 			Expect(dbenc.MsgPack.DecodeObject(b)).To(Equal(fixtures.ObjectMetadata()))
 		})
+		It("can encode and decode delete markers", func() {
+			marker := meta.ObjectData{VersionID: fixtures.ObjectVersionID, LastModified: fixtures.ObjectLastModified, DeleteMarker: true}
+			b, err := dbenc.MsgPack.EncodeObject(marker)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(dbenc.MsgPack.DecodeObject(b)).To(Equal(marker))
+		})
+	})
+	Describe("Upload", func() {
+		It("can encode and decode upload meta data", func() {
+			b, err := dbenc.MsgPack.EncodeUpload(fixtures.UploadMetadata())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b).ToNot(BeEmpty())
+
+			Expect(dbenc.MsgPack.DecodeUpload(b)).To(Equal(fixtures.UploadMetadata()))
+		})
 	})
 })
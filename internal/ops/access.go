@@ -0,0 +1,208 @@
+package ops
+
+import (
+	"log"
+	"sync"
+
+	"github.com/ophymx/s3d/internal/meta"
+	"github.com/ophymx/s3d/internal/policy"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+// AccessRequest is a request to be authorized against the bucket, or the
+// object, it targets.
+type AccessRequest struct {
+	Bucket string
+	Key    string
+	// VersionID is the version of the object acted on, if not the current
+	// one.
+	VersionID string
+	// Authenticated is set when the request is signed by the credential
+	// with CanonicalID.
+	Authenticated bool
+	CanonicalID   string
+	// Policies are the identity policies of the credential. Without any,
+	// it has the full access of its account.
+	Policies []policy.Policy
+	policy.Request
+}
+
+// aclPermission is the ACL permission an action needs, granted on the
+// object when object is set and otherwise on the bucket.
+type aclPermission struct {
+	permission s3.Permission
+	object     bool
+}
+
+// aclPermissions lists the actions ACLs can grant. Any other action on a
+// bucket is only allowed to its owner.
+var aclPermissions = map[string]aclPermission{
+	"s3:ListBucket":                 {permission: s3.PermRead},
+	"s3:ListBucketMultipartUploads": {permission: s3.PermRead},
+	"s3:ListBucketVersions":         {permission: s3.PermRead},
+	"s3:GetBucketAcl":               {permission: s3.PermReadACP},
+	"s3:PutBucketAcl":               {permission: s3.PermWriteACP},
+	"s3:PutObject":                  {permission: s3.PermWrite},
+	"s3:DeleteObject":               {permission: s3.PermWrite},
+	"s3:DeleteObjectVersion":        {permission: s3.PermWrite},
+	"s3:AbortMultipartUpload":       {permission: s3.PermWrite},
+	"s3:ListMultipartUploadParts":   {permission: s3.PermWrite},
+	"s3:GetObject":                  {permission: s3.PermRead, object: true},
+	"s3:GetObjectVersion":           {permission: s3.PermRead, object: true},
+	"s3:GetObjectAcl":               {permission: s3.PermReadACP, object: true},
+	"s3:GetObjectVersionAcl":        {permission: s3.PermReadACP, object: true},
+	"s3:PutObjectAcl":               {permission: s3.PermWriteACP, object: true},
+	"s3:PutObjectVersionAcl":        {permission: s3.PermWriteACP, object: true},
+}
+
+// bucketPolicy is the parsed policy document of a bucket. Documents that
+// fail to parse are not valid.
+type bucketPolicy struct {
+	doc    string
+	policy policy.Policy
+	valid  bool
+}
+
+type accessOps struct {
+	db          meta.DB
+	enforceAuth bool
+	mutex       sync.Mutex
+	policies    map[string]bucketPolicy
+}
+
+// NewAccess returns AccessOperations that authorize requests against
+// identity policies, bucket policies, owners and ACLs. Credentials with
+// identity policies need one of them, or the bucket policy, to allow each
+// request. Anonymous requests are only allowed what a bucket grants them,
+// unless enforceAuth is unset and the bucket has no ACL, as is the case
+// for buckets created anonymously.
+func NewAccess(db meta.DB, enforceAuth bool) AccessOperations {
+	return &accessOps{db: db, enforceAuth: enforceAuth, policies: make(map[string]bucketPolicy)}
+}
+
+func (srv *accessOps) Authorize(req AccessRequest) s3.Response {
+	var bucket meta.BucketData
+	var found bool
+	if req.Bucket != "" {
+		var err error
+		bucket, err = srv.db.GetBucket(req.Bucket)
+		if err != nil && err != meta.ErrBucketNotFound {
+			return s3.InternalError(err)
+		}
+		found = err == nil
+	}
+
+	var effect policy.Effect
+	if p, found := srv.bucketPolicy(req.Bucket, bucket.Policy); found {
+		effect = p.Evaluate(req.Request)
+	}
+
+	identity := evaluate(req.Policies, req.Request)
+
+	switch {
+	case effect == policy.Deny, identity == policy.Deny:
+		return s3.AccessDenied("Access Denied")
+	case effect == policy.Allow:
+		return nil
+	case req.Policies != nil && identity != policy.Allow:
+		return s3.AccessDenied("Access Denied")
+	case found && req.Authenticated && req.Action == "s3:CreateBucket":
+		// Create answers whether the bucket already belongs to the caller.
+		return nil
+	case found:
+		allowed, err := srv.granted(req, bucket)
+		if err != nil {
+			return s3.InternalError(err)
+		}
+		if allowed || !req.Authenticated && !srv.enforceAuth && len(bucket.ACL) == 0 {
+			return nil
+		}
+		return s3.AccessDenied("Access Denied")
+	case req.Authenticated, !srv.enforceAuth:
+		return nil
+	default:
+		return s3.AccessDenied("Access Denied")
+	}
+}
+
+// bucketPolicy returns the policy of bucket given its document, which is
+// only parsed again once it changes. PutPolicy only stores valid policies,
+// so one that fails to parse is logged and treated as no policy at all.
+func (srv *accessOps) bucketPolicy(bucket, doc string) (policy.Policy, bool) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	if doc == "" {
+		delete(srv.policies, bucket)
+		return policy.Policy{}, false
+	}
+	cached, found := srv.policies[bucket]
+	if !found || cached.doc != doc {
+		cached = bucketPolicy{doc: doc}
+		p, err := policy.ParseBucketPolicy([]byte(doc), bucket)
+		if err != nil {
+			log.Printf("Ignoring invalid policy of bucket %s: %s", bucket, err)
+		} else {
+			cached.policy, cached.valid = p, true
+		}
+		srv.policies[bucket] = cached
+	}
+	return cached.policy, cached.valid
+}
+
+// evaluate returns Deny if any of policies denies req, otherwise Allow if
+// any allows it.
+func evaluate(policies []policy.Policy, req policy.Request) (effect policy.Effect) {
+	for _, p := range policies {
+		switch p.Evaluate(req) {
+		case policy.Deny:
+			return policy.Deny
+		case policy.Allow:
+			effect = policy.Allow
+		}
+	}
+	return
+}
+
+// granted reports whether the caller owns, or an ACL grants them, what req
+// acts on in bucket. Owners have full control, and the owner of a bucket
+// also has full control of its objects. Requests for a version of an
+// object are granted by that version, and delete markers grant nothing.
+func (srv *accessOps) granted(req AccessRequest, bucket meta.BucketData) (bool, error) {
+	if srv.owns(req, bucket.Owner) {
+		return true, nil
+	}
+	acl, found := aclPermissions[req.Action]
+	if !found {
+		return false, nil
+	}
+	if !acl.object || req.Key == "" {
+		return granted(bucket.ACL, req.CanonicalID, req.Authenticated, acl.permission), nil
+	}
+
+	obj, err := srv.object(req)
+	if err == meta.ErrKeyNotFound || err == meta.ErrVersionNotFound || obj.DeleteMarker {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return srv.owns(req, obj.Owner) || granted(obj.ACL, req.CanonicalID, req.Authenticated, acl.permission), nil
+}
+
+// object fetches the version of the object req acts on.
+func (srv *accessOps) object(req AccessRequest) (meta.ObjectData, error) {
+	resource := s3.NewResource(req.Bucket, req.Key)
+	switch req.VersionID {
+	case "":
+		return srv.db.Get(resource)
+	case "null":
+		return srv.db.GetVersion(resource, "")
+	default:
+		return srv.db.GetVersion(resource, req.VersionID)
+	}
+}
+
+// owns reports whether the caller is owner. Anything created anonymously
+// has no owner and is treated as belonging to every credential.
+func (srv *accessOps) owns(req AccessRequest, owner meta.Owner) bool {
+	return req.Authenticated && (owner.ID == "" || owner.ID == req.CanonicalID)
+}
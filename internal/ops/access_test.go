@@ -0,0 +1,211 @@
+package ops_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/ophymx/s3d/internal/fakes"
+	"github.com/ophymx/s3d/internal/fixtures"
+	"github.com/ophymx/s3d/internal/meta"
+	"github.com/ophymx/s3d/internal/ops"
+	"github.com/ophymx/s3d/internal/policy"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+var _ = Describe("Access", func() {
+	var db *fakes.DB
+	BeforeEach(func() {
+		db = fakes.NewDB()
+		db.Buckets["foo"] = fakes.NewBucket(meta.BucketData{CreationDate: fixtures.Time1, Policy: `{
+			"Statement": [
+				{"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::foo/public/*"},
+				{"Effect": "Deny", "Principal": {"AWS": "AKIAREADER"}, "Action": "s3:PutObject", "Resource": "arn:aws:s3:::foo/*"}
+			]
+		}`})
+		db.Buckets["bar"] = fakes.NewBucket(meta.BucketData{CreationDate: fixtures.Time1})
+	})
+	request := func(bucket, principal, action, key string) ops.AccessRequest {
+		req := ops.AccessRequest{
+			Bucket:  bucket,
+			Request: policy.Request{Action: action, Resource: "arn:aws:s3:::" + bucket + "/" + key},
+		}
+		if principal != "" {
+			req.Authenticated = true
+			req.Principals = []string{principal}
+		}
+		return req
+	}
+	accessDenied := s3.AccessDenied("Access Denied")
+
+	Context("when authentication is not enforced", func() {
+		var srv ops.AccessOperations
+		BeforeEach(func() { srv = ops.NewAccess(db, false) })
+
+		It("allows requests that are not denied", func() {
+			Expect(srv.Authorize(request("foo", "", "s3:PutObject", "a.txt"))).To(BeNil())
+			Expect(srv.Authorize(request("foo", "AKIAWRITER", "s3:PutObject", "a.txt"))).To(BeNil())
+			Expect(srv.Authorize(request("bar", "", "s3:GetObject", "a.txt"))).To(BeNil())
+		})
+		It("denies what the bucket policy denies", func() {
+			Expect(srv.Authorize(request("foo", "AKIAREADER", "s3:PutObject", "a.txt"))).To(Equal(accessDenied))
+		})
+	})
+
+	Context("when authentication is enforced", func() {
+		var srv ops.AccessOperations
+		BeforeEach(func() { srv = ops.NewAccess(db, true) })
+
+		It("allows anonymous requests the bucket policy allows", func() {
+			Expect(srv.Authorize(request("foo", "", "s3:GetObject", "public/a.txt"))).To(BeNil())
+		})
+		It("denies other anonymous requests", func() {
+			Expect(srv.Authorize(request("foo", "", "s3:GetObject", "private/a.txt"))).To(Equal(accessDenied))
+			Expect(srv.Authorize(request("bar", "", "s3:GetObject", "a.txt"))).To(Equal(accessDenied))
+			Expect(srv.Authorize(request("missing", "", "s3:GetObject", "a.txt"))).To(Equal(accessDenied))
+			Expect(srv.Authorize(ops.AccessRequest{Request: policy.Request{Action: "s3:ListAllMyBuckets"}})).To(Equal(accessDenied))
+		})
+		It("allows authenticated requests that are not denied", func() {
+			Expect(srv.Authorize(request("bar", "AKIAWRITER", "s3:PutObject", "a.txt"))).To(BeNil())
+			Expect(srv.Authorize(request("foo", "AKIAREADER", "s3:PutObject", "a.txt"))).To(Equal(accessDenied))
+		})
+		It("applies the bucket policy as it changes", func() {
+			Expect(srv.Authorize(request("foo", "", "s3:GetObject", "public/a.txt"))).To(BeNil())
+			db.Buckets["foo"].Meta.Policy = `{"Statement": {"Effect": "Allow", "Principal": "*", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::foo/private/*"}}`
+			Expect(srv.Authorize(request("foo", "", "s3:GetObject", "public/a.txt"))).To(Equal(accessDenied))
+			Expect(srv.Authorize(request("foo", "", "s3:GetObject", "private/a.txt"))).To(BeNil())
+			db.Buckets["foo"].Meta.Policy = ""
+			Expect(srv.Authorize(request("foo", "", "s3:GetObject", "private/a.txt"))).To(Equal(accessDenied))
+		})
+		It("treats a bucket policy that fails to parse as no policy", func() {
+			db.Buckets["bar"].Meta.Policy = `{"Statement": [`
+			Expect(srv.Authorize(request("bar", "", "s3:GetObject", "a.txt"))).To(Equal(accessDenied))
+			Expect(srv.Authorize(request("bar", "AKIAWRITER", "s3:PutObject", "a.txt"))).To(BeNil())
+		})
+	})
+
+	Context("with owned buckets and objects", func() {
+		var srv ops.AccessOperations
+		owner := meta.Owner{ID: "owner-id", DisplayName: "Owner"}
+		caller := func(bucket, canonicalID, action, key string) ops.AccessRequest {
+			req := request(bucket, "", action, key)
+			req.Key = key
+			if canonicalID != "" {
+				req.Authenticated = true
+				req.CanonicalID = canonicalID
+				req.Principals = []string{canonicalID}
+			}
+			return req
+		}
+		BeforeEach(func() {
+			srv = ops.NewAccess(db, false)
+			db.Buckets["owned"] = fakes.NewBucket(meta.BucketData{
+				CreationDate: fixtures.Time1,
+				Owner:        owner,
+				ACL: []meta.Grant{
+					{Type: "CanonicalUser", Grantee: owner.ID, Permission: "FULL_CONTROL"},
+					{Type: "CanonicalUser", Grantee: "writer-id", Permission: "WRITE"},
+					{Type: "Group", Grantee: s3.AuthenticatedUsersGroup, Permission: "READ"},
+				},
+			})
+			db.Buckets["owned"].Objects["public.txt"] = meta.ObjectData{
+				Owner: meta.Owner{ID: "writer-id"},
+				ACL:   []meta.Grant{{Type: "Group", Grantee: s3.AllUsersGroup, Permission: "READ"}},
+			}
+			db.Buckets["owned"].Objects["private.txt"] = meta.ObjectData{Owner: owner}
+		})
+
+		It("allows owners everything", func() {
+			Expect(srv.Authorize(caller("owned", owner.ID, "s3:DeleteBucket", ""))).To(BeNil())
+			Expect(srv.Authorize(caller("owned", owner.ID, "s3:PutBucketAcl", ""))).To(BeNil())
+			Expect(srv.Authorize(caller("owned", owner.ID, "s3:GetObject", "public.txt"))).To(BeNil())
+			Expect(srv.Authorize(caller("owned", "writer-id", "s3:PutObjectAcl", "public.txt"))).To(BeNil())
+		})
+		It("allows what ACLs grant other credentials", func() {
+			Expect(srv.Authorize(caller("owned", "writer-id", "s3:PutObject", "new.txt"))).To(BeNil())
+			Expect(srv.Authorize(caller("owned", "reader-id", "s3:ListBucket", ""))).To(BeNil())
+			Expect(srv.Authorize(caller("owned", "reader-id", "s3:GetObject", "public.txt"))).To(BeNil())
+		})
+		It("denies other credentials everything else", func() {
+			Expect(srv.Authorize(caller("owned", "reader-id", "s3:PutObject", "new.txt"))).To(Equal(accessDenied))
+			Expect(srv.Authorize(caller("owned", "reader-id", "s3:GetObject", "private.txt"))).To(Equal(accessDenied))
+			Expect(srv.Authorize(caller("owned", "writer-id", "s3:GetBucketAcl", ""))).To(Equal(accessDenied))
+			Expect(srv.Authorize(caller("owned", "writer-id", "s3:DeleteBucket", ""))).To(Equal(accessDenied))
+		})
+		It("leaves creating an existing bucket to answer other credentials", func() {
+			Expect(srv.Authorize(caller("owned", "reader-id", "s3:CreateBucket", ""))).To(BeNil())
+		})
+		It("checks the ACL of the version requested", func() {
+			public := meta.ObjectData{VersionID: "v1", Owner: meta.Owner{ID: "writer-id"}, ACL: []meta.Grant{{Type: "Group", Grantee: s3.AllUsersGroup, Permission: "READ"}}}
+			db.Buckets["owned"].Objects["private.txt"] = meta.ObjectData{VersionID: "v2", Owner: owner}
+			db.Buckets["owned"].Versions["private.txt"] = []meta.ObjectData{public}
+			db.Buckets["owned"].Versions["deleted.txt"] = []meta.ObjectData{{VersionID: "m1", DeleteMarker: true}, public}
+			version := func(canonicalID, action, key, versionID string) ops.AccessRequest {
+				req := caller("owned", canonicalID, action, key)
+				req.VersionID = versionID
+				return req
+			}
+
+			Expect(srv.Authorize(version("reader-id", "s3:GetObjectVersion", "private.txt", "v1"))).To(BeNil())
+			Expect(srv.Authorize(version("reader-id", "s3:GetObjectVersion", "private.txt", "v2"))).To(Equal(accessDenied))
+			Expect(srv.Authorize(version("reader-id", "s3:GetObjectVersionAcl", "private.txt", "v1"))).To(Equal(accessDenied))
+			Expect(srv.Authorize(version("writer-id", "s3:PutObjectVersionAcl", "private.txt", "v1"))).To(BeNil())
+			Expect(srv.Authorize(version("writer-id", "s3:PutObjectVersionAcl", "private.txt", "v2"))).To(Equal(accessDenied))
+
+			Expect(srv.Authorize(version("reader-id", "s3:GetObject", "deleted.txt", ""))).To(Equal(accessDenied))
+			Expect(srv.Authorize(version("reader-id", "s3:GetObjectVersion", "deleted.txt", "v1"))).To(BeNil())
+			Expect(srv.Authorize(version("reader-id", "s3:GetObjectVersion", "deleted.txt", "m1"))).To(Equal(accessDenied))
+			Expect(srv.Authorize(version("reader-id", "s3:GetObjectVersion", "deleted.txt", "v9"))).To(Equal(accessDenied))
+		})
+		It("allows credentials everything on unowned buckets", func() {
+			Expect(srv.Authorize(caller("bar", "reader-id", "s3:DeleteBucket", ""))).To(BeNil())
+		})
+		Context("and credentials with identity policies", func() {
+			readOnly, err := policy.ParseIdentityPolicy([]byte(`{"Statement": [
+				{"Effect": "Allow", "Action": ["s3:GetObject", "s3:ListBucket"], "Resource": "*"},
+				{"Effect": "Deny", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::owned/secret/*"}
+			]}`))
+			if err != nil {
+				panic(err)
+			}
+			user := func(bucket, action, key string) ops.AccessRequest {
+				req := caller(bucket, owner.ID, action, key)
+				req.Policies = []policy.Policy{readOnly}
+				return req
+			}
+
+			It("allows what the policies allow", func() {
+				Expect(srv.Authorize(user("owned", "s3:ListBucket", ""))).To(BeNil())
+				Expect(srv.Authorize(user("owned", "s3:GetObject", "private.txt"))).To(BeNil())
+			})
+			It("denies what the policies deny or do not allow", func() {
+				Expect(srv.Authorize(user("owned", "s3:GetObject", "secret/a.txt"))).To(Equal(accessDenied))
+				Expect(srv.Authorize(user("owned", "s3:PutObject", "new.txt"))).To(Equal(accessDenied))
+				Expect(srv.Authorize(user("missing", "s3:CreateBucket", ""))).To(Equal(accessDenied))
+			})
+			It("still needs other accounts to grant access to what they own", func() {
+				db.Buckets["owned"].Meta.Owner = meta.Owner{ID: "other-id"}
+				db.Buckets["owned"].Objects["other.txt"] = meta.ObjectData{Owner: meta.Owner{ID: "other-id"}}
+				Expect(srv.Authorize(user("owned", "s3:GetObject", "other.txt"))).To(Equal(accessDenied))
+				Expect(srv.Authorize(user("owned", "s3:ListBucket", ""))).To(BeNil())
+			})
+			It("allows what the bucket policy allows", func() {
+				db.Buckets["owned"].Meta.Policy = `{"Statement": {"Effect": "Allow", "Principal": {"AWS": "owner-id"}, "Action": "s3:PutObject", "Resource": "arn:aws:s3:::owned/*"}}`
+				Expect(srv.Authorize(user("owned", "s3:PutObject", "new.txt"))).To(BeNil())
+			})
+		})
+		It("only allows anonymous requests what the bucket ACL grants", func() {
+			for _, enforceAuth := range []bool{false, true} {
+				srv = ops.NewAccess(db, enforceAuth)
+				Expect(srv.Authorize(caller("owned", "", "s3:GetObject", "public.txt"))).To(BeNil())
+				Expect(srv.Authorize(caller("owned", "", "s3:GetObject", "private.txt"))).To(Equal(accessDenied))
+				Expect(srv.Authorize(caller("owned", "", "s3:ListBucket", ""))).To(Equal(accessDenied))
+			}
+		})
+		It("only limits anonymous requests to buckets without an ACL when authentication is enforced", func() {
+			db.Buckets["anonymous"] = fakes.NewBucket(meta.BucketData{CreationDate: fixtures.Time1})
+			Expect(srv.Authorize(caller("anonymous", "", "s3:PutObject", "new.txt"))).To(BeNil())
+
+			srv = ops.NewAccess(db, true)
+			Expect(srv.Authorize(caller("anonymous", "", "s3:PutObject", "new.txt"))).To(Equal(accessDenied))
+		})
+	})
+})
@@ -0,0 +1,362 @@
+package ops
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ophymx/s3d/internal/meta"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+// maxACLSize limits the size of an access control policy document.
+const maxACLSize = 64 * 1024
+
+// ACL is the access control a client asks for with the x-amz-acl or
+// x-amz-grant-* headers.
+type ACL struct {
+	Canned string
+	// Grants holds the x-amz-grant-* header values by the permission they
+	// grant.
+	Grants map[s3.Permission]string
+}
+
+// Ownership is who creates a bucket or object and the ACL they give it.
+type Ownership struct {
+	Owner s3.OwnerResult
+	ACL   ACL
+}
+
+func (ownership Ownership) owner() meta.Owner {
+	return meta.Owner{ID: ownership.Owner.ID, DisplayName: ownership.Owner.DisplayName}
+}
+
+func ownerResult(owner meta.Owner) s3.OwnerResult {
+	return s3.OwnerResult{ID: owner.ID, DisplayName: owner.DisplayName}
+}
+
+// grantHeaders names the x-amz-grant-* header of each permission.
+var grantHeaders = map[s3.Permission]string{
+	s3.PermRead:     s3.AmzGrantRead,
+	s3.PermWrite:    s3.AmzGrantWrite,
+	s3.PermReadACP:  s3.AmzGrantReadACP,
+	s3.PermWriteACP: s3.AmzGrantWriteACP,
+	s3.PermFull:     s3.AmzGrantFullControl,
+}
+
+// cannedACLs give the grants, besides full control for the owner, of each
+// x-amz-acl value.
+var cannedACLs = map[string]func(bucketOwner meta.Owner) []meta.Grant{
+	"private":                   noGrants,
+	"aws-exec-read":             noGrants,
+	"public-read":               groupGrants(s3.AllUsersGroup, s3.PermRead),
+	"public-read-write":         groupGrants(s3.AllUsersGroup, s3.PermRead, s3.PermWrite),
+	"authenticated-read":        groupGrants(s3.AuthenticatedUsersGroup, s3.PermRead),
+	"log-delivery-write":        groupGrants(s3.LogDeliveryGroup, s3.PermWrite, s3.PermReadACP),
+	"bucket-owner-read":         bucketOwnerGrant(s3.PermRead),
+	"bucket-owner-full-control": bucketOwnerGrant(s3.PermFull),
+}
+
+func noGrants(meta.Owner) []meta.Grant {
+	return nil
+}
+
+func groupGrants(uri string, permissions ...s3.Permission) func(meta.Owner) []meta.Grant {
+	return func(meta.Owner) (grants []meta.Grant) {
+		for _, permission := range permissions {
+			grants = append(grants, meta.Grant{Type: s3.GrantGroup, Grantee: uri, Permission: string(permission)})
+		}
+		return
+	}
+}
+
+func bucketOwnerGrant(permission s3.Permission) func(meta.Owner) []meta.Grant {
+	return func(bucketOwner meta.Owner) []meta.Grant {
+		if bucketOwner.ID == "" {
+			return nil
+		}
+		return []meta.Grant{userGrant(bucketOwner, permission)}
+	}
+}
+
+func userGrant(owner meta.Owner, permission s3.Permission) meta.Grant {
+	return meta.Grant{
+		Type:        string(s3.GrantUser),
+		Grantee:     owner.ID,
+		DisplayName: owner.DisplayName,
+		Permission:  string(permission),
+	}
+}
+
+func (acl ACL) empty() bool {
+	return acl.Canned == "" && len(acl.Grants) == 0
+}
+
+// grants returns the grants acl gives on something owned by owner in a
+// bucket owned by bucketOwner. Without any ACL headers the owner is given
+// full control, as with the private canned ACL.
+func (acl ACL) grants(owner, bucketOwner meta.Owner) ([]meta.Grant, s3.Response) {
+	if acl.Canned != "" && len(acl.Grants) > 0 {
+		return nil, s3.InvalidRequest("Specifying both Canned ACLs and Header Grants is not allowed")
+	}
+	if len(acl.Grants) > 0 {
+		return headerGrants(acl.Grants)
+	}
+
+	canned := acl.Canned
+	if canned == "" {
+		canned = "private"
+	}
+	cannedGrants, found := cannedACLs[canned]
+	if !found {
+		return nil, s3.InvalidArgument("", s3.AmzACL, canned)
+	}
+	var grants []meta.Grant
+	if owner.ID != "" {
+		grants = append(grants, userGrant(owner, s3.PermFull))
+	}
+	for _, grant := range cannedGrants(bucketOwner) {
+		if grant.Type != string(s3.GrantUser) || grant.Grantee != owner.ID {
+			grants = append(grants, grant)
+		}
+	}
+	return grants, nil
+}
+
+// headerGrants parses x-amz-grant-* headers, each a comma separated list
+// of grantees such as id="...", uri="..." or emailAddress="...".
+func headerGrants(headers map[s3.Permission]string) (grants []meta.Grant, resp s3.Response) {
+	for _, permission := range []s3.Permission{s3.PermRead, s3.PermWrite, s3.PermReadACP, s3.PermWriteACP, s3.PermFull} {
+		value, found := headers[permission]
+		if !found {
+			continue
+		}
+		for _, grantee := range strings.Split(value, ",") {
+			i := strings.IndexByte(grantee, '=')
+			if i < 0 {
+				return nil, s3.InvalidArgument("Argument format not recognized", grantHeaders[permission], value)
+			}
+			kind := strings.TrimSpace(grantee[:i])
+			id := strings.Trim(strings.TrimSpace(grantee[i+1:]), `"`)
+			grant := meta.Grant{Grantee: id, Permission: string(permission)}
+			switch strings.ToLower(kind) {
+			case "id":
+				grant.Type = string(s3.GrantUser)
+			case "uri":
+				grant.Type = s3.GrantGroup
+			case "emailaddress":
+				grant.Type = s3.GrantEmail
+			default:
+				return nil, s3.InvalidArgument("Argument format not recognized", grantHeaders[permission], value)
+			}
+			if resp = validateGrant(grant); resp != nil {
+				return nil, resp
+			}
+			grants = append(grants, grant)
+		}
+	}
+	return grants, nil
+}
+
+// policyGrants reads the grants of an AccessControlPolicy document.
+func policyGrants(body io.Reader) (grants []meta.Grant, resp s3.Response) {
+	doc, err := ioutil.ReadAll(io.LimitReader(body, maxACLSize+1))
+	if err != nil {
+		return nil, s3.InternalError(err)
+	}
+	if len(doc) == 0 {
+		return nil, s3.MissingSecurityHeader("Your request was missing a required header")
+	}
+	var policy s3.AccessControlPolicy
+	if len(doc) > maxACLSize || xml.Unmarshal(doc, &policy) != nil {
+		return nil, s3.MalformedACLError("The XML you provided was not well-formed or did not validate against our published schema")
+	}
+	for _, g := range policy.AccessControlList {
+		grant := meta.Grant{
+			Type:        string(g.Grantee.Type),
+			DisplayName: g.Grantee.DisplayName,
+			Permission:  string(g.Permission),
+		}
+		switch grant.Type {
+		case string(s3.GrantUser):
+			grant.Grantee = g.Grantee.ID
+		case s3.GrantGroup:
+			grant.Grantee, grant.DisplayName = g.Grantee.URI, ""
+		case s3.GrantEmail:
+			grant.Grantee = g.Grantee.EmailAddress
+		}
+		if resp = validateGrant(grant); resp != nil {
+			return nil, resp
+		}
+		grants = append(grants, grant)
+	}
+	return grants, nil
+}
+
+func validateGrant(grant meta.Grant) s3.Response {
+	if _, found := grantHeaders[s3.Permission(grant.Permission)]; !found {
+		return s3.MalformedACLError("The XML you provided was not well-formed or did not validate against our published schema")
+	}
+	switch grant.Type {
+	case string(s3.GrantUser):
+		if grant.Grantee == "" {
+			return s3.InvalidArgument("Invalid id", "CanonicalUser/ID", grant.Grantee)
+		}
+	case s3.GrantGroup:
+		switch grant.Grantee {
+		case s3.AllUsersGroup, s3.AuthenticatedUsersGroup, s3.LogDeliveryGroup:
+		default:
+			return s3.InvalidArgument("Invalid group uri", "uri", grant.Grantee)
+		}
+	case s3.GrantEmail:
+		// There are no email addresses on record to resolve grantees by.
+		return s3.UnresolvableGrantByEmailAddress("The e-mail address you provided does not match any account on record.")
+	default:
+		return s3.MalformedACLError("The XML you provided was not well-formed or did not validate against our published schema")
+	}
+	return nil
+}
+
+// newACL reads the grants of a PutBucketAcl or PutObjectAcl request from
+// either its headers or its body.
+func newACL(acl ACL, body io.Reader, owner, bucketOwner meta.Owner) ([]meta.Grant, s3.Response) {
+	if acl.empty() {
+		return policyGrants(body)
+	}
+	if n, _ := body.Read(make([]byte, 1)); n > 0 {
+		return nil, s3.UnexpectedContent("This request does not support content")
+	}
+	return acl.grants(owner, bucketOwner)
+}
+
+func accessControlPolicy(owner meta.Owner, grants []meta.Grant) s3.AccessControlPolicy {
+	policy := s3.AccessControlPolicy{
+		Owner:             ownerResult(owner),
+		AccessControlList: make([]s3.Grant, 0, len(grants)),
+	}
+	for _, grant := range grants {
+		permission := s3.Permission(grant.Permission)
+		switch grant.Type {
+		case s3.GrantGroup:
+			policy.AccessControlList = append(policy.AccessControlList, s3.NewGroupGrant(grant.Grantee, permission))
+		case s3.GrantEmail:
+			policy.AccessControlList = append(policy.AccessControlList, s3.NewEmailGrant(grant.Grantee, permission))
+		default:
+			policy.AccessControlList = append(policy.AccessControlList, s3.NewUserGrant(grant.Grantee, grant.DisplayName, permission))
+		}
+	}
+	return policy
+}
+
+// granted reports whether grants give permission to a caller, identified
+// by canonicalID when authenticated.
+func granted(grants []meta.Grant, canonicalID string, authenticated bool, permission s3.Permission) bool {
+	for _, grant := range grants {
+		if grant.Permission != string(permission) && grant.Permission != s3.PermFull {
+			continue
+		}
+		switch {
+		case grant.Type == s3.GrantGroup && grant.Grantee == s3.AllUsersGroup,
+			grant.Type == s3.GrantGroup && grant.Grantee == s3.AuthenticatedUsersGroup && authenticated,
+			grant.Type == string(s3.GrantUser) && grant.Grantee == canonicalID && authenticated:
+			return true
+		}
+	}
+	return false
+}
+
+func (srv bucketOps) GetACL(bucket string) s3.Response {
+	data, err := srv.db.GetBucket(bucket)
+	if err == meta.ErrBucketNotFound {
+		return s3.NoSuchBucket(bucket)
+	} else if err != nil {
+		return s3.InternalError(err)
+	}
+	return accessControlPolicy(data.Owner, data.ACL)
+}
+
+func (srv bucketOps) PutACL(bucket string, acl ACL, body io.Reader) s3.Response {
+	data, err := srv.db.GetBucket(bucket)
+	if err == meta.ErrBucketNotFound {
+		return s3.NoSuchBucket(bucket)
+	} else if err != nil {
+		return s3.InternalError(err)
+	}
+	var resp s3.Response
+	if data.ACL, resp = newACL(acl, body, data.Owner, data.Owner); resp != nil {
+		return resp
+	}
+	if err = srv.db.PutBucket(bucket, data); err != nil {
+		return s3.InternalError(err)
+	}
+	return s3.OK()
+}
+
+func (srv objectOps) GetACL(resource s3.Resource, versionID string) s3.Response {
+	data, resp := srv.aclVersion(resource, versionID)
+	if resp != nil {
+		return resp
+	}
+	return accessControlPolicy(data.Owner, data.ACL)
+}
+
+func (srv objectOps) PutACL(resource s3.Resource, versionID string, acl ACL, body io.Reader) s3.Response {
+	bucket, err := srv.db.GetBucket(resource.Bucket())
+	if err != nil {
+		return objectError(resource, err)
+	}
+	data, resp := srv.aclVersion(resource, versionID)
+	if resp != nil {
+		return resp
+	}
+	if data.ACL, resp = newACL(acl, body, data.Owner, bucket.Owner); resp != nil {
+		return resp
+	}
+	precondition := func(current meta.ObjectData, found bool) error {
+		if !found {
+			return meta.ErrKeyNotFound
+		}
+		if current.ContentMD5 != data.ContentMD5 || !current.LastModified.Equal(data.LastModified) {
+			return errConditionConflict
+		}
+		return nil
+	}
+	if versionID == "" {
+		err = srv.db.PutIf(resource, data, precondition)
+	} else {
+		err = srv.db.ReplaceVersion(resource, data, precondition)
+	}
+	switch err {
+	case nil:
+		return s3.OK()
+	case errConditionConflict:
+		return s3.ConditionalRequestConflict("A conflicting conditional operation is currently in progress against this resource. Please try again.")
+	case meta.ErrVersionNotFound:
+		return s3.NoSuchVersion("The specified version does not exist.")
+	default:
+		return objectError(resource, err)
+	}
+}
+
+// aclVersion fetches the version of resource whose ACL is read or written.
+// Delete markers have no ACL.
+func (srv objectOps) aclVersion(resource s3.Resource, versionID string) (meta.ObjectData, s3.Response) {
+	data, resp := srv.version(resource, versionID)
+	if resp == nil && data.DeleteMarker {
+		resp = s3.MethodNotAllowed("The specified method is not allowed against this resource.")
+	}
+	return data, resp
+}
+
+// objectACL returns the grants ownership gives a new object in the bucket
+// of resource.
+func (srv objectOps) objectACL(resource s3.Resource, ownership Ownership) ([]meta.Grant, s3.Response) {
+	bucket, err := srv.db.GetBucket(resource.Bucket())
+	if err == meta.ErrBucketNotFound {
+		return nil, s3.NoSuchBucket(resource.Bucket())
+	} else if err != nil {
+		return nil, s3.InternalError(err)
+	}
+	return ownership.ACL.grants(ownership.owner(), bucket.Owner)
+}
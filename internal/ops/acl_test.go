@@ -0,0 +1,200 @@
+package ops_test
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/ophymx/s3d/internal/fakes"
+	"github.com/ophymx/s3d/internal/fixtures"
+	"github.com/ophymx/s3d/internal/meta"
+	"github.com/ophymx/s3d/internal/ops"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+var _ = Describe("ACLs", func() {
+	var (
+		db      *fakes.DB
+		store   *fakes.Store
+		buckets ops.BucketOperations
+		objects ops.ObjectOperations
+	)
+	owner := s3.OwnerResult{ID: fixtures.OwnerID, DisplayName: fixtures.OwnerDisplayName}
+	other := meta.Owner{ID: "0123456789abcdef", DisplayName: "Other"}
+	allUsers := func(permission string) meta.Grant {
+		return meta.Grant{Type: "Group", Grantee: s3.AllUsersGroup, Permission: permission}
+	}
+	resource := s3.NewResource("foo", "bar.txt")
+
+	BeforeEach(func() {
+		db = fakes.NewDB()
+		store = fakes.NewStore()
+		clock := fakes.NewClock(fixtures.Time1)
+		buckets = ops.NewBucket(db, store, clock)
+		objects = ops.NewObject(db, store, clock)
+	})
+
+	Describe("Create", func() {
+		It("gives the owner full control by default", func() {
+			Expect(buckets.Create("foo", ops.Ownership{Owner: owner}, nil)).To(Equal(s3.NoContent()))
+			Expect(db.Buckets["foo"].Meta.Owner).To(Equal(fixtures.Owner()))
+			Expect(db.Buckets["foo"].Meta.ACL).To(Equal([]meta.Grant{fixtures.OwnerGrant()}))
+		})
+		It("records no owner or grants for anonymous buckets", func() {
+			Expect(buckets.Create("foo", ops.Ownership{}, nil)).To(Equal(s3.NoContent()))
+			Expect(db.Buckets["foo"].Meta.Owner).To(Equal(meta.Owner{}))
+			Expect(db.Buckets["foo"].Meta.ACL).To(BeEmpty())
+		})
+		It("applies canned ACLs", func() {
+			Expect(buckets.Create("foo", ops.Ownership{Owner: owner, ACL: ops.ACL{Canned: "public-read-write"}}, nil)).To(Equal(s3.NoContent()))
+			Expect(db.Buckets["foo"].Meta.ACL).To(Equal([]meta.Grant{fixtures.OwnerGrant(), allUsers("READ"), allUsers("WRITE")}))
+		})
+		It("applies grant headers", func() {
+			acl := ops.ACL{Grants: map[s3.Permission]string{
+				s3.PermRead:     `uri="http://acs.amazonaws.com/groups/global/AllUsers"`,
+				s3.PermWriteACP: `id="0123456789abcdef", id=fedcba9876543210`,
+			}}
+			Expect(buckets.Create("foo", ops.Ownership{Owner: owner, ACL: acl}, nil)).To(Equal(s3.NoContent()))
+			Expect(db.Buckets["foo"].Meta.ACL).To(Equal([]meta.Grant{
+				allUsers("READ"),
+				{Type: "CanonicalUser", Grantee: "0123456789abcdef", Permission: "WRITE_ACP"},
+				{Type: "CanonicalUser", Grantee: "fedcba9876543210", Permission: "WRITE_ACP"},
+			}))
+		})
+		It("rejects invalid ACLs", func() {
+			Expect(buckets.Create("foo", ops.Ownership{ACL: ops.ACL{Canned: "public"}}, nil)).
+				To(Equal(s3.InvalidArgument("", "x-amz-acl", "public")))
+			Expect(buckets.Create("foo", ops.Ownership{ACL: ops.ACL{
+				Canned: "private",
+				Grants: map[s3.Permission]string{s3.PermRead: `id="abc"`},
+			}}, nil)).To(Equal(s3.InvalidRequest("Specifying both Canned ACLs and Header Grants is not allowed")))
+			Expect(buckets.Create("foo", ops.Ownership{ACL: ops.ACL{
+				Grants: map[s3.Permission]string{s3.PermRead: `group="abc"`},
+			}}, nil)).To(Equal(s3.InvalidArgument("Argument format not recognized", "x-amz-grant-read", `group="abc"`)))
+			Expect(buckets.Create("foo", ops.Ownership{ACL: ops.ACL{
+				Grants: map[s3.Permission]string{s3.PermRead: `uri="http://example.com/group"`},
+			}}, nil)).To(Equal(s3.InvalidArgument("Invalid group uri", "uri", "http://example.com/group")))
+			Expect(buckets.Create("foo", ops.Ownership{ACL: ops.ACL{
+				Grants: map[s3.Permission]string{s3.PermRead: `emailAddress="user@example.com"`},
+			}}, nil)).To(Equal(s3.UnresolvableGrantByEmailAddress("The e-mail address you provided does not match any account on record.")))
+			Expect(db.Buckets).To(BeEmpty())
+		})
+	})
+
+	Context("with a bucket owned by another account", func() {
+		BeforeEach(func() {
+			db.Buckets["foo"] = fakes.NewBucket(meta.BucketData{CreationDate: fixtures.Time1, Owner: other})
+			store.CreateBucket("foo")
+		})
+
+		It("grants the bucket owner access to objects with bucket-owner canned ACLs", func() {
+			opts := ops.PutOptions{Ownership: ops.Ownership{Owner: owner, ACL: ops.ACL{Canned: "bucket-owner-full-control"}}}
+			Expect(objects.Put(resource, opts, stringBody("baz")).HTTPStatus()).To(Equal(200))
+			Expect(db.Buckets["foo"].Objects["bar.txt"].Owner).To(Equal(fixtures.Owner()))
+			Expect(db.Buckets["foo"].Objects["bar.txt"].ACL).To(Equal([]meta.Grant{
+				fixtures.OwnerGrant(),
+				{Type: "CanonicalUser", Grantee: other.ID, DisplayName: other.DisplayName, Permission: "FULL_CONTROL"},
+			}))
+		})
+		It("does not copy the ACL of the source object", func() {
+			db.Buckets["foo"].Objects["src.txt"] = meta.ObjectData{Owner: other, ACL: []meta.Grant{allUsers("READ")}}
+			store.Buckets["foo"]["src.txt"] = bytes.NewBufferString("baz")
+			Expect(objects.Copy(s3.NewResource("foo", "src.txt"), resource, ops.CopyOptions{Ownership: ops.Ownership{Owner: owner}}).HTTPStatus()).To(Equal(200))
+			Expect(db.Buckets["foo"].Objects["bar.txt"].Owner).To(Equal(fixtures.Owner()))
+			Expect(db.Buckets["foo"].Objects["bar.txt"].ACL).To(Equal([]meta.Grant{fixtures.OwnerGrant()}))
+		})
+		It("records the ACL of a multipart upload", func() {
+			objects.CreateMultipartUpload(resource, ops.Metadata{}, "", ops.Ownership{Owner: owner, ACL: ops.ACL{Canned: "public-read"}})
+			Expect(db.Buckets["foo"].Uploads["bar.txt"]).To(HaveLen(1))
+			for _, upload := range db.Buckets["foo"].Uploads["bar.txt"] {
+				Expect(upload.Object.ACL).To(Equal([]meta.Grant{fixtures.OwnerGrant(), allUsers("READ")}))
+			}
+		})
+	})
+
+	Describe("GetACL and PutACL", func() {
+		BeforeEach(func() {
+			db.Buckets["foo"] = fakes.NewBucket(meta.BucketData{
+				CreationDate: fixtures.Time1,
+				Owner:        fixtures.Owner(),
+				ACL:          []meta.Grant{fixtures.OwnerGrant()},
+			})
+			db.Buckets["foo"].Objects["bar.txt"] = fixtures.ObjectMetadata()
+		})
+
+		It("returns NoSuchBucket and NoSuchKey", func() {
+			Expect(buckets.GetACL("missing")).To(Equal(s3.NoSuchBucket("missing")))
+			Expect(buckets.PutACL("missing", ops.ACL{Canned: "private"}, stringBody(""))).To(Equal(s3.NoSuchBucket("missing")))
+			Expect(objects.GetACL(s3.NewResource("foo", "missing"), "")).To(Equal(s3.NoSuchKey("missing")))
+			Expect(objects.PutACL(s3.NewResource("foo", "missing"), "", ops.ACL{Canned: "private"}, stringBody(""))).To(Equal(s3.NoSuchKey("missing")))
+		})
+		It("returns the owner and grants", func() {
+			Expect(buckets.GetACL("foo")).To(Equal(s3.AccessControlPolicy{
+				Owner:             owner,
+				AccessControlList: []s3.Grant{s3.NewUserGrant(fixtures.OwnerID, fixtures.OwnerDisplayName, s3.PermFull)},
+			}))
+			Expect(objects.GetACL(resource, "")).To(Equal(s3.AccessControlPolicy{
+				Owner: owner,
+				AccessControlList: []s3.Grant{
+					s3.NewUserGrant(fixtures.OwnerID, fixtures.OwnerDisplayName, s3.PermFull),
+					s3.NewGroupGrant(s3.AllUsersGroup, s3.PermRead),
+				},
+			}))
+		})
+		It("replaces the ACL from headers", func() {
+			Expect(buckets.PutACL("foo", ops.ACL{Canned: "authenticated-read"}, stringBody(""))).To(Equal(s3.OK()))
+			Expect(db.Buckets["foo"].Meta.ACL).To(Equal([]meta.Grant{
+				fixtures.OwnerGrant(),
+				{Type: "Group", Grantee: s3.AuthenticatedUsersGroup, Permission: "READ"},
+			}))
+			Expect(objects.PutACL(resource, "", ops.ACL{Canned: "private"}, stringBody(""))).To(Equal(s3.OK()))
+			Expect(db.Buckets["foo"].Objects["bar.txt"].ACL).To(Equal([]meta.Grant{fixtures.OwnerGrant()}))
+			Expect(db.Buckets["foo"].Objects["bar.txt"].ContentMD5).To(Equal(fixtures.ObjectContentMD5))
+		})
+		It("replaces the ACL from an AccessControlPolicy document", func() {
+			doc, err := fixtures.Asset("xml/AccessControlPolicy.xml")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objects.PutACL(resource, "", ops.ACL{}, stringBody(string(doc)))).To(Equal(s3.OK()))
+			Expect(db.Buckets["foo"].Objects["bar.txt"].ACL).To(Equal([]meta.Grant{fixtures.OwnerGrant()}))
+		})
+		It("reads and replaces the ACL of a version", func() {
+			db.Buckets["foo"].Objects["bar.txt"] = meta.ObjectData{VersionID: "v2", Owner: fixtures.Owner()}
+			db.Buckets["foo"].Versions["bar.txt"] = []meta.ObjectData{
+				{VersionID: "m1", DeleteMarker: true},
+				fixtures.ObjectMetadata(),
+			}
+			Expect(objects.GetACL(resource, fixtures.ObjectVersionID)).To(Equal(s3.AccessControlPolicy{
+				Owner: owner,
+				AccessControlList: []s3.Grant{
+					s3.NewUserGrant(fixtures.OwnerID, fixtures.OwnerDisplayName, s3.PermFull),
+					s3.NewGroupGrant(s3.AllUsersGroup, s3.PermRead),
+				},
+			}))
+			Expect(objects.PutACL(resource, fixtures.ObjectVersionID, ops.ACL{Canned: "private"}, stringBody(""))).To(Equal(s3.OK()))
+			Expect(db.Buckets["foo"].Versions["bar.txt"][1].ACL).To(Equal([]meta.Grant{fixtures.OwnerGrant()}))
+			Expect(db.Buckets["foo"].Objects["bar.txt"].VersionID).To(Equal("v2"))
+			Expect(db.Buckets["foo"].Objects["bar.txt"].ACL).To(BeEmpty())
+
+			Expect(objects.PutACL(resource, "v2", ops.ACL{Canned: "public-read"}, stringBody(""))).To(Equal(s3.OK()))
+			Expect(db.Buckets["foo"].Objects["bar.txt"].ACL).To(Equal([]meta.Grant{fixtures.OwnerGrant(), allUsers("READ")}))
+		})
+		It("returns NoSuchVersion and rejects delete markers", func() {
+			db.Buckets["foo"].Versions["bar.txt"] = []meta.ObjectData{{VersionID: "m1", DeleteMarker: true}}
+			noSuchVersion := s3.NoSuchVersion("The specified version does not exist.")
+			Expect(objects.GetACL(resource, "v1")).To(Equal(noSuchVersion))
+			Expect(objects.PutACL(resource, "v1", ops.ACL{Canned: "private"}, stringBody(""))).To(Equal(noSuchVersion))
+			methodNotAllowed := s3.MethodNotAllowed("The specified method is not allowed against this resource.")
+			Expect(objects.GetACL(resource, "m1")).To(Equal(methodNotAllowed))
+			Expect(objects.PutACL(resource, "m1", ops.ACL{Canned: "private"}, stringBody(""))).To(Equal(methodNotAllowed))
+		})
+		It("rejects missing, malformed or doubled ACLs", func() {
+			Expect(buckets.PutACL("foo", ops.ACL{}, stringBody(""))).
+				To(Equal(s3.MissingSecurityHeader("Your request was missing a required header")))
+			Expect(buckets.PutACL("foo", ops.ACL{}, stringBody("<AccessControlPolicy>"))).
+				To(Equal(s3.MalformedACLError("The XML you provided was not well-formed or did not validate against our published schema")))
+			Expect(buckets.PutACL("foo", ops.ACL{Canned: "private"}, stringBody("<AccessControlPolicy/>"))).
+				To(Equal(s3.UnexpectedContent("This request does not support content")))
+			Expect(db.Buckets["foo"].Meta.ACL).To(Equal([]meta.Grant{fixtures.OwnerGrant()}))
+		})
+	})
+})
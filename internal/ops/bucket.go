@@ -1,8 +1,12 @@
 package ops
 
 import (
+	"encoding/base64"
+	"encoding/xml"
 	"errors"
+	"io"
 	"log"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
@@ -17,10 +21,13 @@ import (
 
 const (
 	encodingTypeURL = "url"
+	// maxCreateBucketSize limits the CreateBucketConfiguration documents read.
+	maxCreateBucketSize = 64 * 1024
 )
 
 var (
-	errInvalidMaxKeys = errors.New("invalid max-keys")
+	errInvalidMaxKeys           = errors.New("invalid max-keys")
+	errInvalidContinuationToken = errors.New("invalid continuation token")
 )
 
 type bucketOps struct {
@@ -33,12 +40,33 @@ func NewBucket(db meta.DB, store blob.Store, clock clock.Clock) BucketOperations
 	return bucketOps{db: db, store: store, clock: clock}
 }
 
-func (srv bucketOps) Create(bucket string) s3.Response {
+// Create creates bucket in the location given by the optional
+// CreateBucketConfiguration in body.
+func (srv bucketOps) Create(bucket string, ownership Ownership, body io.Reader) s3.Response {
 	if response := validateBucket(bucket); response != nil {
 		return response
 	}
-	bktMeta := meta.BucketData{CreationDate: srv.clock.Now()}
-	if err := srv.db.CreateBucket(bucket, bktMeta); err != nil {
+	owner := ownership.owner()
+	grants, response := ownership.ACL.grants(owner, owner)
+	if response != nil {
+		return response
+	}
+	var config s3.CreateBucketConfiguration
+	if body != nil {
+		err := xml.NewDecoder(io.LimitReader(body, maxCreateBucketSize)).Decode(&config)
+		if err != nil && err != io.EOF {
+			return s3.MalformedXML("The XML you provided was not well-formed or did not validate against our published schema")
+		}
+	}
+	bktMeta := meta.BucketData{
+		CreationDate: srv.clock.Now(),
+		Owner:        owner,
+		ACL:          grants,
+		Location:     config.LocationConstraint,
+	}
+	if err := srv.db.CreateBucket(bucket, bktMeta); err == meta.ErrBucketExists {
+		return srv.bucketExists(bucket, owner)
+	} else if err != nil {
 		return s3.InternalError(err)
 	}
 	if err := srv.store.CreateBucket(bucket); err != nil {
@@ -47,10 +75,75 @@ func (srv bucketOps) Create(bucket string) s3.Response {
 	return s3.NoContent()
 }
 
+// Head reports whether bucket exists and the caller may access it, and
+// the region it is in.
+func (srv bucketOps) Head(bucket string) s3.Response {
+	data, err := srv.db.GetBucket(bucket)
+	if err == meta.ErrBucketNotFound {
+		return s3.NoSuchBucket(bucket)
+	} else if err != nil {
+		return s3.InternalError(err)
+	}
+	resp := s3.OK()
+	resp.Header = make(http.Header)
+	resp.Header.Set(s3.AmzBucketRegion, bucketRegion(data.Location))
+	return resp
+}
+
+func (srv bucketOps) GetLocation(bucket string) s3.Response {
+	data, err := srv.db.GetBucket(bucket)
+	if err == meta.ErrBucketNotFound {
+		return s3.NoSuchBucket(bucket)
+	} else if err != nil {
+		return s3.InternalError(err)
+	}
+	return s3.LocationConstraint{Location: data.Location}
+}
+
+// bucketRegion is the region of a bucket created with the LocationConstraint
+// location. Buckets created without one are in us-east-1, and EU is the
+// legacy name of eu-west-1.
+func bucketRegion(location string) string {
+	switch location {
+	case "":
+		return "us-east-1"
+	case "EU":
+		return "eu-west-1"
+	}
+	return location
+}
+
+// bucketExists reports whether an existing bucket is owned by owner, or
+// by another account. Buckets created anonymously belong to any account.
+func (srv bucketOps) bucketExists(bucket string, owner meta.Owner) s3.Response {
+	data, err := srv.db.GetBucket(bucket)
+	if err != nil {
+		return s3.InternalError(err)
+	}
+	if data.Owner.ID != "" && data.Owner.ID != owner.ID {
+		return s3.BucketAlreadyExists("The requested bucket name is not available. The bucket namespace is shared by all users of the system. Please select a different name and try again.")
+	}
+	return s3.BucketAlreadyOwnedByYou("Your previous request to create the named bucket succeeded and you already own it.")
+}
+
+// Delete deletes bucket once no objects, versions or multipart uploads
+// remain in it.
 func (srv bucketOps) Delete(bucket string) s3.Response {
+	return srv.deleteBucket(bucket, srv.db.DeleteBucket)
+}
+
+// ForceDelete deletes bucket along with everything in it. It is an admin
+// operation that S3 requests do not reach.
+func (srv bucketOps) ForceDelete(bucket string) s3.Response {
+	return srv.deleteBucket(bucket, srv.db.ForceDeleteBucket)
+}
+
+func (srv bucketOps) deleteBucket(bucket string, deleteMeta func(string) error) s3.Response {
 	var err error
-	if err = srv.db.DeleteBucket(bucket); err == meta.ErrBucketNotFound {
+	if err = deleteMeta(bucket); err == meta.ErrBucketNotFound {
 		return s3.NoSuchBucket(bucket)
+	} else if err == meta.ErrBucketNotEmpty {
+		return s3.BucketNotEmpty("The bucket you tried to delete is not empty")
 	} else if err != nil {
 		return s3.InternalError(err)
 	}
@@ -79,59 +172,307 @@ func (srv bucketOps) ListBucket(bucket string, query url.Values) s3.Response {
 		MaxKeys:      maxKeys,
 	}
 
-	err = srv.db.ForEachInBucket(bucket, result.Marker, func(key string, lazy meta.LazyObject) (bool, error) {
-		if !strings.HasPrefix(key, result.Prefix) {
-			return false, nil
+	list, err := srv.listObjects(bucket, result.Prefix, result.Delimiter, result.Marker, maxKeys)
+	if err != nil {
+		if err == meta.ErrBucketNotFound {
+			return s3.NoSuchBucket(bucket)
 		}
+		return s3.InternalError(err)
+	}
+	encode := keyEncoder(encodingType)
+	for i, object := range list.objects {
+		result.Contents = append(result.Contents, s3.ContentResult{
+			Key:          encode(list.keys[i]),
+			LastModified: object.LastModified.Format(time.RFC3339),
+			ETag:         objectETag(object),
+			Size:         object.Size,
+			Owner:        ownerResult(object.Owner),
+			StorageClass: "STANDARD",
+		})
+	}
+	for _, prefix := range list.prefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, encode(prefix))
+	}
+	result.IsTruncated = list.truncated
+	if list.truncated && result.Delimiter != "" {
+		result.NextMarker = encode(list.next)
+	}
 
-		if result.Delimiter != "" {
-			pl := len(result.Prefix)
-			if idx := strings.Index(key[pl:len(key)], result.Delimiter); idx != -1 {
-				key = key[0 : pl+idx+1]
-				if result.EncodingType == encodingTypeURL {
-					key = urlEncodePath(key)
-				}
-				if key != result.Marker {
-					if !result.AppendPrefix(key) {
-						result.IsTruncated = true
-						return false, nil
-					}
-					result.NextMarker = key
+	return result
+}
+
+// ListBucketV2 lists the objects in bucket like ListBucket, but pages
+// with opaque continuation tokens and only lists owners when asked to.
+func (srv bucketOps) ListBucketV2(bucket string, query url.Values) s3.Response {
+	maxKeys, err := parseMaxKeys(query.Get("max-keys"))
+	if err != nil {
+		return s3.InvalidArgument("Argument maxKeys must be an integer between 0 and 2147483647", "maxKeys", query.Get("max-keys"))
+	}
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != encodingTypeURL {
+		return s3.InvalidArgument("Invalid Encoding Method specified in Request", "encoding-type", encodingType)
+	}
+	fetchOwner, err := parseFetchOwner(query.Get("fetch-owner"))
+	if err != nil {
+		return s3.InvalidArgument("Invalid Argument", "fetch-owner", query.Get("fetch-owner"))
+	}
+
+	result := s3.ListBucketV2Result{
+		Name:              bucket,
+		Prefix:            query.Get("prefix"),
+		ContinuationToken: query.Get("continuation-token"),
+		StartAfter:        query.Get("start-after"),
+		Delimiter:         query.Get("delimiter"),
+		EncodingType:      encodingType,
+		MaxKeys:           maxKeys,
+	}
+	// The continuation token takes over from start-after once paging.
+	after := result.StartAfter
+	if _, found := query["continuation-token"]; found {
+		if after, err = parseContinuationToken(result.ContinuationToken); err != nil {
+			return s3.InvalidArgument("The continuation token provided is incorrect", "continuation-token", result.ContinuationToken)
+		}
+	}
+
+	list, err := srv.listObjects(bucket, result.Prefix, result.Delimiter, after, maxKeys)
+	if err != nil {
+		if err == meta.ErrBucketNotFound {
+			return s3.NoSuchBucket(bucket)
+		}
+		return s3.InternalError(err)
+	}
+	encode := keyEncoder(encodingType)
+	for i, object := range list.objects {
+		content := s3.ContentV2Result{
+			Key:          encode(list.keys[i]),
+			LastModified: object.LastModified.Format(time.RFC3339),
+			ETag:         objectETag(object),
+			Size:         object.Size,
+			StorageClass: "STANDARD",
+		}
+		if fetchOwner {
+			owner := ownerResult(object.Owner)
+			content.Owner = &owner
+		}
+		result.Contents = append(result.Contents, content)
+	}
+	for _, prefix := range list.prefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, encode(prefix))
+	}
+	result.KeyCount = len(result.Contents) + len(result.CommonPrefixes)
+	result.IsTruncated = list.truncated
+	if list.truncated {
+		result.NextContinuationToken = continuationToken(list.next)
+	}
+	if encodingType == encodingTypeURL {
+		result.StartAfter = urlEncodePath(result.StartAfter)
+	}
+
+	return result
+}
+
+// objectList is a page of the objects and common prefixes in a bucket.
+type objectList struct {
+	keys      []string
+	objects   []meta.ObjectData
+	prefixes  []string
+	truncated bool
+	// next is the last key or common prefix listed.
+	next string
+}
+
+// keyEncoder encodes the keys listed as encoding-type asks.
+func keyEncoder(encodingType string) func(string) string {
+	return func(key string) string {
+		if encodingType == encodingTypeURL {
+			return urlEncodePath(key)
+		}
+		return key
+	}
+}
+
+// listObjects lists up to maxKeys objects and common prefixes of bucket
+// that start with prefix and come after marker. Keys are rolled up into
+// common prefixes at the first delimiter following prefix, and the keys
+// under a common prefix are seeked past rather than read. Both versions
+// of ListObjects list through it, and listVersions the same way, so they
+// behave alike.
+func (srv bucketOps) listObjects(bucket, prefix, delimiter, marker string, maxKeys int) (list objectList, err error) {
+	full := func() bool {
+		return len(list.keys)+len(list.prefixes) >= maxKeys
+	}
+	seek := marker
+	if seek < prefix {
+		seek = prefix
+	}
+	err = srv.db.ScanBucket(bucket, seek, func(key string, lazy meta.LazyObject) (string, bool, error) {
+		if !strings.HasPrefix(key, prefix) {
+			return "", false, nil
+		}
+
+		if common, found := commonPrefix(key, prefix, delimiter); found {
+			ahead, found := prefixEnd(common)
+			if common == marker {
+				return ahead, found, nil
+			}
+			n := len(list.prefixes)
+			if n == 0 || list.prefixes[n-1] != common {
+				if full() {
+					list.truncated = true
+					return "", false, nil
 				}
-				return true, nil
+				list.prefixes = append(list.prefixes, common)
 			}
+			list.next = common
+			return ahead, found, nil
 		}
 
-		if key == result.Marker {
-			return true, nil
+		if key == marker {
+			return "", true, nil
 		}
-		if result.IsFull() {
-			result.IsTruncated = true
-			return false, nil
+		if full() {
+			list.truncated = true
+			return "", false, nil
 		}
 
 		object, innerErr := lazy.Get()
 		if innerErr != nil {
-			return false, innerErr
+			return "", false, innerErr
 		}
 
-		innerErr = srv.checkStore(object, s3.NewResource(bucket, key))
+		object, innerErr = srv.checkStore(object, s3.NewResource(bucket, key))
 		if innerErr != nil {
-			return false, innerErr
+			return "", false, innerErr
+		}
+		list.keys = append(list.keys, key)
+		list.objects = append(list.objects, object)
+		list.next = key
+		return "", true, nil
+	})
+	return
+}
+
+// commonPrefix is the common prefix key is rolled up into, when listed
+// under prefix, at the first delimiter following prefix.
+func commonPrefix(key, prefix, delimiter string) (string, bool) {
+	if delimiter == "" {
+		return "", false
+	}
+	idx := strings.Index(key[len(prefix):], delimiter)
+	if idx == -1 {
+		return "", false
+	}
+	return key[:len(prefix)+idx+len(delimiter)], true
+}
+
+// prefixEnd is the least key after every key starting with prefix. There
+// is none when prefix is all 0xff bytes.
+func prefixEnd(prefix string) (string, bool) {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1]), true
 		}
+	}
+	return "", false
+}
+
+// continuationToken is the opaque token ListBucketV2 resumes after key from.
+func continuationToken(key string) string {
+	return base64.URLEncoding.EncodeToString([]byte(key))
+}
+
+func parseContinuationToken(token string) (key string, err error) {
+	b, err := base64.URLEncoding.DecodeString(token)
+	if err != nil || len(b) == 0 {
+		return "", errInvalidContinuationToken
+	}
+	return string(b), nil
+}
+
+func parseFetchOwner(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// ListMultipartUploads lists in-progress multipart uploads in bucket.
+func (srv bucketOps) ListMultipartUploads(bucket string, query url.Values) s3.Response {
+	maxUploads, err := parseMaxKeys(query.Get("max-uploads"))
+	if err != nil {
+		return s3.InvalidArgument("Argument max-uploads must be an integer between 0 and 2147483647", "max-uploads", query.Get("max-uploads"))
+	}
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != encodingTypeURL {
+		return s3.InvalidArgument("Invalid Encoding Method specified in Request", "encoding-type", encodingType)
+	}
+
+	result := s3.ListMultipartUploadsResult{
+		Bucket:         bucket,
+		KeyMarker:      query.Get("key-marker"),
+		UploadIdMarker: query.Get("upload-id-marker"),
+		Prefix:         query.Get("prefix"),
+		Delimiter:      query.Get("delimiter"),
+		EncodingType:   encodingType,
+		MaxUploads:     maxUploads,
+	}
+	encode := func(key string) string {
 		if result.EncodingType == encodingTypeURL {
-			key = urlEncodePath(key)
+			return urlEncodePath(key)
 		}
-		result.NextMarker = ""
+		return key
+	}
 
-		result.Contents = append(result.Contents, s3.ContentResult{
-			Key:          key,
-			LastModified: object.LastModified.Format(time.RFC3339),
-			ETag:         s3.NewETag(object.ContentMD5),
-			Size:         object.Size,
-			Owner:        s3.OwnerResult{},
+	seek := result.KeyMarker
+	if seek < result.Prefix {
+		seek = result.Prefix
+	}
+	err = srv.db.ForEachUpload(bucket, seek, func(key, uploadID string, upload meta.UploadData) (bool, error) {
+		if !strings.HasPrefix(key, result.Prefix) {
+			return false, nil
+		}
+		if key == result.KeyMarker && (result.UploadIdMarker == "" || uploadID <= result.UploadIdMarker) {
+			return true, nil
+		}
+
+		if result.Delimiter != "" {
+			pl := len(result.Prefix)
+			if idx := strings.Index(key[pl:], result.Delimiter); idx != -1 {
+				prefix := key[0 : pl+idx+len(result.Delimiter)]
+				if prefix <= result.KeyMarker {
+					return true, nil
+				}
+				n := len(result.CommonPrefixes)
+				if n > 0 && result.CommonPrefixes[n-1] == encode(prefix) {
+					return true, nil
+				}
+				if len(result.Uploads)+n >= result.MaxUploads {
+					result.IsTruncated = true
+					return false, nil
+				}
+				result.CommonPrefixes = append(result.CommonPrefixes, encode(prefix))
+				result.NextKeyMarker = encode(prefix)
+				result.NextUploadIdMarker = ""
+				return true, nil
+			}
+		}
+
+		if len(result.Uploads)+len(result.CommonPrefixes) >= result.MaxUploads {
+			result.IsTruncated = true
+			return false, nil
+		}
+		result.Uploads = append(result.Uploads, s3.Upload{
+			Key:          encode(key),
+			UploadId:     uploadID,
+			Initiator:    ownerResult(upload.Object.Owner),
+			Owner:        ownerResult(upload.Object.Owner),
 			StorageClass: "STANDARD",
+			Initiated:    upload.Initiated.Format(time.RFC3339),
 		})
+		result.NextKeyMarker = encode(key)
+		result.NextUploadIdMarker = uploadID
 		return true, nil
 	})
 	if err != nil {
@@ -141,26 +482,36 @@ func (srv bucketOps) ListBucket(bucket string, query url.Values) s3.Response {
 		return s3.InternalError(err)
 	}
 	if !result.IsTruncated {
-		result.NextMarker = ""
+		result.NextKeyMarker = ""
+		result.NextUploadIdMarker = ""
 	}
 
 	return result
 }
 
-func (srv bucketOps) checkStore(data meta.ObjectData, resource s3.Resource) (err error) {
-	info, err := srv.store.Info(resource)
-	if err != nil {
+// checkStore repairs the recorded size and MD5 of a version of resource
+// whose data in store no longer matches them, unless the version changed
+// in the meantime, and returns the version as repaired.
+func (srv bucketOps) checkStore(data meta.ObjectData, resource s3.Resource) (repaired meta.ObjectData, err error) {
+	repaired = data
+	stored := objectBlob(resource, data)
+	info, err := srv.store.Info(stored)
+	if err != nil || info.Size() == data.Size {
 		return
 	}
-	if info.Size() != data.Size {
-		log.Printf("size mismatch: %s, db(%v), fs(%v)", resource, data.Size, info.Size())
-		data.Size = info.Size()
-		if data.ContentMD5, err = srv.store.MD5(resource); err != nil {
-			return
-		}
-		if err = srv.db.Put(resource, data); err != nil {
-			return
+	log.Printf("size mismatch: %s, db(%v), fs(%v)", resource, data.Size, info.Size())
+	repaired.Size = info.Size()
+	if repaired.ContentMD5, err = srv.store.MD5(stored); err != nil {
+		return
+	}
+	err = srv.db.ReplaceVersion(resource, repaired, func(current meta.ObjectData, found bool) error {
+		if current.ContentMD5 != data.ContentMD5 || !current.LastModified.Equal(data.LastModified) {
+			return errConditionConflict
 		}
+		return nil
+	})
+	if err == errConditionConflict || err == meta.ErrVersionNotFound {
+		err = nil
 	}
 	return
 }
@@ -2,6 +2,8 @@ package ops_test
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/base64"
 	"net/url"
 	"time"
 
@@ -19,6 +21,8 @@ var (
 	t2 = time.Date(2015, 6, 7, 4, 3, 2, 0, time.UTC)
 )
 
+const createBucketConfiguration = `<CreateBucketConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><LocationConstraint>EU</LocationConstraint></CreateBucketConfiguration>`
+
 var _ = Describe("BucketService", func() {
 	var (
 		db    *fakes.DB
@@ -36,7 +40,7 @@ var _ = Describe("BucketService", func() {
 	Describe("Create", func() {
 		Context("when a bucket named 'foo' does not exist", func() {
 			It("can create a bucket named 'foo'", func() {
-				Expect(srv.Create("foo")).To(Equal(s3.NoContent()))
+				Expect(srv.Create("foo", ops.Ownership{}, nil)).To(Equal(s3.NoContent()))
 				Expect(db.Buckets).To(Equal(map[string]*fakes.Bucket{
 					"foo": fakes.NewBucket(meta.BucketData{CreationDate: t1}),
 				}))
@@ -45,10 +49,21 @@ var _ = Describe("BucketService", func() {
 				}))
 			})
 		})
+		Context("when a CreateBucketConfiguration is sent", func() {
+			It("stores its location constraint", func() {
+				Expect(srv.Create("foo", ops.Ownership{}, stringBody(createBucketConfiguration))).To(Equal(s3.NoContent()))
+				Expect(db.Buckets["foo"].Meta.Location).To(Equal("EU"))
+			})
+			It("errors with MalformedXML when it is not well-formed", func() {
+				Expect(srv.Create("foo", ops.Ownership{}, stringBody("<CreateBucketConfiguration>"))).
+					To(Equal(s3.MalformedXML("The XML you provided was not well-formed or did not validate against our published schema")))
+				Expect(db.Buckets).To(BeEmpty())
+			})
+		})
 		Context("when a bucket named 'foo' does exist", func() {
-			BeforeEach(func() { srv.Create("foo") })
-			It("does not error trying to create a bucket named 'foo'", func() {
-				Expect(srv.Create("foo")).To(Equal(s3.NoContent()))
+			BeforeEach(func() { srv.Create("foo", ops.Ownership{}, nil) })
+			It("returns BucketAlreadyOwnedByYou trying to create a bucket named 'foo'", func() {
+				Expect(srv.Create("foo", ops.Ownership{}, nil)).To(Equal(s3.BucketAlreadyOwnedByYou("Your previous request to create the named bucket succeeded and you already own it.")))
 				Expect(db.Buckets).To(Equal(map[string]*fakes.Bucket{
 					"foo": fakes.NewBucket(meta.BucketData{CreationDate: t1}),
 				}))
@@ -57,34 +72,94 @@ var _ = Describe("BucketService", func() {
 				}))
 			})
 		})
+		Context("when another account owns a bucket named 'foo'", func() {
+			owner := s3.OwnerResult{ID: fixtures.OwnerID, DisplayName: fixtures.OwnerDisplayName}
+			BeforeEach(func() { srv.Create("foo", ops.Ownership{Owner: owner}, nil) })
+			It("returns BucketAlreadyExists to other accounts", func() {
+				Expect(srv.Create("foo", ops.Ownership{Owner: s3.OwnerResult{ID: "0123456789abcdef"}}, nil)).
+					To(Equal(s3.BucketAlreadyExists("The requested bucket name is not available. The bucket namespace is shared by all users of the system. Please select a different name and try again.")))
+				Expect(srv.Create("foo", ops.Ownership{}, nil)).To(BeAssignableToTypeOf(s3.ErrorResponse{}))
+				Expect(db.Buckets["foo"].Meta.Owner).To(Equal(fixtures.Owner()))
+			})
+			It("returns BucketAlreadyOwnedByYou to the owner", func() {
+				Expect(srv.Create("foo", ops.Ownership{Owner: owner}, nil)).
+					To(Equal(s3.BucketAlreadyOwnedByYou("Your previous request to create the named bucket succeeded and you already own it.")))
+			})
+		})
 		Context("when bucket name is invalid", func() {
 			It("errors with InvalidBucketName", func() {
-				Expect(srv.Create("fo")).To(Equal(s3.InvalidBucketName("BucketName too short")))
-				Expect(srv.Create("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_")).
+				Expect(srv.Create("fo", ops.Ownership{}, nil)).To(Equal(s3.InvalidBucketName("BucketName too short")))
+				Expect(srv.Create("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_", ops.Ownership{}, nil)).
 					To(Equal(s3.InvalidBucketName("BucketName too long")))
-				Expect(srv.Create("-abcd")).
+				Expect(srv.Create("-abcd", ops.Ownership{}, nil)).
 					To(Equal(s3.InvalidBucketName("BucketName not formated correctly")))
-				Expect(srv.Create("foo.-abcd")).
+				Expect(srv.Create("foo.-abcd", ops.Ownership{}, nil)).
 					To(Equal(s3.InvalidBucketName("BucketName not formated correctly")))
-				Expect(srv.Create("foo.abcd-")).
+				Expect(srv.Create("foo.abcd-", ops.Ownership{}, nil)).
 					To(Equal(s3.InvalidBucketName("BucketName not formated correctly")))
 				Expect(db.Buckets).To(BeEmpty())
 				Expect(store.Buckets).To(BeEmpty())
 			})
 		})
 	})
+	Describe("Head", func() {
+		It("errors with NoSuchBucket", func() {
+			Expect(srv.Head("foo")).To(Equal(s3.NoSuchBucket("foo")))
+		})
+		It("returns the region of the bucket", func() {
+			srv.Create("foo", ops.Ownership{}, nil)
+			resp := srv.Head("foo").(s3.SimpleResponse)
+			Expect(resp.Status).To(Equal(200))
+			Expect(resp.Header.Get(s3.AmzBucketRegion)).To(Equal("us-east-1"))
+			Expect(resp.Body).To(BeEmpty())
+
+			db.Buckets["foo"].Meta.Location = "EU"
+			Expect(srv.Head("foo").(s3.SimpleResponse).Header.Get(s3.AmzBucketRegion)).To(Equal("eu-west-1"))
+			db.Buckets["foo"].Meta.Location = "ap-south-1"
+			Expect(srv.Head("foo").(s3.SimpleResponse).Header.Get(s3.AmzBucketRegion)).To(Equal("ap-south-1"))
+		})
+	})
+	Describe("GetLocation", func() {
+		It("errors with NoSuchBucket", func() {
+			Expect(srv.GetLocation("foo")).To(Equal(s3.NoSuchBucket("foo")))
+		})
+		It("returns the location constraint the bucket was created with", func() {
+			srv.Create("foo", ops.Ownership{}, nil)
+			Expect(srv.GetLocation("foo")).To(Equal(s3.LocationConstraint{}))
+			srv.Create("bar", ops.Ownership{}, stringBody(createBucketConfiguration))
+			Expect(srv.GetLocation("bar")).To(Equal(s3.LocationConstraint{Location: "EU"}))
+		})
+	})
 	Describe("Delete", func() {
 		Context("when a bucket named 'foo' does exist", func() {
-			BeforeEach(func() { srv.Create("foo") })
+			BeforeEach(func() { srv.Create("foo", ops.Ownership{}, nil) })
 			It("can delete the bucket", func() {
 				Expect(srv.Delete("foo")).To(Equal(s3.NoContent()))
 				Expect(db.Buckets).To(BeEmpty())
 				Expect(store.Buckets).To(BeEmpty())
 			})
 		})
+		Context("when a bucket named 'foo' has objects", func() {
+			BeforeEach(func() {
+				srv.Create("foo", ops.Ownership{}, nil)
+				db.Buckets["foo"].Objects["bar"] = meta.ObjectData{}
+				store.Buckets["foo"]["bar"] = bytes.NewBufferString("baz")
+			})
+			It("errors with BucketNotEmpty and keeps the bucket", func() {
+				Expect(srv.Delete("foo")).To(Equal(s3.BucketNotEmpty("The bucket you tried to delete is not empty")))
+				Expect(db.Buckets).To(HaveKey("foo"))
+				Expect(store.Buckets["foo"]).To(HaveKey("bar"))
+			})
+			It("can be force deleted", func() {
+				Expect(srv.ForceDelete("foo")).To(Equal(s3.NoContent()))
+				Expect(db.Buckets).To(BeEmpty())
+				Expect(store.Buckets).To(BeEmpty())
+			})
+		})
 		Context("when a bucket named 'foo' does not exist", func() {
 			It("errors with NoSuchBucket", func() {
 				Expect(srv.Delete("foo")).To(Equal(s3.NoSuchBucket("foo")))
+				Expect(srv.ForceDelete("foo")).To(Equal(s3.NoSuchBucket("foo")))
 			})
 		})
 	})
@@ -95,7 +170,7 @@ var _ = Describe("BucketService", func() {
 			})
 		})
 		Context("when the bucket exists", func() {
-			BeforeEach(func() { srv.Create("foo") })
+			BeforeEach(func() { srv.Create("foo", ops.Ownership{}, nil) })
 			Context("and it is empty", func() {
 				It("returns an empty list result", func() {
 					Expect(srv.ListBucket("foo", url.Values{})).To(Equal(s3.ListBucketResult{
@@ -122,6 +197,29 @@ var _ = Describe("BucketService", func() {
 					store.Buckets["foo"]["bar/Example file.txt"] = bytes.NewBufferString("baz")
 					store.Buckets["foo"]["example.jpeg"] = bytes.NewBuffer([]byte{})
 				})
+				It("returns the owner of each object", func() {
+					obj := db.Buckets["foo"].Objects["example.jpeg"]
+					obj.Owner = fixtures.Owner()
+					db.Buckets["foo"].Objects["example.jpeg"] = obj
+					result := srv.ListBucket("foo", url.Values{}).(s3.ListBucketResult)
+					Expect(result.Contents[0].Owner).To(Equal(s3.OwnerResult{}))
+					Expect(result.Contents[1].Owner).To(Equal(s3.OwnerResult{ID: fixtures.OwnerID, DisplayName: fixtures.OwnerDisplayName}))
+				})
+				It("lists a prefix that sorts after other keys", func() {
+					result := srv.ListBucket("foo", url.Values{"prefix": []string{"example"}}).(s3.ListBucketResult)
+					Expect(result.Contents).To(HaveLen(1))
+					Expect(result.Contents[0].Key).To(Equal("example.jpeg"))
+				})
+				It("resumes after a common prefix given as the marker", func() {
+					db.Buckets["foo"].Objects["bar/more.txt"] = meta.ObjectData{}
+					values := url.Values{}
+					values.Set("delimiter", "/")
+					values.Set("marker", "bar/")
+					result := srv.ListBucket("foo", values).(s3.ListBucketResult)
+					Expect(result.CommonPrefixes).To(BeEmpty())
+					Expect(result.Contents).To(HaveLen(1))
+					Expect(result.Contents[0].Key).To(Equal("example.jpeg"))
+				})
 				Context("and not sending any parameters", func() {
 					It("returns a list with full key", func() {
 						Expect(srv.ListBucket("foo", url.Values{})).To(Equal(s3.ListBucketResult{
@@ -304,4 +402,260 @@ var _ = Describe("BucketService", func() {
 			})
 		})
 	})
+
+	Describe("ListBucketV2", func() {
+		Context("when the bucket does not exist", func() {
+			It("errors with NoSuchBucket", func() {
+				Expect(srv.ListBucketV2("foo", url.Values{"list-type": {"2"}})).To(Equal(s3.NoSuchBucket("foo")))
+			})
+		})
+		Context("when the bucket has objects", func() {
+			content := func(key string) s3.ContentV2Result {
+				return s3.ContentV2Result{
+					Key:          key,
+					LastModified: "2014-05-06T03:02:01Z",
+					ETag:         s3.ETag("content-md5[baz]"),
+					Size:         3,
+					StorageClass: "STANDARD",
+				}
+			}
+			BeforeEach(func() {
+				srv.Create("foo", ops.Ownership{}, nil)
+				for _, key := range []string{"a.txt", "b/one.txt", "b/two.txt", "c d.txt"} {
+					db.Buckets["foo"].Objects[key] = meta.ObjectData{
+						ContentMD5:   "content-md5[baz]",
+						Size:         3,
+						LastModified: fixtures.Time1,
+						Owner:        fixtures.Owner(),
+					}
+					store.Buckets["foo"][key] = bytes.NewBufferString("baz")
+				}
+			})
+
+			It("counts the keys listed and leaves out owners", func() {
+				Expect(srv.ListBucketV2("foo", url.Values{"list-type": {"2"}, "delimiter": {"/"}})).To(Equal(s3.ListBucketV2Result{
+					Name:           "foo",
+					KeyCount:       3,
+					MaxKeys:        1000,
+					Delimiter:      "/",
+					CommonPrefixes: s3.CommonPrefixes{"b/"},
+					Contents:       []s3.ContentV2Result{content("a.txt"), content("c d.txt")},
+				}))
+			})
+			It("lists owners when asked to", func() {
+				result := srv.ListBucketV2("foo", url.Values{"fetch-owner": {"true"}}).(s3.ListBucketV2Result)
+				Expect(result.Contents[0].Owner).To(Equal(&s3.OwnerResult{ID: fixtures.OwnerID, DisplayName: fixtures.OwnerDisplayName}))
+			})
+			It("pages with continuation tokens", func() {
+				query := url.Values{"delimiter": {"/"}, "max-keys": {"2"}}
+				first := srv.ListBucketV2("foo", query).(s3.ListBucketV2Result)
+				Expect(first.IsTruncated).To(BeTrue())
+				Expect(first.KeyCount).To(Equal(2))
+				Expect(first.Contents).To(Equal([]s3.ContentV2Result{content("a.txt")}))
+				Expect(first.CommonPrefixes).To(Equal(s3.CommonPrefixes{"b/"}))
+				Expect(first.NextContinuationToken).NotTo(BeEmpty())
+
+				query.Set("continuation-token", first.NextContinuationToken)
+				Expect(srv.ListBucketV2("foo", query)).To(Equal(s3.ListBucketV2Result{
+					Name:              "foo",
+					ContinuationToken: first.NextContinuationToken,
+					KeyCount:          1,
+					MaxKeys:           2,
+					Delimiter:         "/",
+					Contents:          []s3.ContentV2Result{content("c d.txt")},
+				}))
+			})
+			It("starts after the given key", func() {
+				Expect(srv.ListBucketV2("foo", url.Values{"start-after": {"b/one.txt"}, "encoding-type": {"url"}})).To(Equal(s3.ListBucketV2Result{
+					Name:         "foo",
+					StartAfter:   "b/one.txt",
+					KeyCount:     2,
+					MaxKeys:      1000,
+					EncodingType: "url",
+					Contents:     []s3.ContentV2Result{content("b/two.txt"), content("c%20d.txt")},
+				}))
+			})
+			It("rejects continuation tokens it did not issue", func() {
+				Expect(srv.ListBucketV2("foo", url.Values{"continuation-token": {"not a token"}})).
+					To(Equal(s3.InvalidArgument("The continuation token provided is incorrect", "continuation-token", "not a token")))
+			})
+		})
+	})
+
+	Describe("ListMultipartUploads", func() {
+		Context("when the bucket does not exist", func() {
+			It("errors with NoSuchBucket", func() {
+				Expect(srv.ListMultipartUploads("foo", url.Values{})).To(Equal(s3.NoSuchBucket("foo")))
+			})
+		})
+		Context("when the bucket has uploads", func() {
+			BeforeEach(func() {
+				srv.Create("foo", ops.Ownership{}, nil)
+				db.Buckets["foo"].Uploads = map[string]map[string]meta.UploadData{
+					"a/one.txt": {"u1": {Initiated: fixtures.Time1}},
+					"a/two.txt": {"u2": {Initiated: fixtures.Time1}},
+					"b.txt": {
+						"u3": {Initiated: fixtures.Time1},
+						"u4": {Initiated: fixtures.Time2},
+					},
+				}
+			})
+			upload := func(key, uploadID, initiated string) s3.Upload {
+				return s3.Upload{Key: key, UploadId: uploadID, StorageClass: "STANDARD", Initiated: initiated}
+			}
+			It("lists all uploads ordered by key and upload ID", func() {
+				Expect(srv.ListMultipartUploads("foo", url.Values{})).To(Equal(s3.ListMultipartUploadsResult{
+					Bucket:     "foo",
+					MaxUploads: 1000,
+					Uploads: []s3.Upload{
+						upload("a/one.txt", "u1", "2014-05-06T03:02:01Z"),
+						upload("a/two.txt", "u2", "2014-05-06T03:02:01Z"),
+						upload("b.txt", "u3", "2014-05-06T03:02:01Z"),
+						upload("b.txt", "u4", "2015-06-07T04:03:02Z"),
+					},
+				}))
+			})
+			It("rolls up keys by delimiter", func() {
+				Expect(srv.ListMultipartUploads("foo", url.Values{"delimiter": []string{"/"}})).To(Equal(s3.ListMultipartUploadsResult{
+					Bucket:         "foo",
+					MaxUploads:     1000,
+					Delimiter:      "/",
+					CommonPrefixes: s3.CommonPrefixes{"a/"},
+					Uploads: []s3.Upload{
+						upload("b.txt", "u3", "2014-05-06T03:02:01Z"),
+						upload("b.txt", "u4", "2015-06-07T04:03:02Z"),
+					},
+				}))
+			})
+			It("filters by prefix", func() {
+				Expect(srv.ListMultipartUploads("foo", url.Values{"prefix": []string{"b"}})).To(Equal(s3.ListMultipartUploadsResult{
+					Bucket:     "foo",
+					MaxUploads: 1000,
+					Prefix:     "b",
+					Uploads: []s3.Upload{
+						upload("b.txt", "u3", "2014-05-06T03:02:01Z"),
+						upload("b.txt", "u4", "2015-06-07T04:03:02Z"),
+					},
+				}))
+			})
+			It("pages with max-uploads, key-marker and upload-id-marker", func() {
+				query := url.Values{}
+				query.Set("max-uploads", "2")
+				Expect(srv.ListMultipartUploads("foo", query)).To(Equal(s3.ListMultipartUploadsResult{
+					Bucket:             "foo",
+					MaxUploads:         2,
+					IsTruncated:        true,
+					NextKeyMarker:      "a/two.txt",
+					NextUploadIdMarker: "u2",
+					Uploads: []s3.Upload{
+						upload("a/one.txt", "u1", "2014-05-06T03:02:01Z"),
+						upload("a/two.txt", "u2", "2014-05-06T03:02:01Z"),
+					},
+				}))
+
+				query.Set("key-marker", "b.txt")
+				query.Set("upload-id-marker", "u3")
+				Expect(srv.ListMultipartUploads("foo", query)).To(Equal(s3.ListMultipartUploadsResult{
+					Bucket:         "foo",
+					KeyMarker:      "b.txt",
+					UploadIdMarker: "u3",
+					MaxUploads:     2,
+					Uploads: []s3.Upload{
+						upload("b.txt", "u4", "2015-06-07T04:03:02Z"),
+					},
+				}))
+			})
+		})
+	})
+
+	Describe("DeleteObjects", func() {
+		var denied []string
+		authorize := func(action string, resource s3.Resource) s3.Response {
+			if resource.Key() == "secret.txt" {
+				denied = append(denied, action)
+				return s3.AccessDenied("Access Denied")
+			}
+			return nil
+		}
+		withMD5 := func(body string) ops.Digests {
+			sum := md5.Sum([]byte(body))
+			return ops.Digests{ContentMD5: base64.StdEncoding.EncodeToString(sum[:])}
+		}
+		const body = `<Delete><Object><Key>a.txt</Key></Object><Object><Key>secret.txt</Key></Object><Object><Key>missing.txt</Key></Object></Delete>`
+
+		BeforeEach(func() {
+			denied = nil
+			db.Buckets["foo"] = fakes.NewBucket(meta.BucketData{CreationDate: t1})
+			store.Buckets["foo"] = map[string]*bytes.Buffer{}
+			for _, key := range []string{"a.txt", "secret.txt"} {
+				db.Buckets["foo"].Objects[key] = meta.ObjectData{ContentMD5: "content-md5"}
+				store.Buckets["foo"][key] = bytes.NewBufferString(key)
+			}
+		})
+
+		It("errors with NoSuchBucket", func() {
+			Expect(srv.DeleteObjects("bar", withMD5(body), authorize, stringBody(body))).To(Equal(s3.NoSuchBucket("bar")))
+		})
+		It("requires a Content-MD5 or checksum", func() {
+			Expect(srv.DeleteObjects("foo", ops.Digests{}, authorize, stringBody(body))).
+				To(Equal(s3.InvalidRequest("Missing required header for this request: Content-MD5")))
+			Expect(db.Buckets["foo"].Objects).To(HaveKey("a.txt"))
+		})
+		It("verifies the Content-MD5", func() {
+			Expect(srv.DeleteObjects("foo", withMD5("other"), authorize, stringBody(body)).HTTPStatus()).To(Equal(400))
+			Expect(db.Buckets["foo"].Objects).To(HaveKey("a.txt"))
+		})
+		It("errors with MalformedXML without objects", func() {
+			const empty = `<Delete></Delete>`
+			Expect(srv.DeleteObjects("foo", withMD5(empty), authorize, stringBody(empty))).
+				To(Equal(s3.MalformedXML("The XML you provided was not well-formed or did not validate against our published schema")))
+		})
+		It("deletes each object it may and reports errors per key", func() {
+			Expect(srv.DeleteObjects("foo", withMD5(body), authorize, stringBody(body))).To(Equal(s3.DeleteResult{
+				Deleted: []s3.Deleted{{Key: "a.txt"}, {Key: "missing.txt"}},
+				Errors:  []s3.DeletedError{{Key: "secret.txt", Code: "AccessDenied", Message: "Access Denied"}},
+			}))
+			Expect(denied).To(Equal([]string{"s3:DeleteObject"}))
+			Expect(db.Buckets["foo"].Objects).ToNot(HaveKey("a.txt"))
+			Expect(store.Buckets["foo"]).ToNot(HaveKey("a.txt"))
+			Expect(db.Buckets["foo"].Objects).To(HaveKey("secret.txt"))
+		})
+		It("only reports errors in quiet mode", func() {
+			const quiet = `<Delete><Quiet>true</Quiet><Object><Key>a.txt</Key></Object><Object><Key>secret.txt</Key></Object></Delete>`
+			Expect(srv.DeleteObjects("foo", withMD5(quiet), authorize, stringBody(quiet))).To(Equal(s3.DeleteResult{
+				Errors: []s3.DeletedError{{Key: "secret.txt", Code: "AccessDenied", Message: "Access Denied"}},
+			}))
+			Expect(db.Buckets["foo"].Objects).ToNot(HaveKey("a.txt"))
+		})
+		Context("when the bucket has versioning enabled", func() {
+			BeforeEach(func() {
+				db.Buckets["foo"].Meta.Versioning = meta.VersioningEnabled
+				obj := db.Buckets["foo"].Objects["a.txt"]
+				obj.VersionID = "v1"
+				db.Buckets["foo"].Objects["a.txt"] = obj
+			})
+			It("creates delete markers or deletes the versions given", func() {
+				const markers = `<Delete><Object><Key>a.txt</Key></Object></Delete>`
+				result := srv.DeleteObjects("foo", withMD5(markers), authorize, stringBody(markers)).(s3.DeleteResult)
+				Expect(result.Deleted).To(HaveLen(1))
+				marker := result.Deleted[0]
+				Expect(marker.DeleteMarker).To(Equal("true"))
+				Expect(marker.DeleteMarkerVersionId).ToNot(BeEmpty())
+
+				versions := `<Delete><Object><Key>a.txt</Key><VersionId>v1</VersionId></Object>` +
+					`<Object><Key>a.txt</Key><VersionId>` + marker.DeleteMarkerVersionId + `</VersionId></Object>` +
+					`<Object><Key>secret.txt</Key><VersionId>null</VersionId></Object></Delete>`
+				Expect(srv.DeleteObjects("foo", withMD5(versions), authorize, stringBody(versions))).To(Equal(s3.DeleteResult{
+					Deleted: []s3.Deleted{
+						{Key: "a.txt", VersionId: "v1"},
+						{Key: "a.txt", VersionId: marker.DeleteMarkerVersionId, DeleteMarker: "true", DeleteMarkerVersionId: marker.DeleteMarkerVersionId},
+					},
+					Errors: []s3.DeletedError{{Key: "secret.txt", Code: "AccessDenied", Message: "Access Denied", VersionId: "null"}},
+				}))
+				Expect(denied).To(Equal([]string{"s3:DeleteObjectVersion"}))
+				Expect(db.Buckets["foo"].Objects).ToNot(HaveKey("a.txt"))
+				Expect(db.Buckets["foo"].Versions["a.txt"]).To(BeEmpty())
+			})
+		})
+	})
 })
@@ -0,0 +1,78 @@
+package ops
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"strings"
+
+	"github.com/ophymx/s3d/internal/blob"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+var (
+	crc32c    = crc32.MakeTable(crc32.Castagnoli)
+	crc64NVME = crc64.MakeTable(0x9a6c9329ac4bc9b5)
+)
+
+// newChecksum returns a hash for an additional checksum algorithm.
+func newChecksum(algorithm string) (h hash.Hash, ok bool) {
+	switch algorithm {
+	case s3.ChecksumCRC32:
+		return crc32.NewIEEE(), true
+	case s3.ChecksumCRC32C:
+		return crc32.New(crc32c), true
+	case s3.ChecksumCRC64NVME:
+		return crc64.New(crc64NVME), true
+	case s3.ChecksumSHA1:
+		return sha1.New(), true
+	case s3.ChecksumSHA256:
+		return sha256.New(), true
+	}
+	return nil, false
+}
+
+// compositeChecksum is the checksum of the concatenated part checksums
+// suffixed with the number of parts.
+func compositeChecksum(algorithm string, parts []string) (string, error) {
+	h, _ := newChecksum(algorithm)
+	for _, part := range parts {
+		sum, err := base64.StdEncoding.DecodeString(part)
+		if err != nil {
+			return "", err
+		}
+		h.Write(sum)
+	}
+	return fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(h.Sum(nil)), len(parts)), nil
+}
+
+// checksumType tells composite checksums, which have a part count
+// suffix, from full object checksums.
+func checksumType(checksum string) string {
+	if strings.Contains(checksum, "-") {
+		return s3.ChecksumTypeComposite
+	}
+	return s3.ChecksumTypeFullObject
+}
+
+// blobChecksum computes the checksum of resource in store.
+func (srv objectOps) blobChecksum(algorithm string, resource blob.Resource) (string, error) {
+	h, ok := newChecksum(algorithm)
+	if !ok {
+		return "", fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+	reader, err := srv.store.Get(resource)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	if _, err = io.Copy(h, reader); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,157 @@
+package ops
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ophymx/s3d/internal/blob"
+	"github.com/ophymx/s3d/internal/meta"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+var (
+	errPreconditionFailed = errors.New("precondition failed")
+	errNotModified        = errors.New("not modified")
+	errConditionConflict  = errors.New("condition conflict")
+)
+
+// Conditions are the conditional request headers of a request.
+type Conditions struct {
+	IfMatch           string
+	IfNoneMatch       string
+	IfModifiedSince   string
+	IfUnmodifiedSince string
+}
+
+// check evaluates the conditions against an object the way S3 does.
+// A matching If-Match overrides a failing If-Unmodified-Since and a
+// non-matching If-None-Match overrides a failing If-Modified-Since.
+func (c Conditions) check(etag s3.ETag, lastModified time.Time) error {
+	lastModified = lastModified.Truncate(time.Second)
+
+	if c.IfMatch != "" {
+		if !etagMatches(c.IfMatch, etag) {
+			return errPreconditionFailed
+		}
+	} else if since, ok := parseHTTPTime(c.IfUnmodifiedSince); ok && lastModified.After(since) {
+		return errPreconditionFailed
+	}
+
+	if c.IfNoneMatch != "" {
+		if etagMatches(c.IfNoneMatch, etag) {
+			return errNotModified
+		}
+	} else if since, ok := parseHTTPTime(c.IfModifiedSince); ok && !lastModified.After(since) {
+		return errNotModified
+	}
+	return nil
+}
+
+// checkWrite evaluates If-Match and If-None-Match against the object
+// currently stored, found reports whether there is one.
+func (c Conditions) checkWrite(current meta.ObjectData, found bool) error {
+	switch {
+	case c.IfNoneMatch != "" && found:
+		return errPreconditionFailed
+	case c.IfMatch != "" && !found:
+		return meta.ErrKeyNotFound
+	case c.IfMatch != "" && !etagMatches(c.IfMatch, objectETag(current)):
+		return errPreconditionFailed
+	}
+	return nil
+}
+
+// precheckWrite evaluates the conditions of a write before its body is
+// read so that requests bound to fail do so early.
+func (srv objectOps) precheckWrite(resource s3.Resource, conds Conditions) s3.Response {
+	if conds.IfNoneMatch != "" && conds.IfNoneMatch != "*" {
+		return s3.NotImplemented("A header you provided implies functionality that is not implemented")
+	}
+
+	current, err := srv.db.Get(resource)
+	if err != nil && err != meta.ErrKeyNotFound {
+		return objectError(resource, err)
+	}
+	switch err = conds.checkWrite(current, err == nil); err {
+	case nil:
+		return nil
+	case errPreconditionFailed:
+		return s3.PreconditionFailed("At least one of the pre-conditions you specified did not hold")
+	default:
+		return objectError(resource, err)
+	}
+}
+
+// commit renames staged into place as the version data of resource and
+// records it, provided the conditions still hold for the object stored at
+// that point. Conditions that held in precheckWrite but no longer do mean
+// a concurrent write won the race. Buckets that ever had versioning
+// enabled keep the version replaced. The data replaced is moved aside
+// until the write is recorded, so that it can be restored if that fails.
+func (srv objectOps) commit(resource s3.Resource, staged blob.Resource, data meta.ObjectData, conds Conditions, versioning string) s3.Response {
+	target := objectBlob(resource, data)
+	replaced := blob.Staging(resource.Bucket(), newID(srv.clock.Now()))
+	var renamed, movedAside bool
+	precondition := func(current meta.ObjectData, found bool) error {
+		if conds.checkWrite(current, found) != nil {
+			return errConditionConflict
+		}
+		if err := srv.store.Rename(target, replaced); err == nil {
+			movedAside = true
+		} else if !srv.store.IsNoSuchKey(err) {
+			return err
+		}
+		if err := srv.store.Rename(staged, target); err != nil {
+			return err
+		}
+		renamed = true
+		return nil
+	}
+	var err error
+	if versioning == "" {
+		err = srv.db.PutIf(resource, data, precondition)
+	} else {
+		err = srv.db.PutVersion(resource, data, precondition)
+	}
+	if err == nil {
+		if movedAside {
+			srv.store.Delete(replaced)
+		}
+		return nil
+	}
+
+	if renamed {
+		srv.store.Delete(target)
+	} else {
+		srv.store.Delete(staged)
+	}
+	if movedAside {
+		srv.store.Rename(replaced, target)
+	}
+	if err == errConditionConflict {
+		return s3.ConditionalRequestConflict("A conflicting conditional operation is currently in progress against this resource. Please try again.")
+	}
+	return objectError(resource, err)
+}
+
+// etagMatches tests etag against a comma separated list of entity tags or "*".
+func etagMatches(header string, etag s3.ETag) bool {
+	for _, value := range strings.Split(header, ",") {
+		value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+		if value == "*" || s3.NewETag(value) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseHTTPTime parses an HTTP date, ignoring invalid dates like S3 does.
+func parseHTTPTime(value string) (t time.Time, ok bool) {
+	if value == "" {
+		return
+	}
+	t, err := http.ParseTime(value)
+	return t, err == nil
+}
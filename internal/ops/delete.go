@@ -0,0 +1,104 @@
+package ops
+
+import (
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+
+	"github.com/ophymx/s3d/internal/meta"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+const (
+	// maxDeleteObjects limits the objects deleted by one DeleteObjects.
+	maxDeleteObjects = 1000
+	// maxDeleteSize limits the Delete documents read, which name up to
+	// maxDeleteObjects keys of up to 1024 bytes.
+	maxDeleteSize = 2 * 1024 * 1024
+)
+
+// Authorizer checks that the caller may take action on resource.
+type Authorizer func(action string, resource s3.Resource) s3.Response
+
+// DeleteObjects deletes the objects, or versions, listed in body. Each is
+// authorized and deleted on its own, and reported as deleted or with the
+// error that stopped it. Quiet mode only reports the errors.
+func (srv bucketOps) DeleteObjects(bucket string, digests Digests, authorize Authorizer, body io.Reader) s3.Response {
+	_, err := srv.db.GetBucket(bucket)
+	if err == meta.ErrBucketNotFound {
+		return s3.NoSuchBucket(bucket)
+	} else if err != nil {
+		return s3.InternalError(err)
+	}
+
+	d, resp := newDigester(digests)
+	if resp != nil {
+		return resp
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(body, maxDeleteSize+1))
+	if err != nil {
+		if resp, ok := err.(s3.ErrorResponse); ok {
+			return resp
+		}
+		return s3.InternalError(err)
+	}
+	if len(content) > maxDeleteSize {
+		return s3.MalformedXML("The XML you provided was not well-formed or did not validate against our published schema")
+	}
+	d.Write(content)
+	if resp = d.verify(); resp != nil {
+		return resp
+	}
+	if d.expectedMD5 == nil && d.expectedChecksum == nil {
+		return s3.InvalidRequest("Missing required header for this request: Content-MD5")
+	}
+
+	var request s3.Delete
+	if err = xml.Unmarshal(content, &request); err != nil || len(request.Objects) == 0 || len(request.Objects) > maxDeleteObjects {
+		return s3.MalformedXML("The XML you provided was not well-formed or did not validate against our published schema")
+	}
+
+	result := s3.DeleteResult{}
+	objects := objectOps(srv)
+	for _, object := range request.Objects {
+		resource := s3.NewResource(bucket, object.Key)
+		action := "s3:DeleteObject"
+		if object.VersionId != "" {
+			action = "s3:DeleteObjectVersion"
+		}
+		resp := authorize(action, resource)
+		var data meta.ObjectData
+		if resp == nil {
+			data, _, resp = objects.delete(resource, object.VersionId)
+		}
+		if resp != nil {
+			result.Errors = append(result.Errors, deleteError(object, resp))
+			continue
+		}
+		if request.Quiet {
+			continue
+		}
+		deleted := s3.Deleted{Key: object.Key, VersionId: object.VersionId}
+		if data.DeleteMarker {
+			deleted.DeleteMarker = "true"
+			deleted.DeleteMarkerVersionId = versionID(data)
+		}
+		result.Deleted = append(result.Deleted, deleted)
+	}
+	return result
+}
+
+// deleteError reports why object could not be deleted.
+func deleteError(object s3.ObjectIdentifier, resp s3.Response) s3.DeletedError {
+	deleteErr := s3.DeletedError{
+		Key:       object.Key,
+		Code:      "InternalError",
+		Message:   "We encountered an internal error. Please try again.",
+		VersionId: object.VersionId,
+	}
+	if errResp, ok := resp.(s3.ErrorResponse); ok {
+		deleteErr.Code = errResp.Code
+		deleteErr.Message = errResp.Message
+	}
+	return deleteErr
+}
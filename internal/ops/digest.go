@@ -0,0 +1,160 @@
+package ops
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strings"
+
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+const (
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	streamingPayload = "STREAMING-"
+)
+
+// Digests are the digests of a request body given by the client in the
+// Content-MD5, x-amz-content-sha256 and x-amz-checksum-* headers.
+// ChecksumAlgorithm asks for a checksum to be computed without one
+// to verify it against, unless one is sent in the Trailer of the body.
+type Digests struct {
+	ContentMD5        string
+	ContentSHA256     string
+	ChecksumAlgorithm string
+	Checksums         map[string]string
+	// Trailer holds the trailing headers of the body once it has been read.
+	Trailer http.Header
+}
+
+// algorithm is the additional checksum algorithm the client asked for.
+func (digests Digests) algorithm() string {
+	for algorithm := range digests.Checksums {
+		return algorithm
+	}
+	return digests.ChecksumAlgorithm
+}
+
+// digester computes the MD5 of a body as it is written, and any other
+// digests the client asked for, and checks them against the client's.
+type digester struct {
+	md5               hash.Hash
+	sha256            hash.Hash
+	checksum          hash.Hash
+	checksumAlgorithm string
+	expectedMD5       []byte
+	expectedSHA256    []byte
+	expectedChecksum  []byte
+	trailer           http.Header
+}
+
+func newDigester(digests Digests) (d *digester, resp s3.Response) {
+	d = &digester{md5: md5.New(), trailer: digests.Trailer}
+	if digests.ContentMD5 != "" {
+		var err error
+		d.expectedMD5, err = base64.StdEncoding.DecodeString(digests.ContentMD5)
+		if err != nil || len(d.expectedMD5) != md5.Size {
+			return nil, s3.InvalidDigest(digests.ContentMD5)
+		}
+	}
+
+	if value := digests.ContentSHA256; value != "" && value != unsignedPayload && !strings.HasPrefix(value, streamingPayload) {
+		var err error
+		d.expectedSHA256, err = hex.DecodeString(value)
+		if err != nil || len(d.expectedSHA256) != sha256.Size {
+			return nil, s3.InvalidArgument("x-amz-content-sha256 must be UNSIGNED-PAYLOAD, STREAMING-AWS4-HMAC-SHA256-PAYLOAD, or a valid sha256 value.", s3.AmzContentSHA256, value)
+		}
+		d.sha256 = sha256.New()
+	}
+
+	if len(digests.Checksums) > 1 {
+		return nil, s3.InvalidRequest("Expecting a single x-amz-checksum- header. Multiple checksum Types are not allowed.")
+	}
+	algorithm := digests.algorithm()
+	if algorithm == "" {
+		return d, nil
+	}
+	if digests.ChecksumAlgorithm != "" && digests.ChecksumAlgorithm != algorithm {
+		return nil, s3.InvalidRequest("Value for x-amz-sdk-checksum-algorithm header is invalid.")
+	}
+	var ok bool
+	if d.checksum, ok = newChecksum(algorithm); !ok {
+		return nil, s3.InvalidRequest("Value for x-amz-sdk-checksum-algorithm header is invalid.")
+	}
+	d.checksumAlgorithm = algorithm
+	if value, found := digests.Checksums[algorithm]; found {
+		if d.expectedChecksum, resp = d.decodeChecksum(value); resp != nil {
+			return nil, resp
+		}
+	}
+	return d, nil
+}
+
+func (d *digester) decodeChecksum(value string) ([]byte, s3.Response) {
+	checksum, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(checksum) != d.checksum.Size() {
+		return nil, s3.InvalidRequest("Value for " + s3.ChecksumHeader(d.checksumAlgorithm) + " header is invalid.")
+	}
+	return checksum, nil
+}
+
+func (d *digester) Write(p []byte) (int, error) {
+	d.md5.Write(p)
+	if d.sha256 != nil {
+		d.sha256.Write(p)
+	}
+	if d.checksum != nil {
+		d.checksum.Write(p)
+	}
+	return len(p), nil
+}
+
+// contentMD5 is the hex encoded MD5 of what has been written.
+func (d *digester) contentMD5() string {
+	return hex.EncodeToString(d.md5.Sum(nil))
+}
+
+// checksumValue is the base64 encoded additional checksum of what has
+// been written, if the client asked for one.
+func (d *digester) checksumValue() (algorithm, value string) {
+	if d.checksum == nil {
+		return
+	}
+	return d.checksumAlgorithm, base64.StdEncoding.EncodeToString(d.checksum.Sum(nil))
+}
+
+// verify compares what has been written against the client's digests,
+// including a checksum sent in the trailer of the body.
+func (d *digester) verify() s3.Response {
+	if d.checksum != nil && d.expectedChecksum == nil {
+		if value := d.trailer.Get(s3.ChecksumHeader(d.checksumAlgorithm)); value != "" {
+			var resp s3.Response
+			if d.expectedChecksum, resp = d.decodeChecksum(value); resp != nil {
+				return resp
+			}
+		}
+	}
+	if d.expectedMD5 != nil && !bytes.Equal(d.md5.Sum(nil), d.expectedMD5) {
+		return s3.BadDigest("The Content-MD5 you specified did not match what we received.")
+	}
+	if d.sha256 != nil && !bytes.Equal(d.sha256.Sum(nil), d.expectedSHA256) {
+		return s3.XAmzContentSHA256Mismatch("The provided 'x-amz-content-sha256' header does not match what was computed.")
+	}
+	if d.expectedChecksum != nil && !bytes.Equal(d.checksum.Sum(nil), d.expectedChecksum) {
+		return s3.BadDigest("The " + d.checksumAlgorithm + " you specified did not match the calculated checksum.")
+	}
+	return nil
+}
+
+// created is the response to a successful upload of an object or part.
+func (d *digester) created() s3.SimpleResponse {
+	resp := s3.Created(s3.NewETag(d.contentMD5()))
+	if algorithm, value := d.checksumValue(); value != "" {
+		resp.Header.Add(s3.ChecksumHeader(algorithm), value)
+	}
+	return resp
+}
@@ -0,0 +1,416 @@
+package ops
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ophymx/s3d/internal/blob"
+	"github.com/ophymx/s3d/internal/meta"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+const (
+	maxPartNumber       = 10000
+	minPartSize   int64 = 5 * 1024 * 1024
+)
+
+var (
+	errInvalidPartNumber = errors.New("invalid part number")
+)
+
+// CreateMultipartUpload initiates a multipart upload for resource.
+// Parts are checksummed with checksumAlgorithm, if given.
+func (srv objectOps) CreateMultipartUpload(resource s3.Resource, md Metadata, checksumAlgorithm string, ownership Ownership) s3.Response {
+	if md.tooLarge() {
+		return s3.MetadataTooLarge("Your metadata headers exceed the maximum allowed metadata size.")
+	}
+	if _, ok := newChecksum(checksumAlgorithm); checksumAlgorithm != "" && !ok {
+		return s3.InvalidRequest("Checksum algorithm provided is unsupported. Please try again with any of the valid types: [CRC32, CRC32C, CRC64NVME, SHA1, SHA256]")
+	}
+
+	grants, resp := srv.objectACL(resource, ownership)
+	if resp != nil {
+		return resp
+	}
+
+	now := srv.clock.Now()
+	uploadID := newID(now)
+	objMeta := md.objectData()
+	objMeta.ChecksumAlgorithm = checksumAlgorithm
+	objMeta.Owner = ownership.owner()
+	objMeta.ACL = grants
+	err := srv.db.CreateUpload(resource, uploadID, meta.UploadData{
+		Initiated: now,
+		Object:    objMeta,
+	})
+	if err == meta.ErrBucketNotFound {
+		return s3.NoSuchBucket(resource.Bucket())
+	} else if err != nil {
+		return s3.InternalError(err)
+	}
+
+	return s3.InitiateMultipartUploadResult{
+		Bucket:   resource.Bucket(),
+		Key:      resource.Key(),
+		UploadId: uploadID,
+	}
+}
+
+// UploadPart stores a single part of a multipart upload.
+func (srv objectOps) UploadPart(resource s3.Resource, uploadID, partNumber string, digests Digests, body io.ReadCloser) s3.Response {
+	number, err := parsePartNumber(partNumber)
+	if err != nil {
+		return s3.InvalidArgument("Part number must be an integer between 1 and 10000, inclusive", "partNumber", partNumber)
+	}
+	upload, err := srv.db.GetUpload(resource, uploadID)
+	if err != nil {
+		return uploadError(resource, err)
+	}
+	if expected := upload.Object.ChecksumAlgorithm; expected != "" {
+		if actual := digests.algorithm(); actual != "" && actual != expected {
+			return s3.InvalidRequest("Checksum Type mismatch occurred, expected checksum Type: " + strings.ToLower(expected) + ", actual checksum Type: " + strings.ToLower(actual))
+		}
+		digests.ChecksumAlgorithm = expected
+	}
+
+	staged, size, digest, resp := srv.stage(resource.Bucket(), body, digests)
+	if resp != nil {
+		return resp
+	}
+	part := blob.Part(resource.Bucket(), uploadID, number)
+	if err = srv.store.Rename(staged, part); err != nil {
+		defer srv.store.Delete(staged)
+		return s3.InternalError(err)
+	}
+
+	_, checksum := digest.checksumValue()
+	err = srv.db.PutPart(resource, uploadID, number, meta.PartData{
+		ContentMD5:   digest.contentMD5(),
+		Size:         size,
+		LastModified: srv.clock.Now(),
+		Checksum:     checksum,
+	})
+	if err != nil {
+		defer srv.store.Delete(part)
+		return uploadError(resource, err)
+	}
+
+	return digest.created()
+}
+
+// UploadPartCopy copies src, or a byte range of the version of it with
+// srcVersionID, into a part of a multipart upload.
+func (srv objectOps) UploadPartCopy(src, dst s3.Resource, srcVersionID string, srcConds Conditions, uploadID, partNumber, copyRange string) s3.Response {
+	number, err := parsePartNumber(partNumber)
+	if err != nil {
+		return s3.InvalidArgument("Part number must be an integer between 1 and 10000, inclusive", "partNumber", partNumber)
+	}
+	upload, err := srv.db.GetUpload(dst, uploadID)
+	if err != nil {
+		return uploadError(dst, err)
+	}
+
+	srcMeta, resp := srv.version(src, srcVersionID)
+	if resp != nil {
+		return resp
+	}
+	if srcMeta.DeleteMarker {
+		return s3.InvalidRequest("The source of a copy request may not specifically refer to a delete marker by version id.")
+	}
+	if srcConds.check(objectETag(srcMeta), srcMeta.LastModified) != nil {
+		return s3.PreconditionFailed("At least one of the pre-conditions you specified did not hold")
+	}
+
+	r := byteRange{length: srcMeta.Size}
+	if copyRange != "" {
+		switch r, err = parseCopySourceRange(copyRange, srcMeta.Size); err {
+		case nil:
+		case errUnsatisfiableRange:
+			return s3.InvalidArgument("Range specified is not valid for source object of size: "+strconv.FormatInt(srcMeta.Size, 10), s3.AmzCopySourceRange, copyRange)
+		default:
+			return s3.InvalidArgument("The x-amz-copy-source-range value must be of the form bytes=first-last where first and last are the zero-based offsets of the first and last bytes to copy", s3.AmzCopySourceRange, copyRange)
+		}
+	}
+
+	part := blob.Part(dst.Bucket(), uploadID, number)
+	err = srv.store.CopyRange(objectBlob(src, srcMeta), part, r.offset, r.length)
+	if srv.store.IsNoSuchKey(err) {
+		return s3.NoSuchKey(src.Key())
+	}
+	if err != nil {
+		return s3.InternalError(err)
+	}
+
+	contentMD5, err := srv.store.MD5(part)
+	if err != nil {
+		defer srv.store.Delete(part)
+		return s3.InternalError(err)
+	}
+	var checksum string
+	if algorithm := upload.Object.ChecksumAlgorithm; algorithm != "" {
+		if checksum, err = srv.blobChecksum(algorithm, part); err != nil {
+			defer srv.store.Delete(part)
+			return s3.InternalError(err)
+		}
+	}
+
+	now := srv.clock.Now()
+	err = srv.db.PutPart(dst, uploadID, number, meta.PartData{
+		ContentMD5:   contentMD5,
+		Size:         r.length,
+		LastModified: now,
+		Checksum:     checksum,
+	})
+	if err != nil {
+		defer srv.store.Delete(part)
+		return uploadError(dst, err)
+	}
+
+	result := s3.CopyPartResult{
+		LastModified: now.Format(time.RFC3339),
+		ETag:         s3.NewETag(contentMD5),
+		Checksums:    s3.NewChecksums(upload.Object.ChecksumAlgorithm, checksum),
+	}
+	if srcVersionID != "" || srcMeta.VersionID != "" {
+		result.SourceVersionID = versionID(srcMeta)
+	}
+	return result
+}
+
+// CompleteMultipartUpload assembles the listed parts into the final object.
+func (srv objectOps) CompleteMultipartUpload(resource s3.Resource, uploadID string, conds Conditions, body io.ReadCloser) s3.Response {
+	upload, err := srv.db.GetUpload(resource, uploadID)
+	if err != nil {
+		return uploadError(resource, err)
+	}
+	if resp := srv.precheckWrite(resource, conds); resp != nil {
+		return resp
+	}
+	versioning, resp := srv.versioning(resource.Bucket())
+	if resp != nil {
+		return resp
+	}
+
+	var request s3.CompleteMultipartUpload
+	if err = xml.NewDecoder(body).Decode(&request); err != nil || len(request.Parts) == 0 {
+		return s3.MalformedXML("The XML you provided was not well-formed or did not validate against our published schema")
+	}
+
+	for i := 1; i < len(request.Parts); i++ {
+		if request.Parts[i].PartNumber <= request.Parts[i-1].PartNumber {
+			return s3.InvalidPartOrder("The list of parts was not in ascending order. The parts list must be specified in order by part number.")
+		}
+	}
+
+	digest := md5.New()
+	parts := make([]blob.Resource, 0, len(request.Parts))
+	checksums := make([]string, 0, len(request.Parts))
+	objMeta := upload.Object
+	for i, requested := range request.Parts {
+		part, found := upload.Parts[requested.PartNumber]
+		if found && requested.Get(objMeta.ChecksumAlgorithm) != "" && requested.Get(objMeta.ChecksumAlgorithm) != part.Checksum {
+			found = false
+		}
+		if !found || s3.NewETag(string(requested.ETag)) != s3.NewETag(part.ContentMD5) {
+			return s3.InvalidPart("One or more of the specified parts could not be found. The part might not have been uploaded, or the specified entity tag might not have matched the part's entity tag.")
+		}
+		if i < len(request.Parts)-1 && part.Size < minPartSize {
+			return s3.EntityTooSmall("Your proposed upload is smaller than the minimum allowed object size.")
+		}
+
+		md5Bytes, err := hex.DecodeString(part.ContentMD5)
+		if err != nil {
+			return s3.InternalError(err)
+		}
+		digest.Write(md5Bytes)
+		parts = append(parts, blob.Part(resource.Bucket(), uploadID, requested.PartNumber))
+		checksums = append(checksums, part.Checksum)
+		objMeta.Size += part.Size
+		objMeta.PartSizes = append(objMeta.PartSizes, part.Size)
+	}
+
+	now := srv.clock.Now()
+	staged := blob.Staging(resource.Bucket(), newID(now))
+	if err = srv.store.Concat(staged, parts); err != nil {
+		defer srv.store.Delete(staged)
+		return s3.InternalError(err)
+	}
+
+	objMeta.ContentMD5 = hex.EncodeToString(digest.Sum(nil))
+	objMeta.LastModified = now
+	objMeta.VersionID = newVersionID(versioning, newID(now))
+	if objMeta.Checksum, err = srv.uploadChecksum(objMeta.ChecksumAlgorithm, staged, checksums); err != nil {
+		defer srv.store.Delete(staged)
+		return s3.InternalError(err)
+	}
+	if resp := srv.commit(resource, staged, objMeta, conds, versioning); resp != nil {
+		return resp
+	}
+
+	if err = srv.deleteUpload(resource, uploadID, upload); err != nil {
+		return s3.InternalError(err)
+	}
+
+	result := s3.CompleteMultipartUploadResult{
+		Location: "/" + resource.String(),
+		Bucket:   resource.Bucket(),
+		Key:      resource.Key(),
+		ETag:     objectETag(objMeta),
+	}
+	if versioning != "" {
+		result.VersionID = versionID(objMeta)
+	}
+	if objMeta.Checksum != "" {
+		result.Checksums = s3.NewChecksums(objMeta.ChecksumAlgorithm, objMeta.Checksum)
+		result.ChecksumType = checksumType(objMeta.Checksum)
+	}
+	return result
+}
+
+// uploadChecksum is the checksum of a completed multipart upload. CRC64NVME
+// is only defined over the full object, the others are composite checksums
+// of the part checksums.
+func (srv objectOps) uploadChecksum(algorithm string, staged blob.Resource, parts []string) (string, error) {
+	switch algorithm {
+	case "":
+		return "", nil
+	case s3.ChecksumCRC64NVME:
+		return srv.blobChecksum(algorithm, staged)
+	default:
+		return compositeChecksum(algorithm, parts)
+	}
+}
+
+// AbortMultipartUpload discards a multipart upload and all of its parts.
+func (srv objectOps) AbortMultipartUpload(resource s3.Resource, uploadID string) s3.Response {
+	upload, err := srv.db.GetUpload(resource, uploadID)
+	if err != nil {
+		return uploadError(resource, err)
+	}
+	if err = srv.deleteUpload(resource, uploadID, upload); err != nil {
+		return uploadError(resource, err)
+	}
+	return s3.NoContent()
+}
+
+// ListParts lists the parts uploaded so far for a multipart upload.
+func (srv objectOps) ListParts(resource s3.Resource, uploadID string, query url.Values) s3.Response {
+	maxParts, err := parseMaxKeys(query.Get("max-parts"))
+	if err != nil {
+		return s3.InvalidArgument("Argument max-parts must be an integer between 0 and 2147483647", "max-parts", query.Get("max-parts"))
+	}
+	marker, err := parsePartNumberMarker(query.Get("part-number-marker"))
+	if err != nil {
+		return s3.InvalidArgument("Argument part-number-marker must be an integer between 0 and 2147483647", "part-number-marker", query.Get("part-number-marker"))
+	}
+
+	upload, err := srv.db.GetUpload(resource, uploadID)
+	if err != nil {
+		return uploadError(resource, err)
+	}
+
+	result := s3.ListPartsResult{
+		Bucket:           resource.Bucket(),
+		Key:              resource.Key(),
+		UploadId:         uploadID,
+		Initiator:        ownerResult(upload.Object.Owner),
+		Owner:            ownerResult(upload.Object.Owner),
+		StorageClass:     "STANDARD",
+		PartNumberMarker: marker,
+		MaxParts:         maxParts,
+	}
+
+	for _, partNumber := range sortedPartNumbers(upload.Parts) {
+		if partNumber <= marker {
+			continue
+		}
+		if len(result.Parts) >= maxParts {
+			result.IsTruncated = true
+			break
+		}
+		part := upload.Parts[partNumber]
+		result.Parts = append(result.Parts, s3.Part{
+			PartNumber:   partNumber,
+			LastModified: part.LastModified.Format(time.RFC3339),
+			ETag:         s3.NewETag(part.ContentMD5),
+			Size:         part.Size,
+			Checksums:    s3.NewChecksums(upload.Object.ChecksumAlgorithm, part.Checksum),
+		})
+		result.NextPartNumberMarker = partNumber
+	}
+
+	return result
+}
+
+func (srv objectOps) deleteUpload(resource s3.Resource, uploadID string, upload meta.UploadData) error {
+	if err := srv.db.DeleteUpload(resource, uploadID); err != nil {
+		return err
+	}
+	for partNumber := range upload.Parts {
+		err := srv.store.Delete(blob.Part(resource.Bucket(), uploadID, partNumber))
+		if err != nil && !srv.store.IsNoSuchKey(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func uploadError(resource s3.Resource, err error) s3.Response {
+	switch err {
+	case meta.ErrBucketNotFound:
+		return s3.NoSuchBucket(resource.Bucket())
+	case meta.ErrUploadNotFound:
+		return s3.NoSuchUpload("The specified upload does not exist. The upload ID may be invalid, or the upload may have been aborted or completed.")
+	default:
+		return s3.InternalError(err)
+	}
+}
+
+func parsePartNumber(value string) (partNumber int, err error) {
+	if partNumber, err = strconv.Atoi(value); err != nil {
+		return
+	}
+	if partNumber < 1 || partNumber > maxPartNumber {
+		return 0, errInvalidPartNumber
+	}
+	return
+}
+
+func parsePartNumberMarker(value string) (marker int, err error) {
+	if value == "" {
+		return 0, nil
+	}
+	if marker, err = strconv.Atoi(value); err != nil {
+		return
+	}
+	if marker < 0 {
+		return 0, errInvalidPartNumber
+	}
+	return
+}
+
+func sortedPartNumbers(parts map[int]meta.PartData) []int {
+	partNumbers := make([]int, 0, len(parts))
+	for partNumber := range parts {
+		partNumbers = append(partNumbers, partNumber)
+	}
+	sort.Ints(partNumbers)
+	return partNumbers
+}
+
+// newID generates a unique ID, such as an upload ID, that sorts by time.
+func newID(now time.Time) string {
+	random := make([]byte, 8)
+	rand.Read(random)
+	return fmt.Sprintf("%016x%s", now.UnixNano(), hex.EncodeToString(random))
+}
@@ -0,0 +1,415 @@
+package ops_test
+
+import (
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/ophymx/s3d/internal/fakes"
+	"github.com/ophymx/s3d/internal/fixtures"
+	"github.com/ophymx/s3d/internal/meta"
+	"github.com/ophymx/s3d/internal/ops"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+func completeBody(parts ...s3.Part) string {
+	body := "<CompleteMultipartUpload>"
+	for _, part := range parts {
+		body += "<Part><PartNumber>" + strconv.Itoa(part.PartNumber) + "</PartNumber>" +
+			"<ETag>" + part.ETag.String() + "</ETag></Part>"
+	}
+	return body + "</CompleteMultipartUpload>"
+}
+
+var _ = Describe("Multipart Upload", func() {
+	var (
+		db       *fakes.DB
+		store    *fakes.Store
+		clock    *fakes.Clock
+		srv      ops.ObjectOperations
+		resource = s3.NewResource("foo", "bar.txt")
+	)
+	BeforeEach(func() {
+		db = fakes.NewDB()
+		store = fakes.NewStore()
+		clock = fakes.NewClock(fixtures.Time1)
+		srv = ops.NewObject(db, store, clock)
+	})
+
+	initiate := func() string {
+		resp := srv.CreateMultipartUpload(resource, ops.Metadata{ContentType: "plain/text"}, "", ops.Ownership{})
+		Expect(resp).To(BeAssignableToTypeOf(s3.InitiateMultipartUploadResult{}))
+		return resp.(s3.InitiateMultipartUploadResult).UploadId
+	}
+
+	Describe("CreateMultipartUpload", func() {
+		Context("when bucket does not exist", func() {
+			It("returns a 404 not found response", func() {
+				Expect(srv.CreateMultipartUpload(resource, ops.Metadata{ContentType: "plain/text"}, "", ops.Ownership{})).To(Equal(s3.NoSuchBucket("foo")))
+			})
+		})
+		Context("when bucket exists", func() {
+			BeforeEach(func() {
+				db.CreateBucket("foo", meta.BucketData{CreationDate: fixtures.Time1})
+				store.CreateBucket("foo")
+			})
+			It("initiates an upload", func() {
+				uploadID := initiate()
+				Expect(uploadID).ToNot(BeEmpty())
+				Expect(db.Buckets["foo"].Uploads["bar.txt"]).To(Equal(map[string]meta.UploadData{
+					uploadID: {
+						Initiated: fixtures.Time1,
+						Object:    meta.ObjectData{ContentType: "plain/text"},
+					},
+				}))
+			})
+			It("returns MetadataTooLarge over 2KB of user-defined metadata", func() {
+				md := ops.Metadata{UserDefined: map[string]string{"big": strings.Repeat("a", 2046)}}
+				Expect(srv.CreateMultipartUpload(resource, md, "", ops.Ownership{})).
+					To(Equal(s3.MetadataTooLarge("Your metadata headers exceed the maximum allowed metadata size.")))
+			})
+			It("generates a new upload ID each time", func() {
+				Expect(initiate()).ToNot(Equal(initiate()))
+			})
+		})
+	})
+
+	Describe("UploadPart", func() {
+		BeforeEach(func() {
+			db.CreateBucket("foo", meta.BucketData{CreationDate: fixtures.Time1})
+			store.CreateBucket("foo")
+		})
+		Context("when upload does not exist", func() {
+			It("returns a NoSuchUpload response", func() {
+				resp := srv.UploadPart(resource, "missing", "1", ops.Digests{}, stringBody("baz"))
+				Expect(resp.(s3.ErrorResponse).Code).To(Equal("NoSuchUpload"))
+			})
+		})
+		Context("when upload exists", func() {
+			var uploadID string
+			BeforeEach(func() { uploadID = initiate() })
+			It("stores the part", func() {
+				Expect(srv.UploadPart(resource, uploadID, "1", ops.Digests{}, stringBody("baz"))).
+					To(Equal(s3.Created(s3.NewETag("73feffa4b7f6bb68e44cf984c85f6e88"))))
+				Expect(db.Buckets["foo"].Uploads["bar.txt"][uploadID].Parts).To(Equal(map[int]meta.PartData{
+					1: {
+						ContentMD5:   "73feffa4b7f6bb68e44cf984c85f6e88",
+						Size:         3,
+						LastModified: fixtures.Time1,
+					},
+				}))
+				Expect(store.Buckets[".uploads"]["foo/"+uploadID+"/00001"]).To(Equal(bytes.NewBufferString("baz")))
+			})
+			It("rejects a part that does not match its Content-MD5", func() {
+				resp := srv.UploadPart(resource, uploadID, "1", ops.Digests{ContentMD5: "1B2M2Y8AsgTpgAmY7PhCfg=="}, stringBody("baz"))
+				Expect(resp).To(Equal(s3.BadDigest("The Content-MD5 you specified did not match what we received.")))
+				Expect(db.Buckets["foo"].Uploads["bar.txt"][uploadID].Parts).To(BeEmpty())
+				Expect(store.Buckets[".uploads"]).To(BeEmpty())
+				Expect(store.Buckets[".staging"]).To(BeEmpty())
+			})
+			It("rejects invalid part numbers", func() {
+				for _, partNumber := range []string{"", "0", "10001", "one"} {
+					Expect(srv.UploadPart(resource, uploadID, partNumber, ops.Digests{}, stringBody("baz"))).
+						To(Equal(s3.InvalidArgument("Part number must be an integer between 1 and 10000, inclusive", "partNumber", partNumber)))
+				}
+			})
+		})
+	})
+
+	Describe("UploadPartCopy", func() {
+		var (
+			uploadID string
+			src      = s3.NewResource("foo", "src.txt")
+		)
+		BeforeEach(func() {
+			db.CreateBucket("foo", meta.BucketData{CreationDate: fixtures.Time1})
+			store.CreateBucket("foo")
+			uploadID = initiate()
+			db.Put(src, meta.ObjectData{ContentMD5: "e8dc4081b13434b45189a720b77b6818", Size: 8})
+			store.Buckets["foo"]["src.txt"] = bytes.NewBufferString("abcdefgh")
+		})
+		Context("when source key does not exist", func() {
+			It("returns a 404 not found", func() {
+				Expect(srv.UploadPartCopy(s3.NewResource("foo", "missing.txt"), resource, "", ops.Conditions{}, uploadID, "1", "")).
+					To(Equal(s3.NoSuchKey("missing.txt")))
+			})
+		})
+		Context("without a range", func() {
+			It("copies the whole object into the part", func() {
+				Expect(srv.UploadPartCopy(src, resource, "", ops.Conditions{}, uploadID, "1", "")).To(Equal(s3.CopyPartResult{
+					LastModified: "2014-05-06T03:02:01Z",
+					ETag:         s3.NewETag("e8dc4081b13434b45189a720b77b6818"),
+				}))
+				Expect(store.Buckets[".uploads"]["foo/"+uploadID+"/00001"].String()).To(Equal("abcdefgh"))
+			})
+		})
+		Context("with copy source conditions", func() {
+			const etag = `"e8dc4081b13434b45189a720b77b6818"`
+			preconditionFailed := s3.PreconditionFailed("At least one of the pre-conditions you specified did not hold")
+
+			It("copies the part when they hold", func() {
+				conds := ops.Conditions{IfMatch: etag, IfNoneMatch: `"other"`}
+				Expect(srv.UploadPartCopy(src, resource, "", conds, uploadID, "1", "").HTTPStatus()).To(Equal(200))
+				Expect(store.Buckets[".uploads"]["foo/"+uploadID+"/00001"].String()).To(Equal("abcdefgh"))
+			})
+			It("returns PreconditionFailed when they do not", func() {
+				for _, conds := range []ops.Conditions{
+					{IfMatch: `"other"`},
+					{IfNoneMatch: etag},
+					{IfModifiedSince: "Tue, 06 May 2014 03:02:01 GMT"},
+				} {
+					Expect(srv.UploadPartCopy(src, resource, "", conds, uploadID, "1", "")).To(Equal(preconditionFailed))
+				}
+				Expect(store.Buckets[".uploads"]).NotTo(HaveKey("foo/" + uploadID + "/00001"))
+				Expect(db.Buckets["foo"].Uploads["bar.txt"][uploadID].Parts).To(BeEmpty())
+			})
+		})
+		Context("with a range", func() {
+			It("copies only the range into the part", func() {
+				Expect(srv.UploadPartCopy(src, resource, "", ops.Conditions{}, uploadID, "2", "bytes=2-4")).To(Equal(s3.CopyPartResult{
+					LastModified: "2014-05-06T03:02:01Z",
+					ETag:         s3.NewETag("a256e6b336afdc38c564789c399b516c"),
+				}))
+				Expect(store.Buckets[".uploads"]["foo/"+uploadID+"/00002"].String()).To(Equal("cde"))
+				Expect(db.Buckets["foo"].Uploads["bar.txt"][uploadID].Parts[2]).To(Equal(meta.PartData{
+					ContentMD5:   "a256e6b336afdc38c564789c399b516c",
+					Size:         3,
+					LastModified: fixtures.Time1,
+				}))
+			})
+			It("rejects a range past the end of the source", func() {
+				Expect(srv.UploadPartCopy(src, resource, "", ops.Conditions{}, uploadID, "1", "bytes=4-8")).
+					To(Equal(s3.InvalidArgument("Range specified is not valid for source object of size: 8", "x-amz-copy-source-range", "bytes=4-8")))
+			})
+			It("rejects a malformed range", func() {
+				for _, copyRange := range []string{"4-8", "bytes=4-", "bytes=-4", "bytes=5-4"} {
+					resp := srv.UploadPartCopy(src, resource, "", ops.Conditions{}, uploadID, "1", copyRange)
+					Expect(resp.(s3.ErrorResponse).Code).To(Equal("InvalidArgument"))
+				}
+			})
+		})
+	})
+
+	Describe("CompleteMultipartUpload", func() {
+		var uploadID string
+		BeforeEach(func() {
+			db.CreateBucket("foo", meta.BucketData{CreationDate: fixtures.Time1})
+			store.CreateBucket("foo")
+			uploadID = initiate()
+		})
+		Context("with a single part", func() {
+			BeforeEach(func() { srv.UploadPart(resource, uploadID, "1", ops.Digests{}, stringBody("baz")) })
+			It("creates the object", func() {
+				body := completeBody(s3.Part{PartNumber: 1, ETag: s3.NewETag("73feffa4b7f6bb68e44cf984c85f6e88")})
+				Expect(srv.CompleteMultipartUpload(resource, uploadID, ops.Conditions{}, stringBody(body))).
+					To(Equal(s3.CompleteMultipartUploadResult{
+						Location: "/foo/bar.txt",
+						Bucket:   "foo",
+						Key:      "bar.txt",
+						ETag:     s3.NewETag("21d8e68c74eb0e33c254fe3750cd1107-1"),
+					}))
+				Expect(db.Buckets["foo"].Objects["bar.txt"]).To(Equal(meta.ObjectData{
+					ContentMD5:   "21d8e68c74eb0e33c254fe3750cd1107",
+					Size:         3,
+					LastModified: fixtures.Time1,
+					ContentType:  "plain/text",
+					PartSizes:    []int64{3},
+				}))
+				Expect(store.Buckets["foo"]["bar.txt"]).To(Equal(bytes.NewBufferString("baz")))
+				Expect(db.Buckets["foo"].Uploads).To(BeEmpty())
+				Expect(store.Buckets[".uploads"]).To(BeEmpty())
+			})
+			It("honours If-None-Match: *", func() {
+				db.Put(resource, meta.ObjectData{ContentMD5: "e8dc4081b13434b45189a720b77b6818"})
+				body := completeBody(s3.Part{PartNumber: 1, ETag: s3.NewETag("73feffa4b7f6bb68e44cf984c85f6e88")})
+				Expect(srv.CompleteMultipartUpload(resource, uploadID, ops.Conditions{IfNoneMatch: "*"}, stringBody(body))).
+					To(Equal(s3.PreconditionFailed("At least one of the pre-conditions you specified did not hold")))
+				Expect(db.Buckets["foo"].Uploads).ToNot(BeEmpty())
+			})
+			It("honours If-Match", func() {
+				db.Put(resource, meta.ObjectData{ContentMD5: "e8dc4081b13434b45189a720b77b6818"})
+				body := completeBody(s3.Part{PartNumber: 1, ETag: s3.NewETag("73feffa4b7f6bb68e44cf984c85f6e88")})
+				resp := srv.CompleteMultipartUpload(resource, uploadID, ops.Conditions{IfMatch: `"e8dc4081b13434b45189a720b77b6818"`}, stringBody(body))
+				Expect(resp.HTTPStatus()).To(Equal(200))
+				Expect(store.Buckets["foo"]["bar.txt"].String()).To(Equal("baz"))
+			})
+			It("rejects a mismatched ETag", func() {
+				body := completeBody(s3.Part{PartNumber: 1, ETag: s3.NewETag("d41d8cd98f00b204e9800998ecf8427e")})
+				resp := srv.CompleteMultipartUpload(resource, uploadID, ops.Conditions{}, stringBody(body))
+				Expect(resp.(s3.ErrorResponse).Code).To(Equal("InvalidPart"))
+			})
+			It("rejects a malformed body", func() {
+				resp := srv.CompleteMultipartUpload(resource, uploadID, ops.Conditions{}, stringBody("<CompleteMultipartUpload>"))
+				Expect(resp.(s3.ErrorResponse).Code).To(Equal("MalformedXML"))
+			})
+		})
+		Context("with multiple parts", func() {
+			var big = strings.Repeat("a", 5242880)
+			BeforeEach(func() {
+				srv.UploadPart(resource, uploadID, "1", ops.Digests{}, stringBody(big))
+				srv.UploadPart(resource, uploadID, "2", ops.Digests{}, stringBody("baz"))
+			})
+			It("concatenates the parts", func() {
+				body := completeBody(
+					s3.Part{PartNumber: 1, ETag: s3.NewETag("79b281060d337b9b2b84ccf390adcf74")},
+					s3.Part{PartNumber: 2, ETag: s3.NewETag("73feffa4b7f6bb68e44cf984c85f6e88")},
+				)
+				Expect(srv.CompleteMultipartUpload(resource, uploadID, ops.Conditions{}, stringBody(body))).
+					To(Equal(s3.CompleteMultipartUploadResult{
+						Location: "/foo/bar.txt",
+						Bucket:   "foo",
+						Key:      "bar.txt",
+						ETag:     s3.NewETag("79dbf75f22adb39ddf80d25287707c6e-2"),
+					}))
+				Expect(store.Buckets["foo"]["bar.txt"].String()).To(Equal(big + "baz"))
+			})
+			It("rejects parts out of order", func() {
+				body := completeBody(
+					s3.Part{PartNumber: 2, ETag: s3.NewETag("73feffa4b7f6bb68e44cf984c85f6e88")},
+					s3.Part{PartNumber: 1, ETag: s3.NewETag("79b281060d337b9b2b84ccf390adcf74")},
+				)
+				resp := srv.CompleteMultipartUpload(resource, uploadID, ops.Conditions{}, stringBody(body))
+				Expect(resp.(s3.ErrorResponse).Code).To(Equal("InvalidPartOrder"))
+			})
+		})
+		Context("with checksums", func() {
+			var big = strings.Repeat("a", 5242880)
+			body := completeBody(
+				s3.Part{PartNumber: 1, ETag: s3.NewETag("79b281060d337b9b2b84ccf390adcf74")},
+				s3.Part{PartNumber: 2, ETag: s3.NewETag("73feffa4b7f6bb68e44cf984c85f6e88")},
+			)
+			initiateWith := func(algorithm string) string {
+				resp := srv.CreateMultipartUpload(resource, ops.Metadata{}, algorithm, ops.Ownership{})
+				return resp.(s3.InitiateMultipartUploadResult).UploadId
+			}
+
+			It("produces a composite checksum of the part checksums", func() {
+				uploadID := initiateWith("CRC32C")
+				resp := srv.UploadPart(resource, uploadID, "1", ops.Digests{}, stringBody(big))
+				Expect(resp.(s3.SimpleResponse).Header.Get("x-amz-checksum-crc32c")).To(Equal("WpuOeg=="))
+				srv.UploadPart(resource, uploadID, "2", ops.Digests{Checksums: map[string]string{"CRC32C": "gG5L/g=="}}, stringBody("baz"))
+
+				result := srv.CompleteMultipartUpload(resource, uploadID, ops.Conditions{}, stringBody(body)).(s3.CompleteMultipartUploadResult)
+				Expect(result.ChecksumCRC32C).To(Equal("ynqnCA==-2"))
+				Expect(result.ChecksumType).To(Equal("COMPOSITE"))
+				Expect(db.Buckets["foo"].Objects["bar.txt"].Checksum).To(Equal("ynqnCA==-2"))
+			})
+			It("produces a full object checksum for CRC64NVME", func() {
+				uploadID := initiateWith("CRC64NVME")
+				srv.UploadPart(resource, uploadID, "1", ops.Digests{}, stringBody(big))
+				srv.UploadPart(resource, uploadID, "2", ops.Digests{}, stringBody("baz"))
+
+				result := srv.CompleteMultipartUpload(resource, uploadID, ops.Conditions{}, stringBody(body)).(s3.CompleteMultipartUploadResult)
+				Expect(result.ChecksumCRC64NVME).To(Equal("aKnKxGH/IWw="))
+				Expect(result.ChecksumType).To(Equal("FULL_OBJECT"))
+			})
+			It("rejects parts checksummed with another algorithm", func() {
+				uploadID := initiateWith("CRC32C")
+				resp := srv.UploadPart(resource, uploadID, "1", ops.Digests{Checksums: map[string]string{"CRC32": "eCQEmA=="}}, stringBody("baz"))
+				Expect(resp).To(Equal(s3.InvalidRequest("Checksum Type mismatch occurred, expected checksum Type: crc32c, actual checksum Type: crc32")))
+			})
+			It("rejects an unsupported algorithm", func() {
+				Expect(srv.CreateMultipartUpload(resource, ops.Metadata{}, "MD5", ops.Ownership{}).(s3.ErrorResponse).Code).To(Equal("InvalidRequest"))
+			})
+		})
+		Context("with a small part that is not the last", func() {
+			BeforeEach(func() {
+				srv.UploadPart(resource, uploadID, "1", ops.Digests{}, stringBody("baz"))
+				srv.UploadPart(resource, uploadID, "2", ops.Digests{}, stringBody("baz"))
+			})
+			It("returns an EntityTooSmall response", func() {
+				body := completeBody(
+					s3.Part{PartNumber: 1, ETag: s3.NewETag("73feffa4b7f6bb68e44cf984c85f6e88")},
+					s3.Part{PartNumber: 2, ETag: s3.NewETag("73feffa4b7f6bb68e44cf984c85f6e88")},
+				)
+				resp := srv.CompleteMultipartUpload(resource, uploadID, ops.Conditions{}, stringBody(body))
+				Expect(resp.(s3.ErrorResponse).Code).To(Equal("EntityTooSmall"))
+				Expect(db.Buckets["foo"].Objects).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("AbortMultipartUpload", func() {
+		BeforeEach(func() {
+			db.CreateBucket("foo", meta.BucketData{CreationDate: fixtures.Time1})
+			store.CreateBucket("foo")
+		})
+		Context("when upload does not exist", func() {
+			It("returns a NoSuchUpload response", func() {
+				resp := srv.AbortMultipartUpload(resource, "missing")
+				Expect(resp.(s3.ErrorResponse).Code).To(Equal("NoSuchUpload"))
+			})
+		})
+		Context("when upload exists", func() {
+			It("removes the upload and its parts", func() {
+				uploadID := initiate()
+				srv.UploadPart(resource, uploadID, "1", ops.Digests{}, stringBody("baz"))
+				Expect(srv.AbortMultipartUpload(resource, uploadID)).To(Equal(s3.NoContent()))
+				Expect(db.Buckets["foo"].Uploads).To(BeEmpty())
+				Expect(store.Buckets[".uploads"]).To(BeEmpty())
+			})
+		})
+	})
+
+	Describe("ListParts", func() {
+		BeforeEach(func() {
+			db.CreateBucket("foo", meta.BucketData{CreationDate: fixtures.Time1})
+			store.CreateBucket("foo")
+		})
+		Context("when upload does not exist", func() {
+			It("returns a NoSuchUpload response", func() {
+				resp := srv.ListParts(resource, "missing", url.Values{})
+				Expect(resp.(s3.ErrorResponse).Code).To(Equal("NoSuchUpload"))
+			})
+		})
+		Context("when upload has parts", func() {
+			var uploadID string
+			BeforeEach(func() {
+				uploadID = initiate()
+				srv.UploadPart(resource, uploadID, "3", ops.Digests{}, stringBody("baz"))
+				srv.UploadPart(resource, uploadID, "1", ops.Digests{}, stringBody("baz"))
+				srv.UploadPart(resource, uploadID, "2", ops.Digests{}, stringBody(""))
+			})
+			It("lists the parts in order", func() {
+				Expect(srv.ListParts(resource, uploadID, url.Values{})).To(Equal(s3.ListPartsResult{
+					Bucket:               "foo",
+					Key:                  "bar.txt",
+					UploadId:             uploadID,
+					StorageClass:         "STANDARD",
+					MaxParts:             1000,
+					NextPartNumberMarker: 3,
+					Parts: []s3.Part{
+						{PartNumber: 1, LastModified: "2014-05-06T03:02:01Z", ETag: "73feffa4b7f6bb68e44cf984c85f6e88", Size: 3},
+						{PartNumber: 2, LastModified: "2014-05-06T03:02:01Z", ETag: "d41d8cd98f00b204e9800998ecf8427e", Size: 0},
+						{PartNumber: 3, LastModified: "2014-05-06T03:02:01Z", ETag: "73feffa4b7f6bb68e44cf984c85f6e88", Size: 3},
+					},
+				}))
+			})
+			It("pages with part-number-marker and max-parts", func() {
+				query := url.Values{}
+				query.Set("part-number-marker", "1")
+				query.Set("max-parts", "1")
+				Expect(srv.ListParts(resource, uploadID, query)).To(Equal(s3.ListPartsResult{
+					Bucket:               "foo",
+					Key:                  "bar.txt",
+					UploadId:             uploadID,
+					StorageClass:         "STANDARD",
+					PartNumberMarker:     1,
+					NextPartNumberMarker: 2,
+					MaxParts:             1,
+					IsTruncated:          true,
+					Parts: []s3.Part{
+						{PartNumber: 2, LastModified: "2014-05-06T03:02:01Z", ETag: "d41d8cd98f00b204e9800998ecf8427e", Size: 0},
+					},
+				}))
+			})
+			It("rejects an invalid part-number-marker", func() {
+				Expect(srv.ListParts(resource, uploadID, url.Values{"part-number-marker": []string{"-1"}})).
+					To(Equal(s3.InvalidArgument("Argument part-number-marker must be an integer between 0 and 2147483647", "part-number-marker", "-1")))
+			})
+		})
+	})
+})
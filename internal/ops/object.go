@@ -1,10 +1,11 @@
 package ops
 
 import (
-	"crypto/md5"
-	"encoding/hex"
+	"errors"
 	"io"
 	"log"
+	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/ophymx/s3d/internal/blob"
@@ -23,59 +24,212 @@ func NewObject(db meta.DB, store blob.Store, clock clock.Clock) ObjectOperations
 	return objectOps{db: db, store: store, clock: clock}
 }
 
-func (srv objectOps) Put(resource s3.Resource, contentType string, body io.ReadCloser) s3.Response {
-	_, err := srv.db.Get(resource)
-	if err == meta.ErrBucketNotFound {
-		return s3.NoSuchBucket(resource.Bucket())
+var errInvalidDirective = errors.New("invalid directive")
+
+// selfCopyError rejects copying the current version of an object onto
+// itself without changing it.
+func selfCopyError() s3.Response {
+	return s3.InvalidRequest("This copy request is illegal because it is trying to copy an object to itself without changing the object's metadata, storage class, website redirect location or encryption attributes.")
+}
+
+// maxUserDefinedSize limits the combined size of user-defined metadata names and values.
+const maxUserDefinedSize = 2 * 1024
+
+// Metadata is the metadata a client supplies when writing an object.
+type Metadata struct {
+	ContentType        string
+	CacheControl       string
+	ContentDisposition string
+	ContentEncoding    string
+	ContentLanguage    string
+	Expires            string
+	UserDefined        map[string]string
+	Tags               map[string]string
+}
+
+func (md Metadata) objectData() meta.ObjectData {
+	return meta.ObjectData{
+		ContentType:        md.ContentType,
+		CacheControl:       md.CacheControl,
+		ContentDisposition: md.ContentDisposition,
+		ContentEncoding:    md.ContentEncoding,
+		ContentLanguage:    md.ContentLanguage,
+		Expires:            md.Expires,
+		UserDefined:        md.UserDefined,
+		Tags:               md.Tags,
 	}
+}
 
-	writer, err := srv.store.Create(resource)
-	if err != nil {
-		return s3.InternalError(err)
+// replace returns data with its metadata, but not its tags, replaced by md.
+func (md Metadata) replace(data meta.ObjectData) meta.ObjectData {
+	replaced := md.objectData()
+	replaced.ContentMD5 = data.ContentMD5
+	replaced.Size = data.Size
+	replaced.LastModified = data.LastModified
+	replaced.VersionID = data.VersionID
+	replaced.PartSizes = data.PartSizes
+	replaced.Tags = data.Tags
+	replaced.ChecksumAlgorithm = data.ChecksumAlgorithm
+	replaced.Checksum = data.Checksum
+	return replaced
+}
+
+func (md Metadata) tooLarge() bool {
+	size := 0
+	for name, value := range md.UserDefined {
+		size += len(name) + len(value)
 	}
-	defer writer.Close()
+	return size > maxUserDefinedSize
+}
 
-	digest := md5.New()
+// PutOptions are the optional request parameters of Put.
+type PutOptions struct {
+	Conditions
+	Metadata
+	Digests
+	Ownership
+}
 
-	size, err := io.Copy(io.MultiWriter(writer, digest), body)
-	if err != nil {
-		return s3.InternalError(err)
+func (srv objectOps) Put(resource s3.Resource, opts PutOptions, body io.ReadCloser) s3.Response {
+	if opts.tooLarge() {
+		return s3.MetadataTooLarge("Your metadata headers exceed the maximum allowed metadata size.")
+	}
+	grants, resp := srv.objectACL(resource, opts.Ownership)
+	if resp != nil {
+		return resp
+	}
+	if resp := srv.precheckWrite(resource, opts.Conditions); resp != nil {
+		return resp
+	}
+	versioning, resp := srv.versioning(resource.Bucket())
+	if resp != nil {
+		return resp
 	}
 
-	contentMD5 := hex.EncodeToString(digest.Sum(nil))
-	err = srv.db.Put(resource, meta.ObjectData{
-		ContentMD5:   contentMD5,
-		Size:         size,
-		LastModified: srv.clock.Now(),
-		ContentType:  contentType,
-	})
+	staged, size, digest, resp := srv.stage(resource.Bucket(), body, opts.Digests)
+	if resp != nil {
+		return resp
+	}
+
+	objMeta := opts.objectData()
+	objMeta.ContentMD5 = digest.contentMD5()
+	objMeta.ChecksumAlgorithm, objMeta.Checksum = digest.checksumValue()
+	objMeta.Size = size
+	objMeta.LastModified = srv.clock.Now()
+	objMeta.VersionID = newVersionID(versioning, newID(objMeta.LastModified))
+	objMeta.Owner = opts.owner()
+	objMeta.ACL = grants
+	if resp := srv.commit(resource, staged, objMeta, opts.Conditions, versioning); resp != nil {
+		return resp
+	}
+
+	created := digest.created()
+	created.Header = versionHeader(created.Header, versioning, objMeta)
+	return created
+}
+
+// stage writes body to a staging blob in bucket and verifies it against
+// digests. The staging blob is removed if anything goes wrong.
+func (srv objectOps) stage(bucket string, body io.Reader, digests Digests) (staged blob.Resource, size int64, digest *digester, resp s3.Response) {
+	if digest, resp = newDigester(digests); resp != nil {
+		return
+	}
+
+	staged = blob.Staging(bucket, newID(srv.clock.Now()))
+	writer, err := srv.store.Create(staged)
 	if err != nil {
-		defer srv.store.Delete(resource)
-		if err == meta.ErrBucketNotFound {
-			return s3.NoSuchBucket(resource.Bucket())
-		}
-		return s3.InternalError(err)
+		return nil, 0, nil, s3.InternalError(err)
 	}
+	defer writer.Close()
 
-	return s3.Created(s3.NewETag(contentMD5))
+	if size, err = io.Copy(io.MultiWriter(writer, digest), body); err == nil {
+		err = writer.Close()
+	}
+	if errResp, ok := err.(s3.ErrorResponse); ok {
+		resp = errResp
+	} else if err != nil {
+		resp = s3.InternalError(err)
+	} else {
+		resp = digest.verify()
+	}
+	if resp != nil {
+		srv.store.Delete(staged)
+		return nil, 0, nil, resp
+	}
+	return staged, size, digest, nil
+}
+
+// CopyOptions are the optional request parameters of Copy.
+type CopyOptions struct {
+	// SourceConditions are evaluated against the source object.
+	SourceConditions  Conditions
+	SourceVersionID   string
+	MetadataDirective string
+	TaggingDirective  string
+	// Metadata replaces the metadata of the source when MetadataDirective
+	// is REPLACE and its tags when TaggingDirective is REPLACE.
+	Metadata
+	// Ownership gives the copy its owner and ACL, which are never copied.
+	Ownership
 }
 
-func (srv objectOps) Copy(src, dst s3.Resource) s3.Response {
+func (srv objectOps) Copy(src, dst s3.Resource, opts CopyOptions) s3.Response {
 	log.Printf("Copy: %s -> %s", src, dst)
 
-	objMeta, err := srv.db.Get(src)
+	replaceMetadata, err := parseDirective(opts.MetadataDirective)
 	if err != nil {
-		switch err {
-		case meta.ErrBucketNotFound:
-			return s3.NoSuchBucket(src.Bucket())
-		case meta.ErrKeyNotFound:
-			return s3.NoSuchKey(src.Key())
-		default:
+		return s3.InvalidArgument("Unknown metadata directive.", s3.AmzMetadataDirective, opts.MetadataDirective)
+	}
+	replaceTagging, err := parseDirective(opts.TaggingDirective)
+	if err != nil {
+		return s3.InvalidArgument("Unknown tagging directive.", s3.AmzTaggingDirective, opts.TaggingDirective)
+	}
+	selfCopy := src == dst && !replaceMetadata
+	if selfCopy && opts.SourceVersionID == "" {
+		return selfCopyError()
+	}
+	if replaceMetadata && opts.tooLarge() {
+		return s3.MetadataTooLarge("Your metadata headers exceed the maximum allowed metadata size.")
+	}
+
+	objMeta, resp := srv.version(src, opts.SourceVersionID)
+	if resp != nil {
+		return resp
+	}
+	if objMeta.DeleteMarker {
+		return s3.InvalidRequest("The source of a copy request may not specifically refer to a delete marker by version id.")
+	}
+	if selfCopy {
+		// Copying an older version over the key restores it.
+		current, err := srv.db.Get(src)
+		if err != nil && err != meta.ErrKeyNotFound {
 			return s3.InternalError(err)
 		}
+		if err == nil && current.VersionID == objMeta.VersionID {
+			return selfCopyError()
+		}
+	}
+	srcBlob := objectBlob(src, objMeta)
+	if opts.SourceConditions.check(objectETag(objMeta), objMeta.LastModified) != nil {
+		return s3.PreconditionFailed("At least one of the pre-conditions you specified did not hold")
+	}
+	grants, resp := srv.objectACL(dst, opts.Ownership)
+	if resp != nil {
+		return resp
+	}
+	versioning, resp := srv.versioning(dst.Bucket())
+	if resp != nil {
+		return resp
 	}
 
-	err = srv.store.Copy(src, dst)
+	result := s3.CopyObjectResult{}
+	if opts.SourceVersionID != "" || objMeta.VersionID != "" {
+		result.SourceVersionID = versionID(objMeta)
+	}
+	objMeta.LastModified = srv.clock.Now()
+	objMeta.VersionID = newVersionID(versioning, newID(objMeta.LastModified))
+	dstBlob := objectBlob(dst, objMeta)
+	err = srv.store.Copy(srcBlob, dstBlob)
 	if srv.store.IsNoSuchKey(err) {
 		return s3.NoSuchKey(src.Key())
 	}
@@ -83,46 +237,75 @@ func (srv objectOps) Copy(src, dst s3.Resource) s3.Response {
 		return s3.InternalError(err)
 	}
 
-	objMeta.LastModified = srv.clock.Now()
-	err = srv.db.Put(dst, objMeta)
+	if replaceMetadata {
+		objMeta = opts.replace(objMeta)
+	}
+	if replaceTagging {
+		objMeta.Tags = opts.Tags
+	}
+	objMeta.Owner = opts.owner()
+	objMeta.ACL = grants
+	if versioning == "" {
+		err = srv.db.Put(dst, objMeta)
+	} else {
+		err = srv.db.PutVersion(dst, objMeta, func(meta.ObjectData, bool) error { return nil })
+	}
 	if err != nil {
-		defer srv.store.Delete(dst)
+		defer srv.store.Delete(dstBlob)
 		if err == meta.ErrBucketNotFound {
 			return s3.NoSuchBucket(dst.Bucket())
 		}
 		return s3.InternalError(err)
 	}
 
-	return s3.CopyObjectResult{
-		ETag:         s3.NewETag(objMeta.ContentMD5),
-		LastModified: objMeta.LastModified.Format(time.RFC3339),
+	result.ETag = objectETag(objMeta)
+	result.LastModified = objMeta.LastModified.Format(time.RFC3339)
+	if versioning != "" {
+		result.VersionID = versionID(objMeta)
 	}
+	return result
+}
+
+// GetOptions are the optional request parameters of Get and Head.
+type GetOptions struct {
+	Conditions
+	// VersionID selects a version other than the current one.
+	VersionID    string
+	Range        string
+	PartNumber   string
+	ChecksumMode string
 }
 
 // Get fetches the object and metadata.
-func (srv objectOps) Get(resource s3.Resource) s3.Response {
-	return srv.get(resource, false)
+func (srv objectOps) Get(resource s3.Resource, opts GetOptions) s3.Response {
+	return srv.get(resource, opts, false)
 }
 
 // Head fetches object metadata but not the object itself.
-func (srv objectOps) Head(resource s3.Resource) s3.Response {
-	return srv.get(resource, true)
+func (srv objectOps) Head(resource s3.Resource, opts GetOptions) s3.Response {
+	return srv.get(resource, opts, true)
 }
 
-func (srv objectOps) get(resource s3.Resource, head bool) s3.Response {
-	objMeta, err := srv.db.Get(resource)
-	if err != nil {
-		switch err {
-		case meta.ErrBucketNotFound:
-			return s3.NoSuchBucket(resource.Bucket())
-		case meta.ErrKeyNotFound:
-			return s3.NoSuchKey(resource.Key())
-		default:
-			return s3.InternalError(err)
-		}
+func (srv objectOps) get(resource s3.Resource, opts GetOptions, head bool) s3.Response {
+	if opts.Range != "" && opts.PartNumber != "" {
+		return s3.InvalidRequest("Cannot specify both Range header and partNumber query parameter")
+	}
+
+	objMeta, resp := srv.version(resource, opts.VersionID)
+	if resp != nil && opts.VersionID == "" {
+		return srv.hidden(resource, resp)
+	} else if resp != nil {
+		return resp
+	}
+	if objMeta.DeleteMarker {
+		notAllowed := s3.MethodNotAllowed("The specified method is not allowed against this resource.")
+		notAllowed.Header = deleted(objMeta).Header
+		notAllowed.Header.Set(s3.HdrLastModified, objMeta.LastModified.Format(http.TimeFormat))
+		return notAllowed
 	}
 
-	info, err := srv.store.Info(resource)
+	objBlob := objectBlob(resource, objMeta)
+	info, err := srv.store.Info(objBlob)
 	if srv.store.IsNoSuchKey(err) {
 		return s3.NoSuchKey(resource.Key())
 	}
@@ -130,9 +313,67 @@ func (srv objectOps) get(resource s3.Resource, head bool) s3.Response {
 		return s3.InternalError(err)
 	}
 
-	var file io.ReadCloser
+	etag := objectETag(objMeta)
+	lastModified := objMeta.LastModified.Format(time.RFC3339)
+	switch opts.check(etag, objMeta.LastModified) {
+	case errPreconditionFailed:
+		return s3.PreconditionFailed("At least one of the pre-conditions you specified did not hold")
+	case errNotModified:
+		return s3.NotModified(etag, lastModified)
+	}
+
+	object := s3.Object{
+		ContentLength:      info.Size(),
+		ETag:               etag,
+		ContentType:        objMeta.ContentType,
+		LastModified:       lastModified,
+		CacheControl:       objMeta.CacheControl,
+		ContentDisposition: objMeta.ContentDisposition,
+		ContentEncoding:    objMeta.ContentEncoding,
+		ContentLanguage:    objMeta.ContentLanguage,
+		Expires:            objMeta.Expires,
+		UserDefined:        objMeta.UserDefined,
+		TagCount:           len(objMeta.Tags),
+	}
+	if opts.VersionID != "" || objMeta.VersionID != "" {
+		object.VersionID = versionID(objMeta)
+	}
+
+	var r byteRange
+	partial := false
+	switch {
+	case opts.PartNumber != "":
+		if r, err = partRange(objMeta, info.Size(), opts.PartNumber); err != nil {
+			if err == errInvalidPartNumber {
+				return s3.InvalidArgument("Part number must be an integer between 1 and 10000, inclusive", "partNumber", opts.PartNumber)
+			}
+			return s3.InvalidPartNumber("The requested partnumber is not satisfiable")
+		}
+		partial = true
+		object.PartsCount = len(objMeta.PartSizes)
+	case opts.Range != "":
+		switch r, err = parseRange(opts.Range, info.Size()); err {
+		case nil:
+			partial = true
+		case errUnsatisfiableRange:
+			return s3.InvalidRange("The requested range is not satisfiable")
+		}
+	}
+	if partial {
+		object.ContentLength = r.length
+		object.ContentRange = r.contentRange(info.Size())
+	} else if opts.ChecksumMode == "ENABLED" && objMeta.Checksum != "" {
+		object.ChecksumAlgorithm = objMeta.ChecksumAlgorithm
+		object.Checksum = objMeta.Checksum
+		object.ChecksumType = checksumType(objMeta.Checksum)
+	}
+
 	if !head {
-		file, err = srv.store.Get(resource)
+		if partial {
+			object.File, err = srv.store.GetRange(objBlob, r.offset, r.length)
+		} else {
+			object.File, err = srv.store.Get(objBlob)
+		}
 		if srv.store.IsNoSuchKey(err) {
 			return s3.NoSuchKey(resource.Key())
 		}
@@ -141,33 +382,146 @@ func (srv objectOps) get(resource s3.Resource, head bool) s3.Response {
 		}
 	}
 
-	return s3.Object{
-		File:          file,
-		ContentLength: info.Size(),
-		ETag:          s3.NewETag(objMeta.ContentMD5),
-		ContentType:   objMeta.ContentType,
-		LastModified:  objMeta.LastModified.Format(time.RFC3339),
-		CacheControl:  objMeta.CacheControl,
-		UserDefined:   objMeta.UserDefined,
-		VersionID:     objMeta.VersionID,
+	return object
+}
+
+// Delete deletes object at bucket/key or, given a versionID, that version
+// of it. Buckets with versioning keep the versions of an object deleted
+// without a versionID behind a delete marker.
+func (srv objectOps) Delete(resource s3.Resource, versionID string) s3.Response {
+	data, versioned, resp := srv.delete(resource, versionID)
+	if resp != nil {
+		return resp
 	}
+	if !versioned {
+		return s3.NoContent()
+	}
+	return deleted(data)
 }
 
-// Delete deletes object at bucket/key
-func (srv objectOps) Delete(resource s3.Resource) s3.Response {
+// delete deletes resource, or the version of it with versionID, and
+// returns the version deleted or delete marker created, if versioned.
+func (srv objectOps) delete(resource s3.Resource, versionID string) (data meta.ObjectData, versioned bool, resp s3.Response) {
+	if versionID != "" {
+		data, resp = srv.deleteVersion(resource, versionID)
+		return data, true, resp
+	}
+	versioning, resp := srv.versioning(resource.Bucket())
+	if resp != nil {
+		return data, false, resp
+	}
+	if versioning != "" {
+		data, resp = srv.deleteMarker(resource, versioning)
+		return data, true, resp
+	}
+
 	_, err := srv.db.Get(resource)
 	if err == meta.ErrBucketNotFound {
-		return s3.NoSuchBucket(resource.Bucket())
+		return data, false, s3.NoSuchBucket(resource.Bucket())
 	}
 
 	err = srv.store.Delete(resource)
 	if err != nil {
 		if !srv.store.IsNoSuchKey(err) {
-			return s3.InternalError(err)
+			return data, false, s3.InternalError(err)
 		}
 	}
 
 	srv.db.Delete(resource)
 
-	return s3.NoContent()
+	return data, false, nil
+}
+
+// deleteMarker hides the versions of resource behind a new delete marker.
+// A null delete marker replaces the null version.
+func (srv objectOps) deleteMarker(resource s3.Resource, versioning string) (meta.ObjectData, s3.Response) {
+	marker := meta.ObjectData{DeleteMarker: true, LastModified: srv.clock.Now()}
+	marker.VersionID = newVersionID(versioning, newID(marker.LastModified))
+	err := srv.db.PutVersion(resource, marker, func(meta.ObjectData, bool) error {
+		if marker.VersionID != "" {
+			return nil
+		}
+		if err := srv.store.Delete(resource); err != nil && !srv.store.IsNoSuchKey(err) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return marker, objectError(resource, err)
+	}
+	return marker, nil
+}
+
+// deleteVersion permanently deletes a version of resource. Deleting a
+// version that does not exist succeeds as it does in S3.
+func (srv objectOps) deleteVersion(resource s3.Resource, versionID string) (meta.ObjectData, s3.Response) {
+	id := versionID
+	if id == "null" {
+		id = ""
+	}
+	data, err := srv.db.DeleteVersion(resource, id)
+	if err == meta.ErrVersionNotFound {
+		return meta.ObjectData{VersionID: id}, nil
+	} else if err != nil {
+		return data, objectError(resource, err)
+	}
+	if !data.DeleteMarker {
+		err = srv.store.Delete(objectBlob(resource, data))
+		if err != nil && !srv.store.IsNoSuchKey(err) {
+			return data, s3.InternalError(err)
+		}
+	}
+	return data, nil
+}
+
+// deleted is the response to deleting, or creating, the version data.
+func deleted(data meta.ObjectData) s3.SimpleResponse {
+	resp := s3.NoContent()
+	resp.Header = make(http.Header)
+	resp.Header.Set(s3.AmzVersionID, versionID(data))
+	if data.DeleteMarker {
+		resp.Header.Set(s3.AmzDeleteMarker, "true")
+	}
+	return resp
+}
+
+func objectError(resource s3.Resource, err error) s3.Response {
+	switch err {
+	case meta.ErrBucketNotFound:
+		return s3.NoSuchBucket(resource.Bucket())
+	case meta.ErrKeyNotFound:
+		return s3.NoSuchKey(resource.Key())
+	default:
+		return s3.InternalError(err)
+	}
+}
+
+// versionID is the version ID of data as given in requests.
+// Objects without a version have the version "null".
+func versionID(data meta.ObjectData) string {
+	if data.VersionID == "" {
+		return "null"
+	}
+	return data.VersionID
+}
+
+// parseDirective reports whether an x-amz-*-directive header asks to
+// REPLACE rather than COPY.
+func parseDirective(value string) (replace bool, err error) {
+	switch value {
+	case "", "COPY":
+		return false, nil
+	case "REPLACE":
+		return true, nil
+	}
+	return false, errInvalidDirective
+}
+
+// objectETag is the MD5 of the object, or for multipart uploads
+// the MD5 of the part MD5s suffixed with the number of parts.
+func objectETag(data meta.ObjectData) s3.ETag {
+	if len(data.PartSizes) > 0 {
+		return s3.NewETag(data.ContentMD5 + "-" + strconv.Itoa(len(data.PartSizes)))
+	}
+	return s3.NewETag(data.ContentMD5)
 }
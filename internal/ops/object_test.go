@@ -2,8 +2,10 @@ package ops_test
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"strings"
 
 	. "github.com/onsi/ginkgo"
@@ -19,6 +21,34 @@ func stringBody(content string) io.ReadCloser {
 	return ioutil.NopCloser(strings.NewReader(content))
 }
 
+// racingBody runs race before it is first read, standing in for a write
+// that lands while the body is still being uploaded.
+type racingBody struct {
+	io.Reader
+	race func()
+}
+
+func (b *racingBody) Read(p []byte) (int, error) {
+	if b.race != nil {
+		b.race()
+		b.race = nil
+	}
+	return b.Reader.Read(p)
+}
+
+func (*racingBody) Close() error {
+	return nil
+}
+
+// errReader fails every read with err.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
 var _ = Describe("ObjectService", func() {
 	var (
 		db    *fakes.DB
@@ -36,7 +66,7 @@ var _ = Describe("ObjectService", func() {
 	Describe("Get", func() {
 		Context("when bucket does not exist", func() {
 			It("returns a 404 not found response", func() {
-				Expect(srv.Get(s3.NewResource("foo", "bar.txt"))).To(Equal(s3.NoSuchBucket("foo")))
+				Expect(srv.Get(s3.NewResource("foo", "bar.txt"), ops.GetOptions{})).To(Equal(s3.NoSuchBucket("foo")))
 			})
 		})
 		Context("when bucket exists", func() {
@@ -46,7 +76,7 @@ var _ = Describe("ObjectService", func() {
 			})
 			Context("but key does not", func() {
 				It("returns a 404 not found response", func() {
-					Expect(srv.Get(s3.NewResource("foo", "bar.txt"))).To(Equal(s3.NoSuchKey("bar.txt")))
+					Expect(srv.Get(s3.NewResource("foo", "bar.txt"), ops.GetOptions{})).To(Equal(s3.NoSuchKey("bar.txt")))
 				})
 			})
 			Context("and key exists", func() {
@@ -58,7 +88,7 @@ var _ = Describe("ObjectService", func() {
 					store.Buckets["foo"]["bar.txt"] = bytes.NewBufferString("baz")
 				})
 				It("returns an object response", func() {
-					Expect(srv.Get(s3.NewResource("foo", "bar.txt"))).To(Equal(s3.Object{
+					Expect(srv.Get(s3.NewResource("foo", "bar.txt"), ops.GetOptions{})).To(Equal(s3.Object{
 						ContentLength: 3,
 						LastModified:  "2014-05-06T03:02:01Z",
 						ETag:          "content-md5[baz]",
@@ -69,10 +99,150 @@ var _ = Describe("ObjectService", func() {
 		})
 	})
 
+	Describe("Get with Range", func() {
+		var resource = s3.NewResource("foo", "bar.txt")
+		BeforeEach(func() {
+			db.CreateBucket("foo", meta.BucketData{CreationDate: fixtures.Time1})
+			store.CreateBucket("foo")
+			db.Put(resource, meta.ObjectData{
+				ContentMD5:   "e8dc4081b13434b45189a720b77b6818",
+				Size:         8,
+				LastModified: fixtures.Time1,
+			})
+			store.Buckets["foo"]["bar.txt"] = bytes.NewBufferString("abcdefgh")
+		})
+		partial := func(contentRange, content string) s3.Object {
+			return s3.Object{
+				ContentLength: int64(len(content)),
+				ContentRange:  contentRange,
+				LastModified:  "2014-05-06T03:02:01Z",
+				ETag:          "e8dc4081b13434b45189a720b77b6818",
+				File:          ioutil.NopCloser(bytes.NewBufferString(content)),
+			}
+		}
+		It("returns a single range", func() {
+			resp := srv.Get(resource, ops.GetOptions{Range: "bytes=2-4"})
+			Expect(resp).To(Equal(partial("bytes 2-4/8", "cde")))
+			Expect(resp.HTTPStatus()).To(Equal(206))
+		})
+		It("truncates a range past the end of the object", func() {
+			Expect(srv.Get(resource, ops.GetOptions{Range: "bytes=6-100"})).To(Equal(partial("bytes 6-7/8", "gh")))
+		})
+		It("returns an open-ended range", func() {
+			Expect(srv.Get(resource, ops.GetOptions{Range: "bytes=5-"})).To(Equal(partial("bytes 5-7/8", "fgh")))
+		})
+		It("returns a suffix range", func() {
+			Expect(srv.Get(resource, ops.GetOptions{Range: "bytes=-3"})).To(Equal(partial("bytes 5-7/8", "fgh")))
+			Expect(srv.Get(resource, ops.GetOptions{Range: "bytes=-20"})).To(Equal(partial("bytes 0-7/8", "abcdefgh")))
+		})
+		It("returns InvalidRange for an unsatisfiable range", func() {
+			Expect(srv.Get(resource, ops.GetOptions{Range: "bytes=8-"})).
+				To(Equal(s3.InvalidRange("The requested range is not satisfiable")))
+			Expect(srv.Head(resource, ops.GetOptions{Range: "bytes=-0"})).
+				To(Equal(s3.InvalidRange("The requested range is not satisfiable")))
+		})
+		It("ignores malformed and multiple ranges like S3", func() {
+			for _, value := range []string{"bytes=0-1,3-4", "lines=1-2", "bytes=4-2"} {
+				resp := srv.Head(resource, ops.GetOptions{Range: value})
+				Expect(resp.HTTPStatus()).To(Equal(200))
+				Expect(resp.(s3.Object).ContentLength).To(Equal(int64(8)))
+			}
+		})
+		It("does not allow both Range and partNumber", func() {
+			Expect(srv.Get(resource, ops.GetOptions{Range: "bytes=0-1", PartNumber: "1"})).
+				To(Equal(s3.InvalidRequest("Cannot specify both Range header and partNumber query parameter")))
+		})
+		Context("with partNumber", func() {
+			It("returns the whole object as part 1 of a simple object", func() {
+				Expect(srv.Get(resource, ops.GetOptions{PartNumber: "1"})).To(Equal(partial("bytes 0-7/8", "abcdefgh")))
+				Expect(srv.Get(resource, ops.GetOptions{PartNumber: "2"})).
+					To(Equal(s3.InvalidPartNumber("The requested partnumber is not satisfiable")))
+			})
+			It("returns the part of a multipart object", func() {
+				db.Put(resource, meta.ObjectData{
+					ContentMD5:   "79dbf75f22adb39ddf80d25287707c6e",
+					Size:         8,
+					LastModified: fixtures.Time1,
+					PartSizes:    []int64{5, 3},
+				})
+				Expect(srv.Get(resource, ops.GetOptions{PartNumber: "2"})).To(Equal(s3.Object{
+					ContentLength: 3,
+					ContentRange:  "bytes 5-7/8",
+					PartsCount:    2,
+					LastModified:  "2014-05-06T03:02:01Z",
+					ETag:          "79dbf75f22adb39ddf80d25287707c6e-2",
+					File:          ioutil.NopCloser(bytes.NewBufferString("fgh")),
+				}))
+				Expect(srv.Get(resource, ops.GetOptions{PartNumber: "3"})).
+					To(Equal(s3.InvalidPartNumber("The requested partnumber is not satisfiable")))
+			})
+		})
+	})
+
+	Describe("Head with conditions", func() {
+		var resource = s3.NewResource("foo", "bar.txt")
+		BeforeEach(func() {
+			db.CreateBucket("foo", meta.BucketData{CreationDate: fixtures.Time1})
+			store.CreateBucket("foo")
+			db.Put(resource, meta.ObjectData{
+				ContentMD5:   "e8dc4081b13434b45189a720b77b6818",
+				Size:         8,
+				LastModified: fixtures.Time1,
+			})
+			store.Buckets["foo"]["bar.txt"] = bytes.NewBufferString("abcdefgh")
+		})
+		head := func(conditions ops.Conditions) s3.Response {
+			return srv.Head(resource, ops.GetOptions{Conditions: conditions})
+		}
+		const (
+			etag    = `"e8dc4081b13434b45189a720b77b6818"`
+			before  = "Mon, 05 May 2014 03:02:01 GMT"
+			current = "Tue, 06 May 2014 03:02:01 GMT"
+		)
+		preconditionFailed := s3.PreconditionFailed("At least one of the pre-conditions you specified did not hold")
+		notModified := s3.NotModified("e8dc4081b13434b45189a720b77b6818", "2014-05-06T03:02:01Z")
+
+		It("returns the object when If-Match matches", func() {
+			Expect(head(ops.Conditions{IfMatch: etag}).HTTPStatus()).To(Equal(200))
+			Expect(head(ops.Conditions{IfMatch: `"other", ` + etag}).HTTPStatus()).To(Equal(200))
+			Expect(head(ops.Conditions{IfMatch: "*"}).HTTPStatus()).To(Equal(200))
+		})
+		It("returns PreconditionFailed when If-Match does not match", func() {
+			Expect(head(ops.Conditions{IfMatch: `"other"`})).To(Equal(preconditionFailed))
+		})
+		It("returns PreconditionFailed when modified since If-Unmodified-Since", func() {
+			Expect(head(ops.Conditions{IfUnmodifiedSince: before})).To(Equal(preconditionFailed))
+			Expect(head(ops.Conditions{IfUnmodifiedSince: current}).HTTPStatus()).To(Equal(200))
+		})
+		It("prefers a matching If-Match over a failing If-Unmodified-Since", func() {
+			Expect(head(ops.Conditions{IfMatch: etag, IfUnmodifiedSince: before}).HTTPStatus()).To(Equal(200))
+		})
+		It("returns NotModified when If-None-Match matches", func() {
+			Expect(head(ops.Conditions{IfNoneMatch: etag})).To(Equal(notModified))
+			Expect(head(ops.Conditions{IfNoneMatch: `"other"`}).HTTPStatus()).To(Equal(200))
+		})
+		It("returns NotModified when not modified since If-Modified-Since", func() {
+			Expect(head(ops.Conditions{IfModifiedSince: current})).To(Equal(notModified))
+			Expect(head(ops.Conditions{IfModifiedSince: before}).HTTPStatus()).To(Equal(200))
+		})
+		It("prefers a non-matching If-None-Match over a failing If-Modified-Since", func() {
+			Expect(head(ops.Conditions{IfNoneMatch: `"other"`, IfModifiedSince: current}).HTTPStatus()).To(Equal(200))
+		})
+		It("ignores invalid dates", func() {
+			Expect(head(ops.Conditions{IfModifiedSince: "yesterday"}).HTTPStatus()).To(Equal(200))
+		})
+		It("evaluates conditions before the range", func() {
+			Expect(srv.Get(resource, ops.GetOptions{
+				Conditions: ops.Conditions{IfNoneMatch: etag},
+				Range:      "bytes=100-",
+			})).To(Equal(notModified))
+		})
+	})
+
 	Describe("Head", func() {
 		Context("when bucket does not exist", func() {
 			It("returns a 404 not found response", func() {
-				Expect(srv.Head(s3.NewResource("foo", "bar.txt"))).To(Equal(s3.NoSuchBucket("foo")))
+				Expect(srv.Head(s3.NewResource("foo", "bar.txt"), ops.GetOptions{})).To(Equal(s3.NoSuchBucket("foo")))
 			})
 		})
 		Context("when bucket exists", func() {
@@ -82,7 +252,7 @@ var _ = Describe("ObjectService", func() {
 			})
 			Context("but key does not", func() {
 				It("returns a 404 not found response", func() {
-					Expect(srv.Head(s3.NewResource("foo", "bar.txt"))).To(Equal(s3.NoSuchKey("bar.txt")))
+					Expect(srv.Head(s3.NewResource("foo", "bar.txt"), ops.GetOptions{})).To(Equal(s3.NoSuchKey("bar.txt")))
 				})
 			})
 			Context("and key exists", func() {
@@ -94,7 +264,7 @@ var _ = Describe("ObjectService", func() {
 					store.Buckets["foo"]["bar.txt"] = bytes.NewBufferString("baz")
 				})
 				It("returns an object response", func() {
-					Expect(srv.Head(s3.NewResource("foo", "bar.txt"))).To(Equal(s3.Object{
+					Expect(srv.Head(s3.NewResource("foo", "bar.txt"), ops.GetOptions{})).To(Equal(s3.Object{
 						ContentLength: 3,
 						LastModified:  "2014-05-06T03:02:01Z",
 						ETag:          "content-md5[baz]",
@@ -107,7 +277,7 @@ var _ = Describe("ObjectService", func() {
 	Describe("Put", func() {
 		Context("when bucket does not exist", func() {
 			It("returns a 404 not found response", func() {
-				Expect(srv.Put(s3.NewResource("foo", "bar.txt"), "plain/text", stringBody("baz"))).
+				Expect(srv.Put(s3.NewResource("foo", "bar.txt"), ops.PutOptions{Metadata: ops.Metadata{ContentType: "plain/text"}}, stringBody("baz"))).
 					To(Equal(s3.NoSuchBucket("foo")))
 			})
 		})
@@ -119,8 +289,226 @@ var _ = Describe("ObjectService", func() {
 			})
 
 			It("creates the object", func() {
-				Expect(srv.Put(s3.NewResource("foo", "bar.txt"), "plain/text", stringBody("baz"))).
+				Expect(srv.Put(s3.NewResource("foo", "bar.txt"), ops.PutOptions{Metadata: ops.Metadata{ContentType: "plain/text"}}, stringBody("baz"))).
 					To(Equal(s3.Created(s3.NewETag("73feffa4b7f6bb68e44cf984c85f6e88"))))
+				Expect(store.Buckets["foo"]["bar.txt"].String()).To(Equal("baz"))
+				Expect(store.Buckets[".staging"]).To(BeEmpty())
+			})
+		})
+
+		Context("with metadata", func() {
+			var resource = s3.NewResource("foo", "bar.txt")
+			BeforeEach(func() {
+				db.CreateBucket("foo", meta.BucketData{CreationDate: fixtures.Time1})
+				store.CreateBucket("foo")
+			})
+
+			It("returns the metadata on GET and HEAD", func() {
+				clock.Add(fixtures.Time1)
+				srv.Put(resource, ops.PutOptions{Metadata: ops.Metadata{
+					ContentType:        "plain/text",
+					CacheControl:       "no-cache",
+					ContentDisposition: "attachment",
+					ContentEncoding:    "gzip",
+					ContentLanguage:    "en",
+					Expires:            "Thu, 01 Dec 2094 16:00:00 GMT",
+					UserDefined:        map[string]string{"flavor": "server"},
+				}}, stringBody("baz"))
+				expected := s3.Object{
+					ContentLength:      3,
+					ContentType:        "plain/text",
+					LastModified:       "2014-05-06T03:02:01Z",
+					CacheControl:       "no-cache",
+					ContentDisposition: "attachment",
+					ContentEncoding:    "gzip",
+					ContentLanguage:    "en",
+					Expires:            "Thu, 01 Dec 2094 16:00:00 GMT",
+					ETag:               "73feffa4b7f6bb68e44cf984c85f6e88",
+					UserDefined:        map[string]string{"flavor": "server"},
+				}
+				Expect(srv.Head(resource, ops.GetOptions{})).To(Equal(expected))
+				expected.File = ioutil.NopCloser(bytes.NewBufferString("baz"))
+				Expect(srv.Get(resource, ops.GetOptions{})).To(Equal(expected))
+			})
+			It("returns MetadataTooLarge over 2KB of user-defined metadata", func() {
+				opts := ops.PutOptions{Metadata: ops.Metadata{
+					UserDefined: map[string]string{"big": strings.Repeat("a", 2046)},
+				}}
+				Expect(srv.Put(resource, opts, stringBody("baz"))).
+					To(Equal(s3.MetadataTooLarge("Your metadata headers exceed the maximum allowed metadata size.")))
+				Expect(db.Buckets["foo"].Objects).To(BeEmpty())
+			})
+		})
+
+		Context("with digests", func() {
+			var resource = s3.NewResource("foo", "bar.txt")
+			const (
+				bazMD5    = "c/7/pLf2u2jkTPmEyF9uiA=="
+				bazSHA256 = "baa5a0964d3320fbc0c6a922140453c8513ea24ab8fd0577034804a967248096"
+			)
+			put := func(digests ops.Digests, content string) s3.Response {
+				return srv.Put(resource, ops.PutOptions{Digests: digests}, stringBody(content))
+			}
+			BeforeEach(func() {
+				db.CreateBucket("foo", meta.BucketData{CreationDate: fixtures.Time1})
+				store.CreateBucket("foo")
+				db.Put(resource, meta.ObjectData{ContentMD5: "e8dc4081b13434b45189a720b77b6818", Size: 8})
+				store.Buckets["foo"]["bar.txt"] = bytes.NewBufferString("abcdefgh")
+			})
+
+			It("accepts a body matching its digests", func() {
+				Expect(put(ops.Digests{ContentMD5: bazMD5, ContentSHA256: bazSHA256}, "baz")).
+					To(Equal(s3.Created(s3.NewETag("73feffa4b7f6bb68e44cf984c85f6e88"))))
+				Expect(put(ops.Digests{ContentSHA256: "UNSIGNED-PAYLOAD"}, "baz").HTTPStatus()).To(Equal(200))
+			})
+			It("returns BadDigest when the body does not match Content-MD5", func() {
+				Expect(put(ops.Digests{ContentMD5: bazMD5}, "qux")).
+					To(Equal(s3.BadDigest("The Content-MD5 you specified did not match what we received.")))
+			})
+			It("returns XAmzContentSHA256Mismatch when the body does not match x-amz-content-sha256", func() {
+				Expect(put(ops.Digests{ContentSHA256: bazSHA256}, "qux")).
+					To(Equal(s3.XAmzContentSHA256Mismatch("The provided 'x-amz-content-sha256' header does not match what was computed.")))
+			})
+			It("leaves the existing object untouched on mismatch", func() {
+				put(ops.Digests{ContentMD5: bazMD5}, "qux")
+				Expect(db.Buckets["foo"].Objects["bar.txt"].ContentMD5).To(Equal("e8dc4081b13434b45189a720b77b6818"))
+				Expect(store.Buckets["foo"]["bar.txt"].String()).To(Equal("abcdefgh"))
+				Expect(store.Buckets[".staging"]).To(BeEmpty())
+			})
+			It("rejects malformed digests", func() {
+				Expect(put(ops.Digests{ContentMD5: "73feffa4b7f6bb68e44cf984c85f6e88"}, "baz")).
+					To(Equal(s3.InvalidDigest("73feffa4b7f6bb68e44cf984c85f6e88")))
+				Expect(put(ops.Digests{ContentSHA256: "baz"}, "baz").(s3.ErrorResponse).Code).To(Equal("InvalidArgument"))
+			})
+		})
+
+		Context("with checksums", func() {
+			var resource = s3.NewResource("foo", "bar.txt")
+			checksums := map[string]string{
+				"CRC32":     "eCQEmA==",
+				"CRC32C":    "gG5L/g==",
+				"CRC64NVME": "LF4AWqlYyh8=",
+				"SHA1":      "u+lgol6jEdIdQGaek98gA7qbkKI=",
+				"SHA256":    "uqWglk0zIPvAxqkiFARTyFE+okq4/QV3A0gEqWckgJY=",
+			}
+			BeforeEach(func() {
+				db.CreateBucket("foo", meta.BucketData{CreationDate: fixtures.Time1})
+				store.CreateBucket("foo")
+			})
+
+			It("verifies, stores and returns each algorithm", func() {
+				for algorithm, checksum := range checksums {
+					digests := ops.Digests{Checksums: map[string]string{algorithm: checksum}}
+					resp := srv.Put(resource, ops.PutOptions{Digests: digests}, stringBody("baz"))
+					Expect(resp.(s3.SimpleResponse).Header.Get(s3.ChecksumHeader(algorithm))).To(Equal(checksum))
+
+					head := srv.Head(resource, ops.GetOptions{ChecksumMode: "ENABLED"}).(s3.Object)
+					Expect(head.ChecksumAlgorithm).To(Equal(algorithm))
+					Expect(head.Checksum).To(Equal(checksum))
+					Expect(head.ChecksumType).To(Equal("FULL_OBJECT"))
+				}
+			})
+			It("computes the checksum named by x-amz-sdk-checksum-algorithm", func() {
+				srv.Put(resource, ops.PutOptions{Digests: ops.Digests{ChecksumAlgorithm: "CRC32C"}}, stringBody("baz"))
+				Expect(db.Buckets["foo"].Objects["bar.txt"].Checksum).To(Equal("gG5L/g=="))
+			})
+			It("only returns the checksum when asked to", func() {
+				srv.Put(resource, ops.PutOptions{Digests: ops.Digests{ChecksumAlgorithm: "CRC32"}}, stringBody("baz"))
+				Expect(srv.Head(resource, ops.GetOptions{}).(s3.Object).Checksum).To(BeEmpty())
+			})
+			It("returns BadDigest when the body does not match", func() {
+				digests := ops.Digests{Checksums: map[string]string{"SHA1": checksums["SHA1"]}}
+				Expect(srv.Put(resource, ops.PutOptions{Digests: digests}, stringBody("qux"))).
+					To(Equal(s3.BadDigest("The SHA1 you specified did not match the calculated checksum.")))
+				Expect(db.Buckets["foo"].Objects).To(BeEmpty())
+			})
+			It("verifies a checksum sent in the trailer of the body", func() {
+				trailer := http.Header{}
+				trailer.Set(s3.ChecksumHeader("CRC32"), checksums["CRC32"])
+				digests := ops.Digests{ChecksumAlgorithm: "CRC32", Trailer: trailer}
+				Expect(srv.Put(resource, ops.PutOptions{Digests: digests}, stringBody("baz")).(s3.SimpleResponse).Header.Get(s3.ChecksumHeader("CRC32"))).
+					To(Equal(checksums["CRC32"]))
+				Expect(srv.Put(resource, ops.PutOptions{Digests: digests}, stringBody("qux"))).
+					To(Equal(s3.BadDigest("The CRC32 you specified did not match the calculated checksum.")))
+			})
+			It("rejects an invalid checksum in the trailer", func() {
+				trailer := http.Header{}
+				trailer.Set(s3.ChecksumHeader("CRC32"), "eCQE")
+				digests := ops.Digests{ChecksumAlgorithm: "CRC32", Trailer: trailer}
+				Expect(srv.Put(resource, ops.PutOptions{Digests: digests}, stringBody("baz"))).
+					To(Equal(s3.InvalidRequest("Value for x-amz-checksum-crc32 header is invalid.")))
+			})
+			It("returns the error of a body that fails to be read", func() {
+				body := ioutil.NopCloser(io.MultiReader(strings.NewReader("baz"), errReader{s3.IncompleteBody("The request body terminated unexpectedly")}))
+				Expect(srv.Put(resource, ops.PutOptions{}, body)).
+					To(Equal(s3.IncompleteBody("The request body terminated unexpectedly")))
+				Expect(db.Buckets["foo"].Objects).To(BeEmpty())
+			})
+			It("rejects invalid checksum headers", func() {
+				invalid := []ops.Digests{
+					{Checksums: map[string]string{"CRC32": "eCQE"}},
+					{Checksums: map[string]string{"CRC32": checksums["CRC32"], "SHA1": checksums["SHA1"]}},
+					{ChecksumAlgorithm: "MD5"},
+					{ChecksumAlgorithm: "SHA1", Checksums: map[string]string{"CRC32": checksums["CRC32"]}},
+				}
+				for _, digests := range invalid {
+					resp := srv.Put(resource, ops.PutOptions{Digests: digests}, stringBody("baz"))
+					Expect(resp.(s3.ErrorResponse).Code).To(Equal("InvalidRequest"))
+				}
+			})
+		})
+
+		Context("with conditions", func() {
+			var resource = s3.NewResource("foo", "bar.txt")
+			const etag = `"73feffa4b7f6bb68e44cf984c85f6e88"`
+			preconditionFailed := s3.PreconditionFailed("At least one of the pre-conditions you specified did not hold")
+			put := func(conditions ops.Conditions, content string) s3.Response {
+				return srv.Put(resource, ops.PutOptions{Conditions: conditions}, stringBody(content))
+			}
+			BeforeEach(func() {
+				db.CreateBucket("foo", meta.BucketData{CreationDate: fixtures.Time1})
+				store.CreateBucket("foo")
+			})
+
+			It("creates only when If-None-Match: * finds no object", func() {
+				Expect(put(ops.Conditions{IfNoneMatch: "*"}, "baz").HTTPStatus()).To(Equal(200))
+				Expect(put(ops.Conditions{IfNoneMatch: "*"}, "qux")).To(Equal(preconditionFailed))
+				Expect(store.Buckets["foo"]["bar.txt"].String()).To(Equal("baz"))
+				Expect(store.Buckets[".staging"]).To(BeEmpty())
+			})
+			It("only supports * for If-None-Match", func() {
+				Expect(put(ops.Conditions{IfNoneMatch: etag}, "baz").(s3.ErrorResponse).Code).To(Equal("NotImplemented"))
+			})
+			It("replaces only when If-Match matches", func() {
+				put(ops.Conditions{}, "baz")
+				Expect(put(ops.Conditions{IfMatch: `"other"`}, "qux")).To(Equal(preconditionFailed))
+				Expect(put(ops.Conditions{IfMatch: etag}, "qux").HTTPStatus()).To(Equal(200))
+				Expect(store.Buckets["foo"]["bar.txt"].String()).To(Equal("qux"))
+			})
+			It("returns NoSuchKey for If-Match when there is no object", func() {
+				Expect(put(ops.Conditions{IfMatch: etag}, "baz")).To(Equal(s3.NoSuchKey("bar.txt")))
+			})
+			It("returns ConditionalRequestConflict when a concurrent write wins", func() {
+				body := &racingBody{Reader: strings.NewReader("qux"), race: func() { put(ops.Conditions{}, "baz") }}
+				resp := srv.Put(resource, ops.PutOptions{Conditions: ops.Conditions{IfNoneMatch: "*"}}, body)
+				Expect(resp.(s3.ErrorResponse).Code).To(Equal("ConditionalRequestConflict"))
+				Expect(resp.HTTPStatus()).To(Equal(409))
+				Expect(store.Buckets["foo"]["bar.txt"].String()).To(Equal("baz"))
+				Expect(store.Buckets[".staging"]).To(BeEmpty())
+			})
+			It("keeps the object it replaces when the write fails to be recorded", func() {
+				put(ops.Conditions{}, "baz")
+				db.CommitErr = errors.New("commit failed")
+				Expect(put(ops.Conditions{IfMatch: etag}, "qux").(s3.ErrorResponse).Code).To(Equal("InternalError"))
+				Expect(store.Buckets["foo"]["bar.txt"].String()).To(Equal("baz"))
+				Expect(db.Buckets["foo"].Objects["bar.txt"].ContentMD5).To(Equal("73feffa4b7f6bb68e44cf984c85f6e88"))
+				Expect(store.Buckets[".staging"]).To(BeEmpty())
+
+				delete(db.Buckets["foo"].Objects, "bar.txt")
+				delete(store.Buckets["foo"], "bar.txt")
+				Expect(put(ops.Conditions{}, "qux").(s3.ErrorResponse).Code).To(Equal("InternalError"))
+				Expect(store.Buckets["foo"]).NotTo(HaveKey("bar.txt"))
+				Expect(store.Buckets[".staging"]).To(BeEmpty())
 			})
 		})
 	})
@@ -128,7 +516,7 @@ var _ = Describe("ObjectService", func() {
 	Describe("Copy", func() {
 		Context("when source bucket does not exist", func() {
 			It("returns a 404 not found", func() {
-				Expect(srv.Copy(s3.NewResource("foo1", "bar1.txt"), s3.NewResource("foo2", "bar2.txt"))).
+				Expect(srv.Copy(s3.NewResource("foo1", "bar1.txt"), s3.NewResource("foo2", "bar2.txt"), ops.CopyOptions{})).
 					To(Equal(s3.NoSuchBucket("foo1")))
 			})
 		})
@@ -139,7 +527,7 @@ var _ = Describe("ObjectService", func() {
 			})
 			Context("but source key does not", func() {
 				It("returns a 404 not found", func() {
-					Expect(srv.Copy(s3.NewResource("foo1", "bar1.txt"), s3.NewResource("foo2", "bar2.txt"))).
+					Expect(srv.Copy(s3.NewResource("foo1", "bar1.txt"), s3.NewResource("foo2", "bar2.txt"), ops.CopyOptions{})).
 						To(Equal(s3.NoSuchKey("bar1.txt")))
 				})
 			})
@@ -153,7 +541,7 @@ var _ = Describe("ObjectService", func() {
 				})
 				Context("but destination bucket does not", func() {
 					It("returns a 404 not found", func() {
-						Expect(srv.Copy(s3.NewResource("foo1", "bar1.txt"), s3.NewResource("foo2", "bar2.txt"))).
+						Expect(srv.Copy(s3.NewResource("foo1", "bar1.txt"), s3.NewResource("foo2", "bar2.txt"), ops.CopyOptions{})).
 							To(Equal(s3.NoSuchBucket("foo2")))
 					})
 				})
@@ -164,7 +552,7 @@ var _ = Describe("ObjectService", func() {
 					})
 					It("copies the file", func() {
 						clock.Add(fixtures.Time2)
-						Expect(srv.Copy(s3.NewResource("foo1", "bar1.txt"), s3.NewResource("foo2", "bar2.txt"))).
+						Expect(srv.Copy(s3.NewResource("foo1", "bar1.txt"), s3.NewResource("foo2", "bar2.txt"), ops.CopyOptions{})).
 							To(Equal(s3.CopyObjectResult{
 								LastModified: "2015-06-07T04:03:02Z",
 								ETag:         "content-md5[baz]",
@@ -176,6 +564,76 @@ var _ = Describe("ObjectService", func() {
 						Expect(store.Buckets["foo2"]["bar2.txt"]).To(Equal(store.Buckets["foo1"]["bar1.txt"]))
 					})
 				})
+				Context("with options", func() {
+					var src = s3.NewResource("foo1", "bar1.txt")
+					var dst = s3.NewResource("foo1", "bar2.txt")
+					preconditionFailed := s3.PreconditionFailed("At least one of the pre-conditions you specified did not hold")
+					BeforeEach(func() {
+						clock.Add(fixtures.Time2)
+						db.Put(src, meta.ObjectData{
+							ContentMD5:   "content-md5[baz]",
+							ContentType:  "plain/text",
+							LastModified: fixtures.Time1,
+							UserDefined:  map[string]string{"flavor": "server"},
+							Tags:         map[string]string{"release": "zesty"},
+						})
+					})
+
+					It("does not allow copying an object onto itself without REPLACE", func() {
+						Expect(srv.Copy(src, src, ops.CopyOptions{MetadataDirective: "COPY"})).
+							To(Equal(s3.InvalidRequest("This copy request is illegal because it is trying to copy an object to itself without changing the object's metadata, storage class, website redirect location or encryption attributes.")))
+					})
+					It("replaces metadata in place with REPLACE", func() {
+						resp := srv.Copy(src, src, ops.CopyOptions{
+							MetadataDirective: "REPLACE",
+							Metadata:          ops.Metadata{ContentType: "application/json"},
+						})
+						Expect(resp.HTTPStatus()).To(Equal(200))
+						Expect(db.Buckets["foo1"].Objects["bar1.txt"]).To(Equal(meta.ObjectData{
+							ContentMD5:   "content-md5[baz]",
+							ContentType:  "application/json",
+							LastModified: fixtures.Time2,
+							Tags:         map[string]string{"release": "zesty"},
+						}))
+						Expect(store.Buckets["foo1"]["bar1.txt"].String()).To(Equal("baz"))
+					})
+					It("replaces tags with a REPLACE tagging directive", func() {
+						srv.Copy(src, dst, ops.CopyOptions{
+							TaggingDirective: "REPLACE",
+							Metadata:         ops.Metadata{ContentType: "ignored", Tags: map[string]string{"release": "artful"}},
+						})
+						Expect(db.Buckets["foo1"].Objects["bar2.txt"]).To(Equal(meta.ObjectData{
+							ContentMD5:   "content-md5[baz]",
+							ContentType:  "plain/text",
+							LastModified: fixtures.Time2,
+							UserDefined:  map[string]string{"flavor": "server"},
+							Tags:         map[string]string{"release": "artful"},
+						}))
+					})
+					It("rejects an unknown directive", func() {
+						Expect(srv.Copy(src, dst, ops.CopyOptions{MetadataDirective: "MERGE"})).
+							To(Equal(s3.InvalidArgument("Unknown metadata directive.", "x-amz-metadata-directive", "MERGE")))
+						Expect(srv.Copy(src, dst, ops.CopyOptions{TaggingDirective: "replace"})).
+							To(Equal(s3.InvalidArgument("Unknown tagging directive.", "x-amz-tagging-directive", "replace")))
+					})
+					It("evaluates conditions against the source", func() {
+						Expect(srv.Copy(src, dst, ops.CopyOptions{SourceConditions: ops.Conditions{IfMatch: `"other"`}})).
+							To(Equal(preconditionFailed))
+						Expect(srv.Copy(src, dst, ops.CopyOptions{SourceConditions: ops.Conditions{IfNoneMatch: `"content-md5[baz]"`}})).
+							To(Equal(preconditionFailed))
+						Expect(srv.Copy(src, dst, ops.CopyOptions{SourceConditions: ops.Conditions{IfModifiedSince: "Tue, 06 May 2014 03:02:01 GMT"}})).
+							To(Equal(preconditionFailed))
+						Expect(db.Buckets["foo1"].Objects).ToNot(HaveKey("bar2.txt"))
+						Expect(srv.Copy(src, dst, ops.CopyOptions{SourceConditions: ops.Conditions{IfMatch: `"content-md5[baz]"`}}).HTTPStatus()).
+							To(Equal(200))
+					})
+					It("copies only the requested version of the source", func() {
+						Expect(srv.Copy(src, dst, ops.CopyOptions{SourceVersionID: "3HL4kqtJlcpXroDTDmJ+rmSpXd3dIbrHY"})).
+							To(Equal(s3.NoSuchVersion("The specified version does not exist.")))
+						Expect(srv.Copy(src, dst, ops.CopyOptions{SourceVersionID: "null"}).HTTPStatus()).
+							To(Equal(200))
+					})
+				})
 			})
 		})
 	})
@@ -183,7 +641,7 @@ var _ = Describe("ObjectService", func() {
 	Describe("Delete", func() {
 		Context("when bucket does not exist", func() {
 			It("returns a 404 error", func() {
-				Expect(srv.Delete(s3.NewResource("foo", "bar.txt"))).
+				Expect(srv.Delete(s3.NewResource("foo", "bar.txt"), "")).
 					To(Equal(s3.NoSuchBucket("foo")))
 			})
 		})
@@ -194,7 +652,7 @@ var _ = Describe("ObjectService", func() {
 			})
 			Context("but object does not", func() {
 				It("does not return an error", func() {
-					Expect(srv.Delete(s3.NewResource("foo", "bar.txt"))).
+					Expect(srv.Delete(s3.NewResource("foo", "bar.txt"), "")).
 						To(Equal(s3.NoContent()))
 				})
 			})
@@ -207,7 +665,7 @@ var _ = Describe("ObjectService", func() {
 					store.Buckets["foo"]["bar.txt"] = bytes.NewBufferString("baz")
 				})
 				It("deletes the object", func() {
-					Expect(srv.Delete(s3.NewResource("foo", "bar.txt"))).
+					Expect(srv.Delete(s3.NewResource("foo", "bar.txt"), "")).
 						To(Equal(s3.NoContent()))
 					Expect(db.Buckets["foo"].Objects).To(BeEmpty())
 					Expect(store.Buckets["foo"]).To(BeEmpty())
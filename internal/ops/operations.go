@@ -8,19 +8,54 @@ import (
 )
 
 type ServiceOperations interface {
-	ListBuckets() s3.Response
+	ListBuckets(owner s3.OwnerResult) s3.Response
 }
 
 type BucketOperations interface {
-	Create(bucket string) s3.Response
+	Create(bucket string, ownership Ownership, body io.Reader) s3.Response
+	Head(bucket string) s3.Response
 	Delete(bucket string) s3.Response
+	// ForceDelete deletes a bucket that is not empty, for admins.
+	ForceDelete(bucket string) s3.Response
+	DeleteObjects(bucket string, digests Digests, authorize Authorizer, body io.Reader) s3.Response
 	ListBucket(bucket string, query url.Values) s3.Response
+	ListBucketV2(bucket string, query url.Values) s3.Response
+	ListMultipartUploads(bucket string, query url.Values) s3.Response
+	ListObjectVersions(bucket string, query url.Values) s3.Response
+	GetPolicy(bucket string) s3.Response
+	PutPolicy(bucket string, body io.Reader) s3.Response
+	DeletePolicy(bucket string) s3.Response
+	GetACL(bucket string) s3.Response
+	PutACL(bucket string, acl ACL, body io.Reader) s3.Response
+	GetLocation(bucket string) s3.Response
+	GetVersioning(bucket string) s3.Response
+	PutVersioning(bucket string, body io.Reader) s3.Response
 }
 
 type ObjectOperations interface {
-	Get(resource s3.Resource) s3.Response
-	Head(resource s3.Resource) s3.Response
-	Put(resource s3.Resource, contentType string, body io.ReadCloser) s3.Response
-	Copy(src, dst s3.Resource) s3.Response
-	Delete(resource s3.Resource) s3.Response
+	Get(resource s3.Resource, opts GetOptions) s3.Response
+	Head(resource s3.Resource, opts GetOptions) s3.Response
+	Put(resource s3.Resource, opts PutOptions, body io.ReadCloser) s3.Response
+	Copy(src, dst s3.Resource, opts CopyOptions) s3.Response
+	Delete(resource s3.Resource, versionID string) s3.Response
+	GetACL(resource s3.Resource, versionID string) s3.Response
+	PutACL(resource s3.Resource, versionID string, acl ACL, body io.Reader) s3.Response
+	CreateMultipartUpload(resource s3.Resource, md Metadata, checksumAlgorithm string, ownership Ownership) s3.Response
+	UploadPart(resource s3.Resource, uploadID, partNumber string, digests Digests, body io.ReadCloser) s3.Response
+	UploadPartCopy(src, dst s3.Resource, srcVersionID string, srcConds Conditions, uploadID, partNumber, copyRange string) s3.Response
+	CompleteMultipartUpload(resource s3.Resource, uploadID string, conds Conditions, body io.ReadCloser) s3.Response
+	AbortMultipartUpload(resource s3.Resource, uploadID string) s3.Response
+	ListParts(resource s3.Resource, uploadID string, query url.Values) s3.Response
+}
+
+type STSOperations interface {
+	AssumeRole(parent s3.Credential, roleArn, sessionName, durationSeconds string) s3.Response
+	GetSessionToken(parent s3.Credential, durationSeconds string) s3.Response
+	// Session looks up temporary credentials by their access key.
+	Session(accessKeyID string) (s3.Credential, bool)
+}
+
+type AccessOperations interface {
+	// Authorize returns AccessDenied when req may not go ahead.
+	Authorize(req AccessRequest) s3.Response
 }
@@ -0,0 +1,68 @@
+package ops
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ophymx/s3d/internal/meta"
+	"github.com/ophymx/s3d/internal/policy"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+// maxPolicySize is the largest bucket policy S3 accepts.
+const maxPolicySize = 20 * 1024
+
+func (srv bucketOps) GetPolicy(bucket string) s3.Response {
+	data, err := srv.db.GetBucket(bucket)
+	if err == meta.ErrBucketNotFound {
+		return s3.NoSuchBucket(bucket)
+	} else if err != nil {
+		return s3.InternalError(err)
+	}
+	if data.Policy == "" {
+		return s3.NoSuchBucketPolicy("The bucket policy does not exist")
+	}
+	return s3.SimpleResponse{
+		Status: http.StatusOK,
+		Header: http.Header{s3.HdrContentType: []string{"application/json"}},
+		Body:   []byte(data.Policy),
+	}
+}
+
+func (srv bucketOps) PutPolicy(bucket string, body io.Reader) s3.Response {
+	doc, err := ioutil.ReadAll(io.LimitReader(body, maxPolicySize+1))
+	if err != nil {
+		return s3.InternalError(err)
+	}
+	if len(doc) > maxPolicySize {
+		return s3.MalformedPolicy("Policy exceeds the maximum allowed document size.")
+	}
+	if _, err = policy.ParseBucketPolicy(doc, bucket); err != nil {
+		return s3.MalformedPolicy(err.Error())
+	}
+	return srv.updateBucket(bucket, func(data *meta.BucketData) {
+		data.Policy = string(doc)
+	})
+}
+
+func (srv bucketOps) DeletePolicy(bucket string) s3.Response {
+	return srv.updateBucket(bucket, func(data *meta.BucketData) {
+		data.Policy = ""
+	})
+}
+
+// updateBucket applies update to the metadata of bucket.
+func (srv bucketOps) updateBucket(bucket string, update func(data *meta.BucketData)) s3.Response {
+	data, err := srv.db.GetBucket(bucket)
+	if err == meta.ErrBucketNotFound {
+		return s3.NoSuchBucket(bucket)
+	} else if err != nil {
+		return s3.InternalError(err)
+	}
+	update(&data)
+	if err = srv.db.PutBucket(bucket, data); err != nil {
+		return s3.InternalError(err)
+	}
+	return s3.NoContent()
+}
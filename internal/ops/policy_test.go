@@ -0,0 +1,68 @@
+package ops_test
+
+import (
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/ophymx/s3d/internal/fakes"
+	"github.com/ophymx/s3d/internal/fixtures"
+	"github.com/ophymx/s3d/internal/meta"
+	"github.com/ophymx/s3d/internal/ops"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+var _ = Describe("Bucket policy", func() {
+	var (
+		db  *fakes.DB
+		srv ops.BucketOperations
+	)
+	BeforeEach(func() {
+		db = fakes.NewDB()
+		srv = ops.NewBucket(db, fakes.NewStore(), fakes.NewClock(fixtures.Time1))
+	})
+
+	Context("when the bucket does not exist", func() {
+		It("returns NoSuchBucket", func() {
+			Expect(srv.GetPolicy("foo")).To(Equal(s3.NoSuchBucket("foo")))
+			Expect(srv.PutPolicy("foo", stringBody(fixtures.BucketPolicy))).To(Equal(s3.NoSuchBucket("foo")))
+			Expect(srv.DeletePolicy("foo")).To(Equal(s3.NoSuchBucket("foo")))
+		})
+	})
+
+	Context("when the bucket exists", func() {
+		BeforeEach(func() {
+			db.Buckets["foo"] = fakes.NewBucket(meta.BucketData{CreationDate: fixtures.Time1})
+		})
+
+		It("returns NoSuchBucketPolicy when none is set", func() {
+			Expect(srv.GetPolicy("foo")).To(Equal(s3.NoSuchBucketPolicy("The bucket policy does not exist")))
+		})
+		It("stores, returns and deletes the policy", func() {
+			Expect(srv.PutPolicy("foo", stringBody(fixtures.BucketPolicy))).To(Equal(s3.NoContent()))
+			Expect(db.Buckets["foo"].Meta).To(Equal(meta.BucketData{CreationDate: fixtures.Time1, Policy: fixtures.BucketPolicy}))
+			Expect(srv.GetPolicy("foo")).To(Equal(s3.SimpleResponse{
+				Status: http.StatusOK,
+				Header: http.Header{"Content-Type": []string{"application/json"}},
+				Body:   []byte(fixtures.BucketPolicy),
+			}))
+
+			Expect(srv.DeletePolicy("foo")).To(Equal(s3.NoContent()))
+			Expect(db.Buckets["foo"].Meta.Policy).To(BeEmpty())
+		})
+		It("rejects malformed policies", func() {
+			Expect(srv.PutPolicy("foo", stringBody(`{"Statement": []}`))).
+				To(Equal(s3.MalformedPolicy("Missing required field Statement")))
+			Expect(srv.PutPolicy("foo", stringBody(`{"Statement": {"Effect": "Allow", "Principal": "*", "Action": "s3:*", "Resource": "arn:aws:s3:::bar/*"}}`))).
+				To(Equal(s3.MalformedPolicy("Policy has invalid resource")))
+			Expect(srv.PutPolicy("foo", stringBody(`{"Statement": {"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Action": "s3:*", "Resource": "arn:aws:s3:::foo/*"}}`))).
+				To(Equal(s3.MalformedPolicy("Invalid principal in policy")))
+			Expect(db.Buckets["foo"].Meta.Policy).To(BeEmpty())
+		})
+		It("rejects policies over 20 KB", func() {
+			large := `{"Id": "` + string(make([]byte, 20*1024)) + `"}`
+			Expect(srv.PutPolicy("foo", stringBody(large))).
+				To(Equal(s3.MalformedPolicy("Policy exceeds the maximum allowed document size.")))
+		})
+	})
+})
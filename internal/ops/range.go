@@ -0,0 +1,121 @@
+package ops
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ophymx/s3d/internal/meta"
+)
+
+var (
+	errInvalidRange       = errors.New("invalid range")
+	errUnsatisfiableRange = errors.New("unsatisfiable range")
+)
+
+// byteRange is a span of length bytes starting at offset.
+type byteRange struct {
+	offset int64
+	length int64
+}
+
+// parseCopySourceRange parses an x-amz-copy-source-range value of the form
+// "bytes=first-last" against a source object of size bytes.
+func parseCopySourceRange(value string, size int64) (r byteRange, err error) {
+	if !strings.HasPrefix(value, "bytes=") {
+		return r, errInvalidRange
+	}
+	bounds := strings.SplitN(strings.TrimPrefix(value, "bytes="), "-", 2)
+	if len(bounds) != 2 {
+		return r, errInvalidRange
+	}
+	first, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil || first < 0 {
+		return r, errInvalidRange
+	}
+	last, err := strconv.ParseInt(bounds[1], 10, 64)
+	if err != nil || last < first {
+		return r, errInvalidRange
+	}
+	if last >= size {
+		return r, errUnsatisfiableRange
+	}
+	return byteRange{offset: first, length: last - first + 1}, nil
+}
+
+// parseRange parses a Range header against an object of size bytes.
+// Like S3, malformed or multiple ranges return errInvalidRange
+// and should be ignored, sending the whole object.
+func parseRange(value string, size int64) (r byteRange, err error) {
+	if !strings.HasPrefix(value, "bytes=") {
+		return r, errInvalidRange
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(value, "bytes="))
+	if strings.Contains(spec, ",") {
+		return r, errInvalidRange
+	}
+	bounds := strings.SplitN(spec, "-", 2)
+	if len(bounds) != 2 {
+		return r, errInvalidRange
+	}
+
+	if bounds[0] == "" {
+		suffix, err := strconv.ParseInt(bounds[1], 10, 64)
+		if err != nil || suffix < 0 {
+			return r, errInvalidRange
+		}
+		if suffix == 0 || size == 0 {
+			return r, errUnsatisfiableRange
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return byteRange{offset: size - suffix, length: suffix}, nil
+	}
+
+	first, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil || first < 0 {
+		return r, errInvalidRange
+	}
+	last := size - 1
+	if bounds[1] != "" {
+		if last, err = strconv.ParseInt(bounds[1], 10, 64); err != nil || last < first {
+			return r, errInvalidRange
+		}
+	}
+	if first >= size {
+		return r, errUnsatisfiableRange
+	}
+	if last >= size {
+		last = size - 1
+	}
+	return byteRange{offset: first, length: last - first + 1}, nil
+}
+
+// partRange is the byte range of part partNumber of an object.
+// Objects not created by multipart upload only have part 1.
+func partRange(data meta.ObjectData, size int64, partNumber string) (r byteRange, err error) {
+	number, err := parsePartNumber(partNumber)
+	if err != nil {
+		return
+	}
+	if len(data.PartSizes) == 0 {
+		if number != 1 {
+			return r, errUnsatisfiableRange
+		}
+		return byteRange{length: size}, nil
+	}
+	if number > len(data.PartSizes) {
+		return r, errUnsatisfiableRange
+	}
+	for _, partSize := range data.PartSizes[:number-1] {
+		r.offset += partSize
+	}
+	r.length = data.PartSizes[number-1]
+	return
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.offset, r.offset+r.length-1, size)
+}
@@ -15,15 +15,20 @@ func NewService(db meta.DB) ServiceOperations {
 	return serviceOps{db: db}
 }
 
-func (srv serviceOps) ListBuckets() s3.Response {
+// ListBuckets lists the buckets of owner, and those created anonymously,
+// which belong to every account.
+func (srv serviceOps) ListBuckets(owner s3.OwnerResult) s3.Response {
 	result := s3.ListAllMyBucketsResult{
-		Owner: s3.OwnerResult{},
+		Owner: owner,
 	}
 	buckets, err := srv.db.ListBuckets()
 	if err != nil {
 		return s3.InternalError(err)
 	}
 	for _, bucket := range buckets {
+		if id := bucket.Metadata.Owner.ID; id != "" && id != owner.ID {
+			continue
+		}
 		result.Buckets = append(result.Buckets, s3.ListAllMyBucketsResultBucket{
 			Name:         bucket.Name,
 			CreationDate: bucket.Metadata.CreationDate.Format(time.RFC3339),
@@ -23,7 +23,7 @@ var _ = Describe("ServiceService", func() {
 	Describe("ListBuckets", func() {
 		Context("when there are no buckets", func() {
 			It("returns an empty list of buckets", func() {
-				Expect(srv.ListBuckets()).To(Equal(s3.ListAllMyBucketsResult{}))
+				Expect(srv.ListBuckets(s3.OwnerResult{})).To(Equal(s3.ListAllMyBucketsResult{}))
 			})
 		})
 		Context("when buckets exist", func() {
@@ -34,7 +34,7 @@ var _ = Describe("ServiceService", func() {
 				}
 			})
 			It("returns a list of buckets", func() {
-				Expect(srv.ListBuckets()).To(Equal(s3.ListAllMyBucketsResult{
+				Expect(srv.ListBuckets(s3.OwnerResult{})).To(Equal(s3.ListAllMyBucketsResult{
 					Buckets: []s3.ListAllMyBucketsResultBucket{
 						{
 							Name:         "bar",
@@ -48,5 +48,31 @@ var _ = Describe("ServiceService", func() {
 				}))
 			})
 		})
+		Context("when buckets are owned by accounts", func() {
+			owner := s3.OwnerResult{ID: fixtures.OwnerID, DisplayName: fixtures.OwnerDisplayName}
+			BeforeEach(func() {
+				db.Buckets = map[string]*fakes.Bucket{
+					"mine":      fakes.NewBucket(meta.BucketData{CreationDate: fixtures.Time1, Owner: fixtures.Owner()}),
+					"theirs":    fakes.NewBucket(meta.BucketData{CreationDate: fixtures.Time1, Owner: meta.Owner{ID: "0123456789abcdef"}}),
+					"anonymous": fakes.NewBucket(meta.BucketData{CreationDate: fixtures.Time2}),
+				}
+			})
+			It("lists the buckets of the caller and those created anonymously", func() {
+				Expect(srv.ListBuckets(owner)).To(Equal(s3.ListAllMyBucketsResult{
+					Owner: owner,
+					Buckets: []s3.ListAllMyBucketsResultBucket{
+						{Name: "anonymous", CreationDate: "2015-06-07T04:03:02Z"},
+						{Name: "mine", CreationDate: "2014-05-06T03:02:01Z"},
+					},
+				}))
+			})
+			It("lists only anonymous buckets to anonymous callers", func() {
+				Expect(srv.ListBuckets(s3.OwnerResult{})).To(Equal(s3.ListAllMyBucketsResult{
+					Buckets: []s3.ListAllMyBucketsResultBucket{
+						{Name: "anonymous", CreationDate: "2015-06-07T04:03:02Z"},
+					},
+				}))
+			})
+		})
 	})
 })
@@ -0,0 +1,160 @@
+package ops
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ophymx/s3d/internal/clock"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+const (
+	sessionKeyPrefix = "ASIA"
+	roleIDPrefix     = "AROA"
+	keyAlphabet      = "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567"
+	stsTimeFormat    = "2006-01-02T15:04:05Z"
+	// sessionRetention is how long a session is remembered after it
+	// expires, so that it is reported as expired rather than unknown.
+	sessionRetention = 24 * time.Hour
+)
+
+var sessionNamePattern = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+// sessionDuration bounds the DurationSeconds of each STS action.
+type sessionDuration struct {
+	min, max, fallback int
+}
+
+var (
+	assumeRoleDuration      = sessionDuration{min: 900, max: 43200, fallback: 3600}
+	getSessionTokenDuration = sessionDuration{min: 900, max: 129600, fallback: 43200}
+)
+
+type stsOps struct {
+	clock    clock.Clock
+	mutex    sync.Mutex
+	sessions map[string]s3.Credential
+}
+
+// NewSTS returns STS operations that keep the temporary credentials they
+// issue in memory, so they do not outlive the server.
+func NewSTS(clock clock.Clock) STSOperations {
+	return &stsOps{clock: clock, sessions: make(map[string]s3.Credential)}
+}
+
+func (srv *stsOps) AssumeRole(parent s3.Credential, roleArn, sessionName, durationSeconds string) s3.Response {
+	if roleArn == "" {
+		return s3.MissingParameter("The request must contain the parameter RoleArn")
+	}
+	if sessionName == "" {
+		return s3.MissingParameter("The request must contain the parameter RoleSessionName")
+	}
+	arn := strings.SplitN(roleArn, ":", 6)
+	if len(arn) != 6 || arn[0] != "arn" || !strings.HasPrefix(arn[5], "role/") {
+		return s3.ValidationError(roleArn + " is invalid")
+	}
+	if !sessionNamePattern.MatchString(sessionName) {
+		return s3.ValidationError("1 validation error detected: Value '" + sessionName + "' at 'roleSessionName' failed to satisfy constraint: Member must satisfy regular expression pattern: [\\w+=,.@-]*")
+	}
+	duration, resp := assumeRoleDuration.parse(durationSeconds)
+	if resp != nil {
+		return resp
+	}
+
+	roleName := strings.TrimPrefix(arn[5], "role/")
+	roleName = roleName[strings.LastIndex(roleName, "/")+1:]
+	cred := srv.issue(parent, duration)
+	return s3.AssumeRoleResponse{
+		Credentials: stsCredentials(cred),
+		AssumedRoleUser: s3.AssumedRoleUser{
+			Arn:           "arn:aws:sts::" + arn[4] + ":assumed-role/" + roleName + "/" + sessionName,
+			AssumedRoleId: roleIDPrefix + randomString(keyAlphabet, 17) + ":" + sessionName,
+		},
+	}
+}
+
+func (srv *stsOps) GetSessionToken(parent s3.Credential, durationSeconds string) s3.Response {
+	if parent.SessionToken != "" {
+		return s3.AccessDenied("Cannot call GetSessionToken with session credentials")
+	}
+	duration, resp := getSessionTokenDuration.parse(durationSeconds)
+	if resp != nil {
+		return resp
+	}
+	return s3.GetSessionTokenResponse{Credentials: stsCredentials(srv.issue(parent, duration))}
+}
+
+func (srv *stsOps) Session(accessKeyID string) (cred s3.Credential, found bool) {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	cred, found = srv.sessions[accessKeyID]
+	return
+}
+
+// issue creates temporary credentials on behalf of parent.
+func (srv *stsOps) issue(parent s3.Credential, duration time.Duration) s3.Credential {
+	now := srv.clock.Now()
+	cred := s3.Credential{
+		AccessKeyID:  sessionKeyPrefix + randomString(keyAlphabet, 16),
+		SecretKey:    randomToken(30),
+		Account:      parent.Account,
+		Policies:     parent.Policies,
+		SessionToken: randomToken(96),
+		Expiration:   now.Add(duration),
+	}
+
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	for key, session := range srv.sessions {
+		if now.Sub(session.Expiration) > sessionRetention {
+			delete(srv.sessions, key)
+		}
+	}
+	srv.sessions[cred.AccessKeyID] = cred
+	return cred
+}
+
+func (d sessionDuration) parse(value string) (time.Duration, s3.Response) {
+	seconds := d.fallback
+	if value != "" {
+		var err error
+		if seconds, err = strconv.Atoi(value); err != nil {
+			return 0, s3.ValidationError("Value '" + value + "' at 'durationSeconds' failed to satisfy constraint: Member must be a number")
+		}
+	}
+	if seconds < d.min || seconds > d.max {
+		return 0, s3.ValidationError("1 validation error detected: Value '" + strconv.Itoa(seconds) +
+			"' at 'durationSeconds' failed to satisfy constraint: Member must have value between " +
+			strconv.Itoa(d.min) + " and " + strconv.Itoa(d.max))
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func stsCredentials(cred s3.Credential) s3.STSCredentials {
+	return s3.STSCredentials{
+		AccessKeyId:     cred.AccessKeyID,
+		SecretAccessKey: cred.SecretKey,
+		SessionToken:    cred.SessionToken,
+		Expiration:      cred.Expiration.UTC().Format(stsTimeFormat),
+	}
+}
+
+func randomString(alphabet string, n int) string {
+	random := make([]byte, n)
+	rand.Read(random)
+	for i, b := range random {
+		random[i] = alphabet[int(b)%len(alphabet)]
+	}
+	return string(random)
+}
+
+func randomToken(n int) string {
+	random := make([]byte, n)
+	rand.Read(random)
+	return base64.StdEncoding.EncodeToString(random)
+}
@@ -0,0 +1,102 @@
+package ops_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/ophymx/s3d/internal/fakes"
+	"github.com/ophymx/s3d/internal/fixtures"
+	"github.com/ophymx/s3d/internal/ops"
+	"github.com/ophymx/s3d/internal/policy"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+var _ = Describe("STS", func() {
+	var (
+		clock  *fakes.Clock
+		srv    ops.STSOperations
+		parent = s3.Credential{
+			AccessKeyID: "AKIAEXAMPLE",
+			SecretKey:   "secret",
+			Account:     s3.Account{CanonicalID: fixtures.OwnerID, DisplayName: "Example Account"},
+			Policies:    []policy.Policy{{Statement: policy.Statements{{Effect: policy.Allow, Action: policy.Values{"s3:GetObject"}, Resource: policy.Values{"*"}}}}},
+		}
+	)
+	BeforeEach(func() {
+		clock = fakes.NewClock(fixtures.Time1)
+		srv = ops.NewSTS(clock)
+	})
+
+	Describe("AssumeRole", func() {
+		It("issues temporary credentials for the role", func() {
+			resp := srv.AssumeRole(parent, "arn:aws:iam::123456789012:role/path/demo", "john", "900").(s3.AssumeRoleResponse)
+			Expect(resp.AssumedRoleUser.Arn).To(Equal("arn:aws:sts::123456789012:assumed-role/demo/john"))
+			Expect(resp.AssumedRoleUser.AssumedRoleId).To(MatchRegexp(`^AROA[A-Z2-7]{17}:john$`))
+			Expect(resp.Credentials.AccessKeyId).To(MatchRegexp(`^ASIA[A-Z2-7]{16}$`))
+			Expect(resp.Credentials.Expiration).To(Equal(fixtures.Time1.Add(15 * time.Minute).Format("2006-01-02T15:04:05Z")))
+
+			cred, found := srv.Session(resp.Credentials.AccessKeyId)
+			Expect(found).To(BeTrue())
+			Expect(cred).To(Equal(s3.Credential{
+				AccessKeyID:  resp.Credentials.AccessKeyId,
+				SecretKey:    resp.Credentials.SecretAccessKey,
+				Account:      parent.Account,
+				Policies:     parent.Policies,
+				SessionToken: resp.Credentials.SessionToken,
+				Expiration:   fixtures.Time1.Add(15 * time.Minute),
+			}))
+		})
+		It("lasts an hour by default", func() {
+			resp := srv.AssumeRole(parent, "arn:aws:iam::123456789012:role/demo", "john", "").(s3.AssumeRoleResponse)
+			cred, _ := srv.Session(resp.Credentials.AccessKeyId)
+			Expect(cred.Expiration).To(Equal(fixtures.Time1.Add(time.Hour)))
+		})
+		It("requires a role and session name", func() {
+			Expect(srv.AssumeRole(parent, "", "john", "")).
+				To(Equal(s3.MissingParameter("The request must contain the parameter RoleArn")))
+			Expect(srv.AssumeRole(parent, "arn:aws:iam::123456789012:role/demo", "", "")).
+				To(Equal(s3.MissingParameter("The request must contain the parameter RoleSessionName")))
+		})
+		It("validates its parameters", func() {
+			for _, args := range [][3]string{
+				{"demo", "john", ""},
+				{"arn:aws:iam::123456789012:user/demo", "john", ""},
+				{"arn:aws:iam::123456789012:role/demo", "j", ""},
+				{"arn:aws:iam::123456789012:role/demo", "john doe", ""},
+				{"arn:aws:iam::123456789012:role/demo", "john", "899"},
+				{"arn:aws:iam::123456789012:role/demo", "john", "43201"},
+				{"arn:aws:iam::123456789012:role/demo", "john", "hour"},
+			} {
+				resp := srv.AssumeRole(parent, args[0], args[1], args[2])
+				Expect(resp.(s3.ErrorResponse).Code).To(Equal("ValidationError"))
+			}
+		})
+	})
+
+	Describe("GetSessionToken", func() {
+		It("issues temporary credentials lasting 12 hours by default", func() {
+			resp := srv.GetSessionToken(parent, "").(s3.GetSessionTokenResponse)
+			cred, found := srv.Session(resp.Credentials.AccessKeyId)
+			Expect(found).To(BeTrue())
+			Expect(cred.SessionToken).To(Equal(resp.Credentials.SessionToken))
+			Expect(cred.Expiration).To(Equal(fixtures.Time1.Add(12 * time.Hour)))
+		})
+		It("cannot be called with session credentials", func() {
+			resp := srv.GetSessionToken(parent, "").(s3.GetSessionTokenResponse)
+			session, _ := srv.Session(resp.Credentials.AccessKeyId)
+			Expect(srv.GetSessionToken(session, "")).
+				To(Equal(s3.AccessDenied("Cannot call GetSessionToken with session credentials")))
+		})
+		It("validates the duration", func() {
+			Expect(srv.GetSessionToken(parent, "129601").(s3.ErrorResponse).Code).To(Equal("ValidationError"))
+		})
+	})
+
+	Describe("Session", func() {
+		It("does not find unknown access keys", func() {
+			_, found := srv.Session("ASIAUNKNOWN")
+			Expect(found).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,269 @@
+package ops
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ophymx/s3d/internal/blob"
+	"github.com/ophymx/s3d/internal/meta"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+// maxVersioningSize limits the VersioningConfiguration documents read.
+const maxVersioningSize = 64 * 1024
+
+func (srv bucketOps) GetVersioning(bucket string) s3.Response {
+	data, err := srv.db.GetBucket(bucket)
+	if err == meta.ErrBucketNotFound {
+		return s3.NoSuchBucket(bucket)
+	} else if err != nil {
+		return s3.InternalError(err)
+	}
+	return s3.VersioningConfiguration{Status: data.Versioning}
+}
+
+func (srv bucketOps) PutVersioning(bucket string, body io.Reader) s3.Response {
+	var config s3.VersioningConfiguration
+	if err := xml.NewDecoder(io.LimitReader(body, maxVersioningSize)).Decode(&config); err != nil {
+		return s3.MalformedXML("The XML you provided was not well-formed or did not validate against our published schema")
+	}
+	switch config.Status {
+	case "", meta.VersioningEnabled, meta.VersioningSuspended:
+	default:
+		return s3.MalformedXML("The XML you provided was not well-formed or did not validate against our published schema")
+	}
+	switch config.MfaDelete {
+	case "", "Disabled":
+	case "Enabled":
+		return s3.NotImplemented("A header you provided implies functionality that is not implemented")
+	default:
+		return s3.MalformedXML("The XML you provided was not well-formed or did not validate against our published schema")
+	}
+
+	data, err := srv.db.GetBucket(bucket)
+	if err == meta.ErrBucketNotFound {
+		return s3.NoSuchBucket(bucket)
+	} else if err != nil {
+		return s3.InternalError(err)
+	}
+	if config.Status != "" {
+		data.Versioning = config.Status
+	}
+	if err = srv.db.PutBucket(bucket, data); err != nil {
+		return s3.InternalError(err)
+	}
+	return s3.OK()
+}
+
+// ListObjectVersions lists the versions and delete markers of the objects
+// in bucket, newest first for each key.
+func (srv bucketOps) ListObjectVersions(bucket string, query url.Values) s3.Response {
+	maxKeys, err := parseMaxKeys(query.Get("max-keys"))
+	if err != nil {
+		return s3.InvalidArgument("Argument maxKeys must be an integer between 0 and 2147483647", "maxKeys", query.Get("max-keys"))
+	}
+	encodingType := query.Get("encoding-type")
+	if encodingType != "" && encodingType != encodingTypeURL {
+		return s3.InvalidArgument("Invalid Encoding Method specified in Request", "encoding-type", encodingType)
+	}
+
+	result := s3.ListVersionsResult{
+		Name:            bucket,
+		KeyMarker:       query.Get("key-marker"),
+		VersionIdMarker: query.Get("version-id-marker"),
+		Prefix:          query.Get("prefix"),
+		Delimiter:       query.Get("delimiter"),
+		EncodingType:    encodingType,
+		MaxKeys:         maxKeys,
+	}
+	if result.VersionIdMarker != "" && result.KeyMarker == "" {
+		return s3.InvalidArgument("A version-id marker cannot be specified without a key marker.", "version-id-marker", result.VersionIdMarker)
+	}
+
+	list, err := srv.listVersions(bucket, result.Prefix, result.Delimiter, result.KeyMarker, result.VersionIdMarker, maxKeys)
+	if err != nil {
+		if err == meta.ErrBucketNotFound {
+			return s3.NoSuchBucket(bucket)
+		}
+		return s3.InternalError(err)
+	}
+	encode := keyEncoder(encodingType)
+	for i, version := range list.versions {
+		listed := s3.ObjectVersion{
+			DeleteMarker: version.DeleteMarker,
+			Key:          encode(list.keys[i]),
+			VersionId:    versionID(version),
+			IsLatest:     list.latest[i],
+			LastModified: version.LastModified.Format(time.RFC3339),
+			Owner:        ownerResult(version.Owner),
+		}
+		if !version.DeleteMarker {
+			listed.ETag = objectETag(version)
+			listed.Size = version.Size
+			listed.StorageClass = "STANDARD"
+		}
+		result.Versions = append(result.Versions, listed)
+	}
+	for _, prefix := range list.prefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, encode(prefix))
+	}
+	result.IsTruncated = list.truncated
+	if list.truncated {
+		result.NextKeyMarker = encode(list.nextKey)
+		result.NextVersionIdMarker = list.nextVersionID
+	}
+
+	return result
+}
+
+// versionList is a page of the versions and common prefixes in a bucket.
+type versionList struct {
+	keys      []string
+	versions  []meta.ObjectData
+	latest    []bool
+	prefixes  []string
+	truncated bool
+	// nextKey and nextVersionID are the last version or common prefix
+	// listed, which has no version ID.
+	nextKey       string
+	nextVersionID string
+}
+
+// listVersions lists up to maxKeys versions and common prefixes of bucket
+// the way listObjects lists objects. It resumes after the version of
+// keyMarker with versionIDMarker, or after all of its versions without
+// one.
+func (srv bucketOps) listVersions(bucket, prefix, delimiter, keyMarker, versionIDMarker string, maxKeys int) (list versionList, err error) {
+	full := func() bool {
+		return len(list.versions)+len(list.prefixes) >= maxKeys
+	}
+	seek := keyMarker
+	if seek < prefix {
+		seek = prefix
+	}
+	pastMarker := false
+	err = srv.db.ForEachVersion(bucket, seek, func(key string, version meta.ObjectData, latest bool) (string, bool, error) {
+		if !strings.HasPrefix(key, prefix) {
+			return "", false, nil
+		}
+
+		if common, found := commonPrefix(key, prefix, delimiter); found {
+			ahead, found := prefixEnd(common)
+			if common <= keyMarker {
+				return ahead, found, nil
+			}
+			n := len(list.prefixes)
+			if n == 0 || list.prefixes[n-1] != common {
+				if full() {
+					list.truncated = true
+					return "", false, nil
+				}
+				list.prefixes = append(list.prefixes, common)
+			}
+			list.nextKey, list.nextVersionID = common, ""
+			return ahead, found, nil
+		}
+
+		if key == keyMarker && !pastMarker {
+			pastMarker = versionIDMarker != "" && versionID(version) == versionIDMarker
+			return "", true, nil
+		}
+		if full() {
+			list.truncated = true
+			return "", false, nil
+		}
+		list.keys = append(list.keys, key)
+		list.versions = append(list.versions, version)
+		list.latest = append(list.latest, latest)
+		list.nextKey, list.nextVersionID = key, versionID(version)
+		return "", true, nil
+	})
+	return
+}
+
+// versioning fetches the versioning state of bucket.
+func (srv objectOps) versioning(bucket string) (string, s3.Response) {
+	data, err := srv.db.GetBucket(bucket)
+	if err == meta.ErrBucketNotFound {
+		return "", s3.NoSuchBucket(bucket)
+	} else if err != nil {
+		return "", s3.InternalError(err)
+	}
+	return data.Versioning, nil
+}
+
+// version fetches the version of resource with versionID or, without one,
+// the current version.
+func (srv objectOps) version(resource s3.Resource, versionID string) (meta.ObjectData, s3.Response) {
+	if versionID == "" {
+		data, err := srv.db.Get(resource)
+		if err != nil {
+			return data, objectError(resource, err)
+		}
+		return data, nil
+	}
+	if versionID == "null" {
+		versionID = ""
+	}
+	data, err := srv.db.GetVersion(resource, versionID)
+	if err == meta.ErrVersionNotFound {
+		return data, s3.NoSuchVersion("The specified version does not exist.")
+	} else if err != nil {
+		return data, objectError(resource, err)
+	}
+	return data, nil
+}
+
+// hidden adds the headers of the delete marker that hides resource, if its
+// latest version is one, to resp, the response to fetching its current
+// version.
+func (srv objectOps) hidden(resource s3.Resource, resp s3.Response) s3.Response {
+	notFound, ok := resp.(s3.ErrorResponse)
+	if !ok || notFound.Code != "NoSuchKey" {
+		return resp
+	}
+	err := srv.db.ForEachVersion(resource.Bucket(), resource.Key(), func(key string, version meta.ObjectData, latest bool) (string, bool, error) {
+		if key == resource.Key() && version.DeleteMarker {
+			notFound.Header = deleted(version).Header
+		}
+		return "", false, nil
+	})
+	if err != nil {
+		return s3.InternalError(err)
+	}
+	return notFound
+}
+
+// newVersionID generates the version ID of a version written to a bucket
+// in the versioning state. Only buckets with versioning enabled keep more
+// than the null version.
+func newVersionID(versioning string, id string) string {
+	if versioning == meta.VersioningEnabled {
+		return id
+	}
+	return ""
+}
+
+// objectBlob is the Resource in store of a version of resource.
+func objectBlob(resource s3.Resource, data meta.ObjectData) blob.Resource {
+	if data.VersionID == "" {
+		return resource
+	}
+	return blob.Version(resource.Bucket(), resource.Key(), data.VersionID)
+}
+
+// versionHeader names the version written to a bucket with versioning.
+func versionHeader(header http.Header, versioning string, data meta.ObjectData) http.Header {
+	if versioning == "" {
+		return header
+	}
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set(s3.AmzVersionID, versionID(data))
+	return header
+}
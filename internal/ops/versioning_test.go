@@ -0,0 +1,392 @@
+package ops_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/ophymx/s3d/internal/blob"
+	"github.com/ophymx/s3d/internal/fakes"
+	"github.com/ophymx/s3d/internal/fixtures"
+	"github.com/ophymx/s3d/internal/meta"
+	"github.com/ophymx/s3d/internal/meta/dbenc"
+	"github.com/ophymx/s3d/internal/ops"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+var _ = Describe("Bucket versioning", func() {
+	var (
+		db  *fakes.DB
+		srv ops.BucketOperations
+	)
+	BeforeEach(func() {
+		db = fakes.NewDB()
+		srv = ops.NewBucket(db, fakes.NewStore(), fakes.NewClock(fixtures.Time1))
+	})
+
+	It("returns NoSuchBucket when the bucket does not exist", func() {
+		Expect(srv.GetVersioning("foo")).To(Equal(s3.NoSuchBucket("foo")))
+		Expect(srv.PutVersioning("foo", stringBody(`<VersioningConfiguration><Status>Enabled</Status></VersioningConfiguration>`))).
+			To(Equal(s3.NoSuchBucket("foo")))
+	})
+
+	Context("when the bucket exists", func() {
+		BeforeEach(func() {
+			db.Buckets["foo"] = fakes.NewBucket(meta.BucketData{CreationDate: fixtures.Time1})
+		})
+
+		It("has no versioning state until versioning is enabled", func() {
+			Expect(srv.GetVersioning("foo")).To(Equal(s3.VersioningConfiguration{}))
+		})
+		It("enables and suspends versioning", func() {
+			Expect(srv.PutVersioning("foo", stringBody(`<VersioningConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><Status>Enabled</Status></VersioningConfiguration>`))).
+				To(Equal(s3.OK()))
+			Expect(srv.GetVersioning("foo")).To(Equal(s3.VersioningConfiguration{Status: "Enabled"}))
+
+			Expect(srv.PutVersioning("foo", stringBody(`<VersioningConfiguration><Status>Suspended</Status></VersioningConfiguration>`))).
+				To(Equal(s3.OK()))
+			Expect(srv.GetVersioning("foo")).To(Equal(s3.VersioningConfiguration{Status: "Suspended"}))
+		})
+		It("rejects malformed configurations", func() {
+			malformed := s3.MalformedXML("The XML you provided was not well-formed or did not validate against our published schema")
+			Expect(srv.PutVersioning("foo", stringBody(`<VersioningConfiguration>`))).To(Equal(malformed))
+			Expect(srv.PutVersioning("foo", stringBody(`<VersioningConfiguration><Status>Disabled</Status></VersioningConfiguration>`))).
+				To(Equal(malformed))
+			Expect(db.Buckets["foo"].Meta.Versioning).To(BeEmpty())
+		})
+		It("does not implement MFA delete", func() {
+			Expect(srv.PutVersioning("foo", stringBody(`<VersioningConfiguration><Status>Enabled</Status><MfaDelete>Enabled</MfaDelete></VersioningConfiguration>`))).
+				To(Equal(s3.NotImplemented("A header you provided implies functionality that is not implemented")))
+		})
+	})
+
+	Describe("ListObjectVersions", func() {
+		version := func(key, versionID string, latest bool) s3.ObjectVersion {
+			return s3.ObjectVersion{
+				Key:          key,
+				VersionId:    versionID,
+				IsLatest:     latest,
+				LastModified: "2014-05-06T03:02:01Z",
+				ETag:         s3.NewETag("content-md5"),
+				Size:         3,
+				StorageClass: "STANDARD",
+			}
+		}
+		marker := func(key, versionID string, latest bool) s3.ObjectVersion {
+			return s3.ObjectVersion{
+				DeleteMarker: true,
+				Key:          key,
+				VersionId:    versionID,
+				IsLatest:     latest,
+				LastModified: "2014-05-06T03:02:01Z",
+			}
+		}
+		list := func(query url.Values) s3.Response {
+			return srv.ListObjectVersions("foo", query)
+		}
+
+		It("returns NoSuchBucket when the bucket does not exist", func() {
+			Expect(list(url.Values{})).To(Equal(s3.NoSuchBucket("foo")))
+		})
+
+		Context("when the bucket has versions", func() {
+			BeforeEach(func() {
+				bucket := fakes.NewBucket(meta.BucketData{CreationDate: fixtures.Time1, Versioning: meta.VersioningEnabled})
+				data := func(versionID string) meta.ObjectData {
+					return meta.ObjectData{VersionID: versionID, ContentMD5: "content-md5", Size: 3, LastModified: fixtures.Time1}
+				}
+				bucket.Objects["a.txt"] = data("a2")
+				bucket.Versions["a.txt"] = []meta.ObjectData{data("a1"), data("")}
+				bucket.Versions["b.txt"] = []meta.ObjectData{{VersionID: "b2", DeleteMarker: true, LastModified: fixtures.Time1}, data("b1")}
+				bucket.Objects["dir/c.txt"] = data("c1")
+				bucket.Objects["dir/d.txt"] = data("d1")
+				db.Buckets["foo"] = bucket
+			})
+
+			It("lists every version and delete marker", func() {
+				Expect(list(url.Values{})).To(Equal(s3.ListVersionsResult{
+					Name:    "foo",
+					MaxKeys: 1000,
+					Versions: []s3.ObjectVersion{
+						version("a.txt", "a2", true),
+						version("a.txt", "a1", false),
+						version("a.txt", "null", false),
+						marker("b.txt", "b2", true),
+						version("b.txt", "b1", false),
+						version("dir/c.txt", "c1", true),
+						version("dir/d.txt", "d1", true),
+					},
+				}))
+			})
+			It("groups keys by delimiter within the prefix", func() {
+				Expect(list(url.Values{"prefix": {"b"}, "delimiter": {"/"}})).To(Equal(s3.ListVersionsResult{
+					Name:      "foo",
+					Prefix:    "b",
+					Delimiter: "/",
+					MaxKeys:   1000,
+					Versions: []s3.ObjectVersion{
+						marker("b.txt", "b2", true),
+						version("b.txt", "b1", false),
+					},
+				}))
+				Expect(list(url.Values{"delimiter": {"/"}, "key-marker": {"b.txt"}})).To(Equal(s3.ListVersionsResult{
+					Name:           "foo",
+					KeyMarker:      "b.txt",
+					Delimiter:      "/",
+					MaxKeys:        1000,
+					CommonPrefixes: s3.CommonPrefixes{"dir/"},
+				}))
+			})
+			It("pages through versions with key and version ID markers", func() {
+				page := list(url.Values{"max-keys": {"2"}}).(s3.ListVersionsResult)
+				Expect(page.IsTruncated).To(BeTrue())
+				Expect(page.Versions).To(Equal([]s3.ObjectVersion{version("a.txt", "a2", true), version("a.txt", "a1", false)}))
+				Expect(page.NextKeyMarker).To(Equal("a.txt"))
+				Expect(page.NextVersionIdMarker).To(Equal("a1"))
+
+				page = list(url.Values{"max-keys": {"2"}, "key-marker": {"a.txt"}, "version-id-marker": {"a1"}}).(s3.ListVersionsResult)
+				Expect(page.Versions).To(Equal([]s3.ObjectVersion{version("a.txt", "null", false), marker("b.txt", "b2", true)}))
+				Expect(page.NextKeyMarker).To(Equal("b.txt"))
+				Expect(page.NextVersionIdMarker).To(Equal("b2"))
+
+				page = list(url.Values{"key-marker": {"b.txt"}, "version-id-marker": {"b2"}}).(s3.ListVersionsResult)
+				Expect(page.IsTruncated).To(BeFalse())
+				Expect(page.Versions).To(Equal([]s3.ObjectVersion{
+					version("b.txt", "b1", false),
+					version("dir/c.txt", "c1", true),
+					version("dir/d.txt", "d1", true),
+				}))
+			})
+			It("pages through common prefixes", func() {
+				db.Buckets["foo"].Versions["e f/g.txt"] = []meta.ObjectData{{VersionID: "e1", DeleteMarker: true, LastModified: fixtures.Time1}}
+				query := url.Values{"delimiter": {"/"}, "key-marker": {"b.txt"}, "max-keys": {"1"}, "encoding-type": {"url"}}
+				page := list(query).(s3.ListVersionsResult)
+				Expect(page.IsTruncated).To(BeTrue())
+				Expect(page.CommonPrefixes).To(Equal(s3.CommonPrefixes{"dir/"}))
+				Expect(page.NextKeyMarker).To(Equal("dir/"))
+				Expect(page.NextVersionIdMarker).To(BeEmpty())
+
+				query.Set("key-marker", "dir/")
+				page = list(query).(s3.ListVersionsResult)
+				Expect(page.IsTruncated).To(BeFalse())
+				Expect(page.Versions).To(BeEmpty())
+				Expect(page.CommonPrefixes).To(Equal(s3.CommonPrefixes{"e%20f/"}))
+			})
+			It("requires a key marker with a version ID marker", func() {
+				Expect(list(url.Values{"version-id-marker": {"a1"}})).
+					To(Equal(s3.InvalidArgument("A version-id marker cannot be specified without a key marker.", "version-id-marker", "a1")))
+			})
+		})
+	})
+})
+
+var _ = Describe("Object versioning", func() {
+	var (
+		db       *fakes.DB
+		store    *fakes.Store
+		srv      ops.ObjectOperations
+		resource s3.Resource
+	)
+	BeforeEach(func() {
+		db = fakes.NewDB()
+		store = fakes.NewStore()
+		srv = ops.NewObject(db, store, fakes.NewClock())
+		resource = s3.NewResource("foo", "bar.txt")
+		db.CreateBucket("foo", meta.BucketData{CreationDate: fixtures.Time1, Versioning: meta.VersioningEnabled})
+		store.CreateBucket("foo")
+	})
+
+	put := func(content string) string {
+		resp := srv.Put(resource, ops.PutOptions{}, stringBody(content))
+		Expect(resp.HTTPStatus()).To(Equal(http.StatusOK))
+		return resp.(s3.SimpleResponse).Header.Get(s3.AmzVersionID)
+	}
+	// hiddenBy is the response to fetching the current version of an
+	// object hidden by the delete marker with versionID.
+	hiddenBy := func(versionID string) s3.Response {
+		notFound := s3.NoSuchKey("bar.txt")
+		notFound.Header = http.Header{}
+		notFound.Header.Set(s3.AmzVersionID, versionID)
+		notFound.Header.Set(s3.AmzDeleteMarker, "true")
+		return notFound
+	}
+	get := func(versionID string) string {
+		resp := srv.Get(resource, ops.GetOptions{VersionID: versionID})
+		Expect(resp).To(BeAssignableToTypeOf(s3.Object{}))
+		object := resp.(s3.Object)
+		Expect(object.VersionID).To(Equal(versionID))
+		content, err := ioutil.ReadAll(object.File)
+		Expect(err).NotTo(HaveOccurred())
+		return string(content)
+	}
+
+	It("keeps each version written", func() {
+		first, second := put("first"), put("second")
+		Expect(first).NotTo(BeEmpty())
+		Expect(second).NotTo(Equal(first))
+
+		Expect(get(second)).To(Equal("second"))
+		Expect(get(first)).To(Equal("first"))
+		Expect(srv.Get(resource, ops.GetOptions{}).(s3.Object).VersionID).To(Equal(second))
+		Expect(srv.Get(resource, ops.GetOptions{VersionID: "null"})).
+			To(Equal(s3.NoSuchVersion("The specified version does not exist.")))
+	})
+
+	It("hides deleted objects behind a delete marker", func() {
+		version := put("content")
+
+		resp := srv.Delete(resource, "")
+		Expect(resp.HTTPStatus()).To(Equal(http.StatusNoContent))
+		header := resp.(s3.SimpleResponse).Header
+		Expect(header.Get(s3.AmzDeleteMarker)).To(Equal("true"))
+		marker := header.Get(s3.AmzVersionID)
+		Expect(marker).NotTo(BeEmpty())
+
+		Expect(srv.Get(resource, ops.GetOptions{})).To(Equal(hiddenBy(marker)))
+		Expect(srv.Head(resource, ops.GetOptions{})).To(Equal(hiddenBy(marker)))
+		for _, resp := range []s3.Response{
+			srv.Get(resource, ops.GetOptions{VersionID: marker}),
+			srv.Head(resource, ops.GetOptions{VersionID: marker}),
+		} {
+			Expect(resp.HTTPStatus()).To(Equal(http.StatusMethodNotAllowed))
+			header := resp.(s3.ErrorResponse).Header
+			Expect(header.Get(s3.AmzDeleteMarker)).To(Equal("true"))
+			Expect(header.Get(s3.AmzVersionID)).To(Equal(marker))
+		}
+		Expect(get(version)).To(Equal("content"))
+
+		By("deleting the delete marker")
+		Expect(srv.Delete(resource, marker).(s3.SimpleResponse).Header.Get(s3.AmzDeleteMarker)).To(Equal("true"))
+		Expect(get(version)).To(Equal("content"))
+		Expect(srv.Get(resource, ops.GetOptions{}).(s3.Object).VersionID).To(Equal(version))
+	})
+
+	It("permanently deletes a version", func() {
+		first, second := put("first"), put("second")
+
+		Expect(srv.Delete(resource, first).HTTPStatus()).To(Equal(http.StatusNoContent))
+		Expect(srv.Get(resource, ops.GetOptions{VersionID: first})).
+			To(Equal(s3.NoSuchVersion("The specified version does not exist.")))
+		Expect(store.Buckets[".versions"]).To(HaveLen(1))
+
+		Expect(srv.Delete(resource, second).HTTPStatus()).To(Equal(http.StatusNoContent))
+		Expect(srv.Get(resource, ops.GetOptions{})).To(Equal(s3.NoSuchKey("bar.txt")))
+		Expect(store.Buckets[".versions"]).To(BeEmpty())
+	})
+
+	It("copies a version of the source", func() {
+		first := put("first")
+		put("second")
+
+		resp := srv.Copy(resource, s3.NewResource("foo", "copy.txt"), ops.CopyOptions{SourceVersionID: first})
+		Expect(resp).To(BeAssignableToTypeOf(s3.CopyObjectResult{}))
+		result := resp.(s3.CopyObjectResult)
+		Expect(result.SourceVersionID).To(Equal(first))
+		Expect(result.VersionID).NotTo(BeEmpty())
+
+		resource = s3.NewResource("foo", "copy.txt")
+		Expect(get(result.VersionID)).To(Equal("first"))
+	})
+
+	It("restores an older version by copying it onto the same key", func() {
+		first := put("first")
+		second := put("second")
+		selfCopy := s3.InvalidRequest("This copy request is illegal because it is trying to copy an object to itself without changing the object's metadata, storage class, website redirect location or encryption attributes.")
+
+		Expect(srv.Copy(resource, resource, ops.CopyOptions{})).To(Equal(selfCopy))
+		Expect(srv.Copy(resource, resource, ops.CopyOptions{SourceVersionID: second})).To(Equal(selfCopy))
+
+		resp := srv.Copy(resource, resource, ops.CopyOptions{SourceVersionID: first})
+		Expect(resp).To(BeAssignableToTypeOf(s3.CopyObjectResult{}))
+		result := resp.(s3.CopyObjectResult)
+		Expect(result.SourceVersionID).To(Equal(first))
+		Expect(db.Buckets["foo"].Objects["bar.txt"].VersionID).To(Equal(result.VersionID))
+		Expect(get(result.VersionID)).To(Equal("first"))
+		Expect(get(second)).To(Equal("second"))
+	})
+
+	Context("when versioning is suspended", func() {
+		It("replaces the null version", func() {
+			enabled := put("enabled")
+			db.Buckets["foo"].Meta.Versioning = meta.VersioningSuspended
+
+			Expect(put("first")).To(Equal("null"))
+			Expect(put("second")).To(Equal("null"))
+			Expect(get("null")).To(Equal("second"))
+			Expect(get(enabled)).To(Equal("enabled"))
+			Expect(db.Buckets["foo"].Versions["bar.txt"]).To(HaveLen(1))
+		})
+		It("replaces the null version with a null delete marker", func() {
+			db.Buckets["foo"].Meta.Versioning = meta.VersioningSuspended
+			put("content")
+
+			Expect(srv.Delete(resource, "").(s3.SimpleResponse).Header.Get(s3.AmzVersionID)).To(Equal("null"))
+			Expect(store.Buckets["foo"]).To(BeEmpty())
+			Expect(srv.Get(resource, ops.GetOptions{})).To(Equal(hiddenBy("null")))
+		})
+	})
+})
+
+var _ = Describe("Listing a versioned bucket", func() {
+	var (
+		dir      string
+		db       meta.DB
+		buckets  ops.BucketOperations
+		objects  ops.ObjectOperations
+		resource s3.Resource
+	)
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "s3-ops-test-")
+		Expect(err).NotTo(HaveOccurred())
+		db, err = meta.NewDB(filepath.Join(dir, "meta.db"), dbenc.MsgPack)
+		Expect(err).NotTo(HaveOccurred())
+		store := blob.NewFsStore(filepath.Join(dir, "buckets"))
+		clock := fakes.NewClock(fixtures.Time1)
+		buckets = ops.NewBucket(db, store, clock)
+		objects = ops.NewObject(db, store, clock)
+		resource = s3.NewResource("foo", "bar.txt")
+
+		Expect(buckets.Create("foo", ops.Ownership{}, nil)).To(Equal(s3.NoContent()))
+		Expect(buckets.PutVersioning("foo", stringBody(`<VersioningConfiguration><Status>Enabled</Status></VersioningConfiguration>`))).
+			To(Equal(s3.OK()))
+		Expect(objects.Put(resource, ops.PutOptions{}, stringBody("first")).HTTPStatus()).To(Equal(http.StatusOK))
+		Expect(objects.Put(resource, ops.PutOptions{}, stringBody("second!")).HTTPStatus()).To(Equal(http.StatusOK))
+	})
+	AfterEach(func() {
+		Expect(db.Close()).To(Succeed())
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("lists the current version", func() {
+		resp := buckets.ListBucket("foo", url.Values{})
+		Expect(resp).To(BeAssignableToTypeOf(s3.ListBucketResult{}))
+		contents := resp.(s3.ListBucketResult).Contents
+		Expect(contents).To(HaveLen(1))
+		Expect(contents[0].Key).To(Equal("bar.txt"))
+		Expect(contents[0].Size).To(BeEquivalentTo(7))
+
+		resp = buckets.ListBucketV2("foo", url.Values{})
+		Expect(resp).To(BeAssignableToTypeOf(s3.ListBucketV2Result{}))
+		Expect(resp.(s3.ListBucketV2Result).KeyCount).To(Equal(1))
+	})
+	It("repairs the recorded size of a version whose data changed", func() {
+		current, err := db.Get(resource)
+		Expect(err).NotTo(HaveOccurred())
+		stored := filepath.Join(dir, "buckets", ".versions", "foo", current.VersionID, "bar.txt")
+		Expect(ioutil.WriteFile(stored, []byte("truncated"), 0644)).To(Succeed())
+
+		contents := buckets.ListBucket("foo", url.Values{}).(s3.ListBucketResult).Contents
+		Expect(contents).To(HaveLen(1))
+		Expect(contents[0].Size).To(BeEquivalentTo(9))
+
+		repaired, err := db.GetVersion(resource, current.VersionID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(repaired.Size).To(BeEquivalentTo(9))
+		Expect(repaired.ContentMD5).NotTo(Equal(current.ContentMD5))
+	})
+})
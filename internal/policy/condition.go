@@ -0,0 +1,139 @@
+package policy
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ifExists = "IfExists"
+
+// operator tests the values of a condition key in a request against the
+// values given in a policy.
+type operator struct {
+	match func(policy, request string) bool
+	// negated operators hold when no request value matches.
+	negated bool
+	// ifExists operators hold when the key is missing from the request.
+	ifExists bool
+}
+
+var operators = map[string]operator{
+	"StringEquals":              {match: stringEquals},
+	"StringNotEquals":           {match: stringEquals, negated: true},
+	"StringEqualsIgnoreCase":    {match: strings.EqualFold},
+	"StringNotEqualsIgnoreCase": {match: strings.EqualFold, negated: true},
+	"StringLike":                {match: wildcardMatch},
+	"StringNotLike":             {match: wildcardMatch, negated: true},
+	"NumericEquals":             {match: numeric(func(p, r float64) bool { return r == p })},
+	"NumericNotEquals":          {match: numeric(func(p, r float64) bool { return r == p }), negated: true},
+	"NumericLessThan":           {match: numeric(func(p, r float64) bool { return r < p })},
+	"NumericLessThanEquals":     {match: numeric(func(p, r float64) bool { return r <= p })},
+	"NumericGreaterThan":        {match: numeric(func(p, r float64) bool { return r > p })},
+	"NumericGreaterThanEquals":  {match: numeric(func(p, r float64) bool { return r >= p })},
+	"DateEquals":                {match: date(func(p, r time.Time) bool { return r.Equal(p) })},
+	"DateNotEquals":             {match: date(func(p, r time.Time) bool { return r.Equal(p) }), negated: true},
+	"DateLessThan":              {match: date(func(p, r time.Time) bool { return r.Before(p) })},
+	"DateLessThanEquals":        {match: date(func(p, r time.Time) bool { return !r.After(p) })},
+	"DateGreaterThan":           {match: date(func(p, r time.Time) bool { return r.After(p) })},
+	"DateGreaterThanEquals":     {match: date(func(p, r time.Time) bool { return !r.Before(p) })},
+	"Bool":                      {match: strings.EqualFold},
+	"IpAddress":                 {match: ipAddress},
+	"NotIpAddress":              {match: ipAddress, negated: true},
+	"ArnEquals":                 {match: stringEquals},
+	"ArnNotEquals":              {match: stringEquals, negated: true},
+	"ArnLike":                   {match: wildcardMatch},
+	"ArnNotLike":                {match: wildcardMatch, negated: true},
+}
+
+func lookupOperator(name string) (op operator, found bool) {
+	if name == "Null" {
+		return operator{}, true
+	}
+	if op, found = operators[strings.TrimSuffix(name, ifExists)]; found {
+		op.ifExists = strings.HasSuffix(name, ifExists)
+	}
+	return
+}
+
+func (op operator) test(policy, request []string) bool {
+	if op.match == nil {
+		return nullTest(policy, request)
+	}
+	if len(request) == 0 {
+		return op.ifExists || op.negated
+	}
+	for _, r := range request {
+		for _, p := range policy {
+			if op.match(p, r) {
+				return !op.negated
+			}
+		}
+	}
+	return op.negated
+}
+
+// nullTest holds when the key is missing and the policy says "true", or
+// present and it says "false".
+func nullTest(policy, request []string) bool {
+	for _, p := range policy {
+		if strings.EqualFold(p, "true") != (len(request) == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func stringEquals(policy, request string) bool {
+	return policy == request
+}
+
+func numeric(compare func(policy, request float64) bool) func(string, string) bool {
+	return func(policy, request string) bool {
+		p, err := strconv.ParseFloat(policy, 64)
+		if err != nil {
+			return false
+		}
+		r, err := strconv.ParseFloat(request, 64)
+		return err == nil && compare(p, r)
+	}
+}
+
+func date(compare func(policy, request time.Time) bool) func(string, string) bool {
+	return func(policy, request string) bool {
+		p, ok := parseDate(policy)
+		if !ok {
+			return false
+		}
+		r, ok := parseDate(request)
+		return ok && compare(p, r)
+	}
+}
+
+// parseDate accepts ISO 8601 dates and epoch seconds.
+func parseDate(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), true
+	}
+	return time.Time{}, false
+}
+
+// ipAddress matches an IP address against an address or CIDR block.
+func ipAddress(policy, request string) bool {
+	ip := net.ParseIP(request)
+	if ip == nil {
+		return false
+	}
+	if !strings.Contains(policy, "/") {
+		return ip.Equal(net.ParseIP(policy))
+	}
+	_, block, err := net.ParseCIDR(policy)
+	return err == nil && block.Contains(ip)
+}
@@ -0,0 +1,364 @@
+// Package policy parses and evaluates AWS access policy documents.
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+type Effect string
+
+const (
+	Allow Effect = "Allow"
+	Deny  Effect = "Deny"
+)
+
+const (
+	// ResourcePrefix starts the ARN of every bucket and object.
+	ResourcePrefix = "arn:aws:s3:::"
+	version2012    = "2012-10-17"
+	version2008    = "2008-10-17"
+)
+
+var (
+	errVersion          = errors.New("The policy must contain a valid version string")
+	errMissingStatement = errors.New("Missing required field Statement")
+	errMissingAction    = errors.New("Missing required field Action")
+	errMissingResource  = errors.New("Missing required field Resource")
+	errMissingPrincipal = errors.New("Missing required field Principal")
+	errInvalidAction    = errors.New("Policy has invalid action")
+	errInvalidResource  = errors.New("Policy has invalid resource")
+	errInvalidPrincipal = errors.New("Invalid principal in policy")
+	errPrincipal        = errors.New("Policy document should not specify a principal.")
+)
+
+type Policy struct {
+	Version   string
+	ID        string     `json:"Id,omitempty"`
+	Statement Statements `json:"Statement"`
+}
+
+type Statement struct {
+	Sid          string `json:",omitempty"`
+	Effect       Effect
+	Principal    *Principal `json:",omitempty"`
+	NotPrincipal *Principal `json:",omitempty"`
+	Action       Values     `json:",omitempty"`
+	NotAction    Values     `json:",omitempty"`
+	Resource     Values     `json:",omitempty"`
+	NotResource  Values     `json:",omitempty"`
+	// Condition maps each condition operator to the keys it tests and
+	// the values they are tested against.
+	Condition map[string]map[string]Values `json:",omitempty"`
+}
+
+// Principal names who a statement applies to: anyone, when given as "*",
+// or the AWS principals and canonical users listed. AWS principals are
+// access key IDs or canonical IDs; accounts have no AWS account ID or IAM
+// ARN to name them by.
+type Principal struct {
+	Any           bool
+	AWS           Values
+	CanonicalUser Values
+}
+
+// Request describes a request to be evaluated against a policy.
+type Request struct {
+	// Principals identify the caller. They are empty for anonymous
+	// requests.
+	Principals []string
+	Action     string
+	Resource   string
+	// Conditions holds the values of the condition keys that apply to
+	// the request, keyed by lower case name.
+	Conditions map[string][]string
+}
+
+// ParseBucketPolicy parses a bucket policy, which must name a principal
+// in each statement and only grant access to bucket and its objects.
+func ParseBucketPolicy(doc []byte, bucket string) (p Policy, err error) {
+	if p, err = parse(doc); err != nil {
+		return
+	}
+	for _, stmt := range p.Statement {
+		if stmt.Principal == nil && stmt.NotPrincipal == nil {
+			return p, errMissingPrincipal
+		}
+		if stmt.Resource == nil && stmt.NotResource == nil {
+			return p, errMissingResource
+		}
+		for _, resource := range append(stmt.Resource, stmt.NotResource...) {
+			if resource != ResourcePrefix+bucket && !strings.HasPrefix(resource, ResourcePrefix+bucket+"/") {
+				return p, errInvalidResource
+			}
+		}
+	}
+	return
+}
+
+// ParseIdentityPolicy parses an identity policy, which applies to the
+// credential it is attached to and so must not name a principal.
+func ParseIdentityPolicy(doc []byte) (p Policy, err error) {
+	if p, err = parse(doc); err != nil {
+		return
+	}
+	for _, stmt := range p.Statement {
+		if stmt.Principal != nil || stmt.NotPrincipal != nil {
+			return p, errPrincipal
+		}
+		if stmt.Resource == nil && stmt.NotResource == nil {
+			return p, errMissingResource
+		}
+		for _, resource := range append(stmt.Resource, stmt.NotResource...) {
+			if resource != "*" && !strings.HasPrefix(resource, ResourcePrefix) {
+				return p, errInvalidResource
+			}
+		}
+	}
+	return
+}
+
+func parse(doc []byte) (p Policy, err error) {
+	if err = json.Unmarshal(doc, &p); err != nil {
+		switch err.(type) {
+		case *json.SyntaxError, *json.UnmarshalTypeError:
+			err = errors.New("Policies must be valid JSON and the first byte must be '{'")
+		}
+		return
+	}
+	if p.Version != version2012 && p.Version != version2008 && p.Version != "" {
+		return p, errVersion
+	}
+	if len(p.Statement) == 0 {
+		return p, errMissingStatement
+	}
+	for _, stmt := range p.Statement {
+		if err = stmt.validate(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (stmt Statement) validate() error {
+	if stmt.Effect != Allow && stmt.Effect != Deny {
+		return errors.New("Invalid effect: " + string(stmt.Effect))
+	}
+	if (stmt.Action == nil) == (stmt.NotAction == nil) {
+		return errMissingAction
+	}
+	for _, action := range append(stmt.Action, stmt.NotAction...) {
+		if action != "*" && !strings.HasPrefix(strings.ToLower(action), "s3:") {
+			return errInvalidAction
+		}
+	}
+	if stmt.Principal != nil && stmt.NotPrincipal != nil {
+		return errInvalidPrincipal
+	}
+	for operator := range stmt.Condition {
+		if _, found := lookupOperator(operator); !found {
+			return errors.New("Invalid Condition type : " + operator)
+		}
+	}
+	return nil
+}
+
+// Evaluate returns Deny if any statement denies req, otherwise Allow if any
+// statement allows it. It returns an empty Effect when no statement applies.
+func (p Policy) Evaluate(req Request) (effect Effect) {
+	for _, stmt := range p.Statement {
+		if !stmt.applies(req) {
+			continue
+		}
+		if stmt.Effect == Deny {
+			return Deny
+		}
+		effect = Allow
+	}
+	return
+}
+
+func (stmt Statement) applies(req Request) bool {
+	if stmt.Principal != nil && !stmt.Principal.matches(req.Principals) {
+		return false
+	}
+	if stmt.NotPrincipal != nil && stmt.NotPrincipal.matches(req.Principals) {
+		return false
+	}
+	if stmt.Action != nil && !stmt.Action.matchAny(req.Action, true) {
+		return false
+	}
+	if stmt.NotAction != nil && stmt.NotAction.matchAny(req.Action, true) {
+		return false
+	}
+	if stmt.Resource != nil && !stmt.Resource.matchAny(req.Resource, false) {
+		return false
+	}
+	if stmt.NotResource != nil && stmt.NotResource.matchAny(req.Resource, false) {
+		return false
+	}
+	for name, keys := range stmt.Condition {
+		op, _ := lookupOperator(name)
+		for key, values := range keys {
+			if !op.test(values, req.Conditions[strings.ToLower(key)]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (p *Principal) matches(principals []string) bool {
+	if p.Any || p.AWS.contains("*") {
+		return true
+	}
+	for _, principal := range principals {
+		if p.AWS.contains(principal) || p.CanonicalUser.contains(principal) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Principal) UnmarshalJSON(b []byte) error {
+	var any string
+	if err := json.Unmarshal(b, &any); err == nil {
+		if any != "*" {
+			return errInvalidPrincipal
+		}
+		p.Any = true
+		return nil
+	}
+	var principals map[string]Values
+	if err := json.Unmarshal(b, &principals); err != nil {
+		return err
+	}
+	for kind, values := range principals {
+		switch kind {
+		case "AWS":
+			for _, value := range values {
+				if strings.HasPrefix(value, "arn:") || isAccountID(value) {
+					return errInvalidPrincipal
+				}
+			}
+			p.AWS = values
+		case "CanonicalUser":
+			p.CanonicalUser = values
+		default:
+			return errInvalidPrincipal
+		}
+	}
+	return nil
+}
+
+// isAccountID reports whether value is a 12 digit AWS account ID.
+func isAccountID(value string) bool {
+	if len(value) != 12 {
+		return false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Statements may be given as a single statement or a list of them.
+type Statements []Statement
+
+func (s *Statements) UnmarshalJSON(b []byte) error {
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '{' {
+		var stmt Statement
+		if err := json.Unmarshal(b, &stmt); err != nil {
+			return err
+		}
+		*s = Statements{stmt}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]Statement)(s))
+}
+
+// Values may be given as a single value or a list of them. Booleans and
+// numbers are kept as strings.
+type Values []string
+
+func (v *Values) UnmarshalJSON(b []byte) error {
+	var values []interface{}
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '[' {
+		if err := json.Unmarshal(b, &values); err != nil {
+			return err
+		}
+	} else {
+		var value interface{}
+		if err := json.Unmarshal(b, &value); err != nil {
+			return err
+		}
+		values = []interface{}{value}
+	}
+	*v = make(Values, 0, len(values))
+	for _, value := range values {
+		switch value := value.(type) {
+		case string:
+			*v = append(*v, value)
+		case bool, float64:
+			encoded, _ := json.Marshal(value)
+			*v = append(*v, string(encoded))
+		default:
+			return errors.New("Policy values must be strings, numbers or booleans")
+		}
+	}
+	return nil
+}
+
+func (v Values) contains(value string) bool {
+	for _, candidate := range v {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (v Values) matchAny(value string, ignoreCase bool) bool {
+	if ignoreCase {
+		value = strings.ToLower(value)
+	}
+	for _, pattern := range v {
+		if ignoreCase {
+			pattern = strings.ToLower(pattern)
+		}
+		if wildcardMatch(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// wildcardMatch matches value against pattern, where * matches any run of
+// characters and ? matches any single character.
+func wildcardMatch(pattern, value string) bool {
+	var p, v, star, mark = 0, 0, -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, v
+			p++
+		case star >= 0:
+			p = star + 1
+			mark++
+			v = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
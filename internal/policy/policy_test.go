@@ -0,0 +1,183 @@
+package policy_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/ophymx/s3d/internal/policy"
+)
+
+func mustParse(doc string) policy.Policy {
+	p, err := policy.ParseBucketPolicy([]byte(doc), "foo")
+	Expect(err).ToNot(HaveOccurred())
+	return p
+}
+
+var _ = Describe("Policy", func() {
+	Describe("ParseBucketPolicy", func() {
+		It("accepts single values and statements in place of lists", func() {
+			p := mustParse(`{
+				"Version": "2012-10-17",
+				"Statement": {
+					"Effect": "Allow",
+					"Principal": {"AWS": "AKIAEXAMPLE"},
+					"Action": "s3:GetObject",
+					"Resource": "arn:aws:s3:::foo/*",
+					"Condition": {"Bool": {"aws:SecureTransport": true}}
+				}
+			}`)
+			Expect(p.Statement).To(Equal(policy.Statements{{
+				Effect:    policy.Allow,
+				Principal: &policy.Principal{AWS: policy.Values{"AKIAEXAMPLE"}},
+				Action:    policy.Values{"s3:GetObject"},
+				Resource:  policy.Values{"arn:aws:s3:::foo/*"},
+				Condition: map[string]map[string]policy.Values{"Bool": {"aws:SecureTransport": {"true"}}},
+			}}))
+		})
+
+		It("rejects invalid policies", func() {
+			for doc, message := range map[string]string{
+				`not json`: "Policies must be valid JSON and the first byte must be '{'",
+				`{"Version": "2020-01-01", "Statement": []}`: "The policy must contain a valid version string",
+				`{"Statement": []}`:                          "Missing required field Statement",
+				`{"Statement": {"Effect": "Maybe", "Principal": "*", "Action": "s3:*", "Resource": "arn:aws:s3:::foo"}}`:                                                           "Invalid effect: Maybe",
+				`{"Statement": {"Effect": "Allow", "Principal": "*", "Resource": "arn:aws:s3:::foo"}}`:                                                                             "Missing required field Action",
+				`{"Statement": {"Effect": "Allow", "Principal": "*", "Action": "ec2:*", "Resource": "arn:aws:s3:::foo"}}`:                                                          "Policy has invalid action",
+				`{"Statement": {"Effect": "Allow", "Action": "s3:*", "Resource": "arn:aws:s3:::foo"}}`:                                                                             "Missing required field Principal",
+				`{"Statement": {"Effect": "Allow", "Principal": "me", "Action": "s3:*", "Resource": "arn:aws:s3:::foo"}}`:                                                          "Invalid principal in policy",
+				`{"Statement": {"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Action": "s3:*", "Resource": "arn:aws:s3:::foo"}}`:                     "Invalid principal in policy",
+				`{"Statement": {"Effect": "Allow", "Principal": {"AWS": ["AKIAEXAMPLE", "arn:aws:iam::123456789012:user/me"]}, "Action": "s3:*", "Resource": "arn:aws:s3:::foo"}}`: "Invalid principal in policy",
+				`{"Statement": {"Effect": "Allow", "Principal": {"AWS": "123456789012"}, "Action": "s3:*", "Resource": "arn:aws:s3:::foo"}}`:                                       "Invalid principal in policy",
+				`{"Statement": {"Effect": "Allow", "Principal": "*", "Action": "s3:*"}}`:                                                                                           "Missing required field Resource",
+				`{"Statement": {"Effect": "Allow", "Principal": "*", "Action": "s3:*", "Resource": "arn:aws:s3:::foobar/*"}}`:                                                      "Policy has invalid resource",
+				`{"Statement": {"Effect": "Allow", "Principal": "*", "Action": "s3:*", "Resource": "arn:aws:s3:::foo", "Condition": {"Maybe": {}}}}`:                               "Invalid Condition type : Maybe",
+			} {
+				_, err := policy.ParseBucketPolicy([]byte(doc), "foo")
+				Expect(err).To(MatchError(message), doc)
+			}
+		})
+	})
+
+	Describe("ParseIdentityPolicy", func() {
+		It("applies to any principal", func() {
+			p, err := policy.ParseIdentityPolicy([]byte(`{
+				"Statement": {"Effect": "Allow", "Action": ["s3:GetObject", "s3:ListBucket"], "Resource": "*"}
+			}`))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(p.Evaluate(policy.Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::foo/bar"})).To(Equal(policy.Allow))
+			Expect(p.Evaluate(policy.Request{Action: "s3:PutObject", Resource: "arn:aws:s3:::foo/bar"})).To(BeEmpty())
+		})
+
+		It("rejects invalid policies", func() {
+			for doc, message := range map[string]string{
+				`{"Statement": {"Effect": "Allow", "Principal": "*", "Action": "s3:*", "Resource": "*"}}`: "Policy document should not specify a principal.",
+				`{"Statement": {"Effect": "Allow", "Action": "s3:*"}}`:                                    "Missing required field Resource",
+				`{"Statement": {"Effect": "Allow", "Action": "s3:*", "Resource": "foo/*"}}`:               "Policy has invalid resource",
+			} {
+				_, err := policy.ParseIdentityPolicy([]byte(doc))
+				Expect(err).To(MatchError(message), doc)
+			}
+		})
+	})
+
+	Describe("Evaluate", func() {
+		var p policy.Policy
+		BeforeEach(func() {
+			p = mustParse(`{
+				"Version": "2012-10-17",
+				"Statement": [
+					{
+						"Effect": "Allow",
+						"Principal": "*",
+						"Action": ["s3:GetObject", "s3:ListBucket"],
+						"Resource": ["arn:aws:s3:::foo", "arn:aws:s3:::foo/public/*"]
+					},
+					{
+						"Effect": "Allow",
+						"Principal": {"AWS": ["AKIAWRITER"]},
+						"Action": "s3:Put*",
+						"Resource": "arn:aws:s3:::foo/*"
+					},
+					{
+						"Effect": "Deny",
+						"Principal": "*",
+						"Action": "s3:*",
+						"Resource": "arn:aws:s3:::foo/*",
+						"Condition": {"Bool": {"aws:SecureTransport": "false"}, "NotIpAddress": {"aws:SourceIp": "10.0.0.0/8"}}
+					},
+					{
+						"Effect": "Deny",
+						"Principal": "*",
+						"Action": "s3:ListBucket",
+						"Resource": "arn:aws:s3:::foo",
+						"Condition": {"StringNotLike": {"s3:prefix": "public/*"}}
+					}
+				]
+			}`)
+		})
+		request := func(principal, action, resource string, conditions map[string][]string) policy.Request {
+			req := policy.Request{Action: action, Resource: "arn:aws:s3:::" + resource, Conditions: conditions}
+			if principal != "" {
+				req.Principals = []string{principal}
+			}
+			return req
+		}
+		internal := map[string][]string{"aws:securetransport": {"false"}, "aws:sourceip": {"10.1.2.3"}}
+
+		It("allows what a statement allows", func() {
+			Expect(p.Evaluate(request("", "s3:GetObject", "foo/public/a.txt", internal))).To(Equal(policy.Allow))
+			Expect(p.Evaluate(request("AKIAWRITER", "s3:PutObject", "foo/private/a.txt", internal))).To(Equal(policy.Allow))
+		})
+		It("matches actions regardless of case", func() {
+			Expect(p.Evaluate(request("", "s3:getobject", "foo/public/a.txt", internal))).To(Equal(policy.Allow))
+		})
+		It("does not apply to other principals, actions or resources", func() {
+			Expect(p.Evaluate(request("", "s3:PutObject", "foo/public/a.txt", internal))).To(BeEmpty())
+			Expect(p.Evaluate(request("", "s3:GetObject", "foo/private/a.txt", internal))).To(BeEmpty())
+			Expect(p.Evaluate(request("AKIAREADER", "s3:PutObject", "foo/a.txt", internal))).To(BeEmpty())
+		})
+		It("denies when every condition holds", func() {
+			external := map[string][]string{"aws:securetransport": {"false"}, "aws:sourceip": {"192.0.2.1"}}
+			Expect(p.Evaluate(request("AKIAWRITER", "s3:PutObject", "foo/a.txt", external))).To(Equal(policy.Deny))
+			secure := map[string][]string{"aws:securetransport": {"true"}, "aws:sourceip": {"192.0.2.1"}}
+			Expect(p.Evaluate(request("AKIAWRITER", "s3:PutObject", "foo/a.txt", secure))).To(Equal(policy.Allow))
+		})
+		It("treats a missing key as not matching a negated condition", func() {
+			Expect(p.Evaluate(request("", "s3:ListBucket", "foo", internal))).To(Equal(policy.Deny))
+			listPublic := map[string][]string{"s3:prefix": {"public/docs/"}}
+			Expect(p.Evaluate(request("", "s3:ListBucket", "foo", listPublic))).To(Equal(policy.Allow))
+		})
+	})
+
+	Describe("conditions", func() {
+		evaluate := func(condition string, conditions map[string][]string) policy.Effect {
+			p := mustParse(`{"Statement": {"Effect": "Allow", "Principal": "*", "Action": "s3:*", "Resource": "arn:aws:s3:::foo", "Condition": ` + condition + `}}`)
+			return p.Evaluate(policy.Request{Action: "s3:ListBucket", Resource: "arn:aws:s3:::foo", Conditions: conditions})
+		}
+
+		It("supports the common operators", func() {
+			for condition, conditions := range map[string]map[string][]string{
+				`{"StringEquals": {"s3:prefix": ["a", "b"]}}`:                   {"s3:prefix": {"b"}},
+				`{"StringEqualsIgnoreCase": {"s3:prefix": "A"}}`:                {"s3:prefix": {"a"}},
+				`{"StringLike": {"aws:UserAgent": "aws-cli/*"}}`:                {"aws:useragent": {"aws-cli/2.0 Python"}},
+				`{"NumericLessThanEquals": {"s3:max-keys": 10}}`:                {"s3:max-keys": {"10"}},
+				`{"DateLessThan": {"aws:CurrentTime": "2020-01-01T00:00:00Z"}}`: {"aws:currenttime": {"2019-12-31T23:59:59Z"}},
+				`{"IpAddress": {"aws:SourceIp": ["192.0.2.0/24", "10.0.0.1"]}}`: {"aws:sourceip": {"10.0.0.1"}},
+				`{"Null": {"s3:prefix": true}}`:                                 {},
+				`{"StringEqualsIfExists": {"s3:prefix": "a"}}`:                  {},
+			} {
+				Expect(evaluate(condition, conditions)).To(Equal(policy.Allow), condition)
+			}
+		})
+		It("fails conditions that do not hold", func() {
+			for condition, conditions := range map[string]map[string][]string{
+				`{"StringEquals": {"s3:prefix": "a"}}`:            {},
+				`{"StringEquals": {"s3:prefix": ["a"]}}`:          {"s3:prefix": {"A"}},
+				`{"NumericGreaterThan": {"s3:max-keys": 10}}`:     {"s3:max-keys": {"ten"}},
+				`{"IpAddress": {"aws:SourceIp": "192.0.2.0/24"}}`: {"aws:sourceip": {"10.0.0.1"}},
+				`{"Null": {"s3:prefix": false}}`:                  {},
+			} {
+				Expect(evaluate(condition, conditions)).To(BeEmpty(), condition)
+			}
+		})
+	})
+})
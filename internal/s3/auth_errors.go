@@ -14,9 +14,21 @@ func AuthError(err error) ErrorResponse {
 		case auth.ErrAuthorizationQueryParametersError:
 			return AuthorizationQueryParametersError(authErr.Message)
 		case auth.ErrAccessDenied:
-			return AccessDenied(authErr.Message)
+			resp := AccessDenied(authErr.Message)
+			resp.Params = authErr.Params
+			return resp
 		case auth.ErrInvalidAccessKeyID:
 			return InvalidAccessKeyID(authErr.Params["key"])
+		case auth.ErrIncompleteBody:
+			return IncompleteBody(authErr.Message)
+		case auth.ErrMissingContentLength:
+			return MissingContentLength(authErr.Message)
+		case auth.ErrMaxMessageLengthExceeded:
+			return MaxMessageLengthExceeded(authErr.Message)
+		case auth.ErrRequestTimeTooSkewed:
+			resp := RequestTimeTooSkewed(authErr.Message)
+			resp.Params = authErr.Params
+			return resp
 		case auth.ErrSignatureDoesNotMatch:
 			return SignatureDoesNotMatch(authErr.Message, authErr.Params["key"], authErr.Params["sts"], authErr.Params["signature"])
 		}
@@ -1,11 +1,44 @@
 package s3
 
 const (
-	AmzRequestID  = "x-amz-request-id"
-	AmzHostID     = "x-amz-id-2"
-	AmzCopySource = "x-amz-copy-source"
-	AmzVersionID  = "x-amz-version-id"
-	AmzMetaPrefix = "x-amz-meta-"
+	AmzRequestID       = "x-amz-request-id"
+	AmzHostID          = "x-amz-id-2"
+	AmzCopySource      = "x-amz-copy-source"
+	AmzCopySourceRange = "x-amz-copy-source-range"
+	AmzVersionID       = "x-amz-version-id"
+	AmzDeleteMarker    = "x-amz-delete-marker"
+	AmzBucketRegion    = "x-amz-bucket-region"
+	AmzMetaPrefix      = "x-amz-meta-"
+	AmzMpPartsCount    = "x-amz-mp-parts-count"
+	AmzContentSHA256   = "x-amz-content-sha256"
+	AmzTrailer         = "x-amz-trailer"
+	AmzSecurityToken   = "x-amz-security-token"
+
+	AmzChecksumPrefix       = "x-amz-checksum-"
+	AmzChecksumAlgorithm    = "x-amz-checksum-algorithm"
+	AmzChecksumMode         = "x-amz-checksum-mode"
+	AmzChecksumType         = "x-amz-checksum-type"
+	AmzSdkChecksumAlgorithm = "x-amz-sdk-checksum-algorithm"
+
+	AmzMetadataDirective = "x-amz-metadata-directive"
+	AmzTagging           = "x-amz-tagging"
+	AmzTaggingCount      = "x-amz-tagging-count"
+	AmzTaggingDirective  = "x-amz-tagging-directive"
+
+	// Access control headers
+	AmzACL              = "x-amz-acl"
+	AmzGrantRead        = "x-amz-grant-read"
+	AmzGrantWrite       = "x-amz-grant-write"
+	AmzGrantReadACP     = "x-amz-grant-read-acp"
+	AmzGrantWriteACP    = "x-amz-grant-write-acp"
+	AmzGrantFullControl = "x-amz-grant-full-control"
+
+	// Copy source conditional headers
+	AmzCopySourceIfMatch           = "x-amz-copy-source-if-match"
+	AmzCopySourceIfNoneMatch       = "x-amz-copy-source-if-none-match"
+	AmzCopySourceIfModifiedSince   = "x-amz-copy-source-if-modified-since"
+	AmzCopySourceIfUnmodifiedSince = "x-amz-copy-source-if-unmodified-since"
+	AmzCopySourceVersionID         = "x-amz-copy-source-version-id"
 
 	// Common headers
 	HdrContentMD5    = "Content-MD5"
@@ -14,4 +47,18 @@ const (
 	HdrLastModified  = "Last-Modified"
 	HdrCacheControl  = "Cache-Control"
 	HdrETag          = "ETag"
+	HdrAcceptRanges  = "Accept-Ranges"
+	HdrContentRange  = "Content-Range"
+	HdrRange         = "Range"
+
+	HdrContentDisposition = "Content-Disposition"
+	HdrContentEncoding    = "Content-Encoding"
+	HdrContentLanguage    = "Content-Language"
+	HdrExpires            = "Expires"
+
+	// Conditional headers
+	HdrIfMatch           = "If-Match"
+	HdrIfNoneMatch       = "If-None-Match"
+	HdrIfModifiedSince   = "If-Modified-Since"
+	HdrIfUnmodifiedSince = "If-Unmodified-Since"
 )
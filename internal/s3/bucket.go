@@ -77,3 +77,113 @@ func (result ListBucketResult) Send(writer http.ResponseWriter) error {
 	result.NS = NSS3
 	return sendXMLHeader(writer, result)
 }
+
+// ContentV2Result is an object listed by ListObjectsV2, which only lists
+// its owner when asked to.
+type ContentV2Result struct {
+	Key          string
+	LastModified string
+	ETag         ETag
+	Size         int64
+	Owner        *OwnerResult `xml:",omitempty"`
+	StorageClass string
+}
+
+type ListBucketV2Result struct {
+	XMLNS
+	Name                  string
+	Prefix                string
+	ContinuationToken     string `xml:",omitempty"`
+	NextContinuationToken string `xml:",omitempty"`
+	StartAfter            string `xml:",omitempty"`
+	KeyCount              int
+	MaxKeys               int
+	Delimiter             string `xml:",omitempty"`
+	EncodingType          string `xml:",omitempty"`
+	IsTruncated           bool
+	CommonPrefixes        CommonPrefixes
+	Contents              []ContentV2Result
+}
+
+func (result ListBucketV2Result) Send(writer http.ResponseWriter) error {
+	result.NS = NSS3
+	return sendXMLHeader(writer, result)
+}
+
+// ObjectVersion is a version or, when DeleteMarker is set, a delete marker
+// listed in a ListVersionsResult.
+type ObjectVersion struct {
+	DeleteMarker bool
+	Key          string
+	VersionId    string
+	IsLatest     bool
+	LastModified string
+	ETag         ETag
+	Size         int64
+	StorageClass string
+	Owner        OwnerResult
+}
+
+type versionResult struct {
+	Key          string
+	VersionId    string
+	IsLatest     bool
+	LastModified string
+	ETag         ETag
+	Size         int64
+	StorageClass string
+	Owner        OwnerResult
+}
+
+type deleteMarkerResult struct {
+	Key          string
+	VersionId    string
+	IsLatest     bool
+	LastModified string
+	Owner        OwnerResult
+}
+
+func (version ObjectVersion) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if version.DeleteMarker {
+		start.Name.Local = "DeleteMarker"
+		return e.EncodeElement(deleteMarkerResult{
+			Key:          version.Key,
+			VersionId:    version.VersionId,
+			IsLatest:     version.IsLatest,
+			LastModified: version.LastModified,
+			Owner:        version.Owner,
+		}, start)
+	}
+	start.Name.Local = "Version"
+	return e.EncodeElement(versionResult{
+		Key:          version.Key,
+		VersionId:    version.VersionId,
+		IsLatest:     version.IsLatest,
+		LastModified: version.LastModified,
+		ETag:         version.ETag,
+		Size:         version.Size,
+		StorageClass: version.StorageClass,
+		Owner:        version.Owner,
+	}, start)
+}
+
+type ListVersionsResult struct {
+	XMLNS
+	Name                string
+	Prefix              string
+	KeyMarker           string
+	VersionIdMarker     string
+	NextKeyMarker       string `xml:",omitempty"`
+	NextVersionIdMarker string `xml:",omitempty"`
+	MaxKeys             int
+	Delimiter           string `xml:",omitempty"`
+	EncodingType        string `xml:",omitempty"`
+	IsTruncated         bool
+	Versions            []ObjectVersion
+	CommonPrefixes      CommonPrefixes
+}
+
+func (result ListVersionsResult) Send(writer http.ResponseWriter) error {
+	result.NS = NSS3
+	return sendXMLHeader(writer, result)
+}
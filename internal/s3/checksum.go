@@ -0,0 +1,76 @@
+package s3
+
+import "strings"
+
+// Additional checksum algorithms.
+const (
+	ChecksumCRC32     = "CRC32"
+	ChecksumCRC32C    = "CRC32C"
+	ChecksumCRC64NVME = "CRC64NVME"
+	ChecksumSHA1      = "SHA1"
+	ChecksumSHA256    = "SHA256"
+)
+
+// Checksum types.
+const (
+	ChecksumTypeFullObject = "FULL_OBJECT"
+	ChecksumTypeComposite  = "COMPOSITE"
+)
+
+// ChecksumAlgorithms are the additional checksum algorithms supported.
+var ChecksumAlgorithms = []string{
+	ChecksumCRC32,
+	ChecksumCRC32C,
+	ChecksumCRC64NVME,
+	ChecksumSHA1,
+	ChecksumSHA256,
+}
+
+// ChecksumHeader is the x-amz-checksum-* header for algorithm.
+func ChecksumHeader(algorithm string) string {
+	return AmzChecksumPrefix + strings.ToLower(algorithm)
+}
+
+// Checksums holds the additional checksum of an object or part.
+// At most one is set.
+type Checksums struct {
+	ChecksumCRC32     string `xml:",omitempty"`
+	ChecksumCRC32C    string `xml:",omitempty"`
+	ChecksumCRC64NVME string `xml:",omitempty"`
+	ChecksumSHA1      string `xml:",omitempty"`
+	ChecksumSHA256    string `xml:",omitempty"`
+}
+
+// NewChecksums sets the checksum of algorithm to value.
+func NewChecksums(algorithm, value string) (c Checksums) {
+	switch algorithm {
+	case ChecksumCRC32:
+		c.ChecksumCRC32 = value
+	case ChecksumCRC32C:
+		c.ChecksumCRC32C = value
+	case ChecksumCRC64NVME:
+		c.ChecksumCRC64NVME = value
+	case ChecksumSHA1:
+		c.ChecksumSHA1 = value
+	case ChecksumSHA256:
+		c.ChecksumSHA256 = value
+	}
+	return
+}
+
+// Get returns the checksum of algorithm, if any.
+func (c Checksums) Get(algorithm string) string {
+	switch algorithm {
+	case ChecksumCRC32:
+		return c.ChecksumCRC32
+	case ChecksumCRC32C:
+		return c.ChecksumCRC32C
+	case ChecksumCRC64NVME:
+		return c.ChecksumCRC64NVME
+	case ChecksumSHA1:
+		return c.ChecksumSHA1
+	case ChecksumSHA256:
+		return c.ChecksumSHA256
+	}
+	return ""
+}
@@ -3,4 +3,8 @@ package s3
 type Config struct {
 	Region string
 	HostID string
+	// EnforceAuth rejects anonymous requests that are not granted access
+	// by the bucket. Without it, anonymous requests are only limited on
+	// buckets with an ACL.
+	EnforceAuth bool
 }
@@ -1,7 +1,39 @@
 package s3
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/ophymx/s3d/internal/policy"
+)
+
+// Account owns buckets and objects. Its canonical ID identifies it as an
+// owner or grantee, and several credentials may share it.
+type Account struct {
+	CanonicalID string
+	DisplayName string
+}
+
 type Credential struct {
 	AccessKeyID string
-	DisplayName string
 	SecretKey   string
+	Account
+	// Policies are the identity policies that limit what the credential
+	// may do. Credentials without any have full access to their account.
+	Policies []policy.Policy
+	// SessionToken and Expiration are set on temporary credentials.
+	SessionToken string
+	Expiration   time.Time
+}
+
+// Owner is the account as the owner of buckets and objects.
+func (account Account) Owner() OwnerResult {
+	return OwnerResult{ID: account.CanonicalID, DisplayName: account.DisplayName}
+}
+
+// NewCanonicalID derives a canonical ID from an access key.
+func NewCanonicalID(accessKeyID string) string {
+	sum := sha256.Sum256([]byte(accessKeyID))
+	return hex.EncodeToString(sum[:])
 }
@@ -14,6 +14,9 @@ type ErrorResponse struct {
 	HostID    string
 
 	Params map[string]string
+	// Header holds headers sent along with the error, such as those
+	// describing a delete marker.
+	Header http.Header
 }
 
 func NewErrorResponse(code string, status int, message string) ErrorResponse {
@@ -34,6 +37,9 @@ func (err ErrorResponse) HTTPStatus() int {
 
 func (err ErrorResponse) Send(writer http.ResponseWriter) error {
 	header := writer.Header()
+	for name, values := range err.Header {
+		header[name] = append(header[name], values...)
+	}
 	header.Add(HdrContentType, "application/xml")
 	err.RequestID = header.Get(AmzRequestID)
 	err.HostID = header.Get(AmzHostID)
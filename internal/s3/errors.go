@@ -38,6 +38,10 @@ func BucketNotEmpty(message string) ErrorResponse {
 	return NewErrorResponse("BucketNotEmpty", http.StatusConflict, message)
 }
 
+func ConditionalRequestConflict(message string) ErrorResponse {
+	return NewErrorResponse("ConditionalRequestConflict", http.StatusConflict, message)
+}
+
 func CredentialsNotSupported(message string) ErrorResponse {
 	return NewErrorResponse("CredentialsNotSupported", http.StatusBadRequest, message)
 }
@@ -136,6 +140,10 @@ func InvalidPart(message string) ErrorResponse {
 	return NewErrorResponse("InvalidPart", http.StatusBadRequest, message)
 }
 
+func InvalidPartNumber(message string) ErrorResponse {
+	return NewErrorResponse("InvalidPartNumber", http.StatusRequestedRangeNotSatisfiable, message)
+}
+
 func InvalidPartOrder(message string) ErrorResponse {
 	return NewErrorResponse("InvalidPartOrder", http.StatusBadRequest, message)
 }
@@ -196,6 +204,10 @@ func MalformedXML(message string) ErrorResponse {
 	return NewErrorResponse("MalformedXML", http.StatusBadRequest, message)
 }
 
+func MalformedPolicy(message string) ErrorResponse {
+	return NewErrorResponse("MalformedPolicy", http.StatusBadRequest, message)
+}
+
 func MaxMessageLengthExceeded(message string) ErrorResponse {
 	return NewErrorResponse("MaxMessageLengthExceeded", http.StatusBadRequest, message)
 }
@@ -241,6 +253,10 @@ func NoSuchBucket(bucket string) ErrorResponse {
 	}
 }
 
+func NoSuchBucketPolicy(message string) ErrorResponse {
+	return NewErrorResponse("NoSuchBucketPolicy", http.StatusNotFound, message)
+}
+
 func NoSuchKey(resource string) ErrorResponse {
 	return ErrorResponse{
 		Code:    "NoSuchKey",
@@ -270,10 +286,6 @@ func NotSignedUp(message string) ErrorResponse {
 	return NewErrorResponse("NotSignedUp", http.StatusForbidden, message)
 }
 
-func NotSuchBucketPolicy(message string) ErrorResponse {
-	return NewErrorResponse("NotSuchBucketPolicy", http.StatusNotFound, message)
-}
-
 func OperationAborted(message string) ErrorResponse {
 	return NewErrorResponse("OperationAborted", http.StatusConflict, message)
 }
@@ -355,3 +367,7 @@ func UnresolvableGrantByEmailAddress(message string) ErrorResponse {
 func UserKeyMustBeSpecified(message string) ErrorResponse {
 	return NewErrorResponse("UserKeyMustBeSpecified", http.StatusBadRequest, message)
 }
+
+func XAmzContentSHA256Mismatch(message string) ErrorResponse {
+	return NewErrorResponse("XAmzContentSHA256Mismatch", http.StatusBadRequest, message)
+}
@@ -12,19 +12,36 @@ import (
 
 // Object is the result of ObjectService#Get()
 type Object struct {
-	File          io.ReadCloser
-	ContentLength int64
-	ContentType   string
-	LastModified  string
-	CacheControl  string
-	ETag          ETag
-	UserDefined   map[string]string
-	VersionID     string
+	File               io.ReadCloser
+	ContentLength      int64
+	ContentType        string
+	LastModified       string
+	CacheControl       string
+	ContentDisposition string
+	ContentEncoding    string
+	ContentLanguage    string
+	Expires            string
+	ETag               ETag
+	UserDefined        map[string]string
+	VersionID          string
+	ContentRange       string
+	PartsCount         int
+	TagCount           int
+	ChecksumAlgorithm  string
+	Checksum           string
+	ChecksumType       string
 }
 
 // Send writes headers and file to writer.
 func (resp Object) Send(writer http.ResponseWriter) (err error) {
 	writer.Header().Add(HdrContentLength, strconv.FormatInt(resp.ContentLength, 10))
+	writer.Header().Add(HdrAcceptRanges, "bytes")
+	if resp.ContentRange != "" {
+		writer.Header().Add(HdrContentRange, resp.ContentRange)
+	}
+	if resp.PartsCount > 0 {
+		writer.Header().Add(AmzMpPartsCount, strconv.Itoa(resp.PartsCount))
+	}
 	if resp.ContentType != "" {
 		writer.Header().Add(HdrContentType, resp.ContentType)
 	}
@@ -34,13 +51,33 @@ func (resp Object) Send(writer http.ResponseWriter) (err error) {
 	if resp.CacheControl != "" {
 		writer.Header().Add(HdrCacheControl, resp.CacheControl)
 	}
+	if resp.ContentDisposition != "" {
+		writer.Header().Add(HdrContentDisposition, resp.ContentDisposition)
+	}
+	if resp.ContentEncoding != "" {
+		writer.Header().Add(HdrContentEncoding, resp.ContentEncoding)
+	}
+	if resp.ContentLanguage != "" {
+		writer.Header().Add(HdrContentLanguage, resp.ContentLanguage)
+	}
+	if resp.Expires != "" {
+		writer.Header().Add(HdrExpires, resp.Expires)
+	}
 	for key, value := range resp.UserDefined {
 		writer.Header().Add(AmzMetaPrefix+key, value)
 	}
 	if resp.VersionID != "" {
 		writer.Header().Add(AmzVersionID, resp.VersionID)
 	}
+	if resp.TagCount > 0 {
+		writer.Header().Add(AmzTaggingCount, strconv.Itoa(resp.TagCount))
+	}
+	if resp.Checksum != "" {
+		writer.Header().Add(ChecksumHeader(resp.ChecksumAlgorithm), resp.Checksum)
+		writer.Header().Add(AmzChecksumType, resp.ChecksumType)
+	}
 
+	writer.WriteHeader(resp.HTTPStatus())
 	if resp.File != nil {
 		if _, err = io.Copy(writer, resp.File); err != nil {
 			return
@@ -51,6 +88,9 @@ func (resp Object) Send(writer http.ResponseWriter) (err error) {
 }
 
 func (resp Object) HTTPStatus() int {
+	if resp.ContentRange != "" {
+		return http.StatusPartialContent
+	}
 	return http.StatusOK
 }
 
@@ -58,9 +98,18 @@ type CopyObjectResult struct {
 	XMLNS
 	LastModified string
 	ETag         ETag
+	// VersionID and SourceVersionID are sent as headers.
+	VersionID       string `xml:"-"`
+	SourceVersionID string `xml:"-"`
 }
 
 func (results CopyObjectResult) Send(writer http.ResponseWriter) error {
+	if results.VersionID != "" {
+		writer.Header().Add(AmzVersionID, results.VersionID)
+	}
+	if results.SourceVersionID != "" {
+		writer.Header().Add(AmzCopySourceVersionID, results.SourceVersionID)
+	}
 	results.NS = NSS3
 	return sendXML(writer, results)
 }
@@ -73,3 +122,15 @@ func Created(etag ETag) SimpleResponse {
 		},
 	}
 }
+
+// NotModified is the response to a GET or HEAD whose conditions show
+// the client's copy is current.
+func NotModified(etag ETag, lastModified string) SimpleResponse {
+	return SimpleResponse{
+		Status: http.StatusNotModified,
+		Header: http.Header{
+			HdrETag:         []string{etag.String()},
+			HdrLastModified: []string{lastModified},
+		},
+	}
+}
@@ -24,6 +24,12 @@ type Request struct {
 	Time       time.Time
 	Host       string
 	RawReq     *http.Request
+	// Action names the request in the vocabulary of policies, such as
+	// s3:GetObject.
+	Action string
+	// Authorize checks that the caller may also take action on resource,
+	// for requests acting on more than their own resource.
+	Authorize func(action string, resource Resource) Response
 }
 
 func (req Request) getHeader(key string) string {
@@ -3,3 +3,14 @@ package s3
 type CompleteMultipartUpload struct {
 	Parts []Part `xml:"Part"`
 }
+
+// ObjectIdentifier names an object, or a version of it, to delete.
+type ObjectIdentifier struct {
+	Key       string
+	VersionId string `xml:",omitempty"`
+}
+
+type Delete struct {
+	Quiet   bool
+	Objects []ObjectIdentifier `xml:"Object"`
+}
@@ -1,6 +1,9 @@
 package s3
 
-import "net/http"
+import (
+	"encoding/xml"
+	"net/http"
+)
 
 const (
 	NSS3  = "http://s3.amazonaws.com/doc/2006-03-01/"
@@ -53,6 +56,30 @@ type Grantee struct {
 	EmailAddress string    `xml:",omitempty"`
 }
 
+// UnmarshalXML reads the grantee type from its namespaced xsi:type
+// attribute, which the field tags of Grantee only know how to write.
+func (grantee *Grantee) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	var decoded struct {
+		Type         GrantType `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+		URI          string
+		ID           string
+		DisplayName  string
+		EmailAddress string
+	}
+	if err := decoder.DecodeElement(&decoded, &start); err != nil {
+		return err
+	}
+	*grantee = Grantee{
+		NSXsi:        NSXsi,
+		Type:         decoded.Type,
+		URI:          decoded.URI,
+		ID:           decoded.ID,
+		DisplayName:  decoded.DisplayName,
+		EmailAddress: decoded.EmailAddress,
+	}
+	return nil
+}
+
 type Grant struct {
 	Grantee    Grantee
 	Permission Permission
@@ -187,10 +214,16 @@ func (results InitiateMultipartUploadResult) Send(writer http.ResponseWriter) er
 type CopyPartResult struct {
 	LastModified string
 	ETag         ETag
+	Checksums
 	StatucOKResponse
+	// SourceVersionID is sent as a header.
+	SourceVersionID string `xml:"-"`
 }
 
 func (results CopyPartResult) Send(writer http.ResponseWriter) error {
+	if results.SourceVersionID != "" {
+		writer.Header().Add(AmzCopySourceVersionID, results.SourceVersionID)
+	}
 	return sendXML(writer, results)
 }
 
@@ -200,9 +233,16 @@ type CompleteMultipartUploadResult struct {
 	Bucket   string
 	Key      string
 	ETag     ETag
+	Checksums
+	ChecksumType string `xml:",omitempty"`
+	// VersionID is sent as a header.
+	VersionID string `xml:"-"`
 }
 
 func (results CompleteMultipartUploadResult) Send(writer http.ResponseWriter) error {
+	if results.VersionID != "" {
+		writer.Header().Add(AmzVersionID, results.VersionID)
+	}
 	results.NS = NSS3
 	return sendXMLHeader(writer, results)
 }
@@ -212,6 +252,7 @@ type Part struct {
 	LastModified string `xml:",omitempty"`
 	ETag         ETag
 	Size         int64 `xml:",omitempty"`
+	Checksums
 }
 
 type ListPartsResult struct {
@@ -229,6 +270,41 @@ type ListPartsResult struct {
 	Parts                []Part `xml:"Part"`
 }
 
+func (results ListPartsResult) Send(writer http.ResponseWriter) error {
+	results.NS = NSS3
+	return sendXMLHeader(writer, results)
+}
+
+type Upload struct {
+	Key          string
+	UploadId     string
+	Initiator    OwnerResult
+	Owner        OwnerResult
+	StorageClass string
+	Initiated    string
+}
+
+type ListMultipartUploadsResult struct {
+	XMLNS
+	Bucket             string
+	KeyMarker          string
+	UploadIdMarker     string
+	NextKeyMarker      string
+	NextUploadIdMarker string
+	EncodingType       string `xml:",omitempty"`
+	Delimiter          string `xml:",omitempty"`
+	Prefix             string `xml:",omitempty"`
+	MaxUploads         int
+	IsTruncated        bool
+	Uploads            []Upload `xml:"Upload"`
+	CommonPrefixes     CommonPrefixes
+}
+
+func (results ListMultipartUploadsResult) Send(writer http.ResponseWriter) error {
+	results.NS = NSS3
+	return sendXMLHeader(writer, results)
+}
+
 type CORSRule struct {
 	AllowedOrigin string
 	AllowedMethod string
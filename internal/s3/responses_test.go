@@ -1,6 +1,7 @@
 package s3_test
 
 import (
+	"encoding/xml"
 	"regexp"
 
 	. "github.com/onsi/ginkgo"
@@ -54,6 +55,19 @@ var _ = Describe("Responses", func() {
 			Expect(resp.Send(capture)).NotTo(HaveOccurred())
 			Expect(getBody(capture)).To(Equal(fixture("AccessControlPolicy")))
 		})
+
+		Specify("Unmarshal", func() {
+			var policy s3.AccessControlPolicy
+			Expect(xml.Unmarshal([]byte(fixture("AccessControlPolicy")), &policy)).To(Succeed())
+			Expect(policy.Owner.ID).To(Equal("75aa57f09aa0c8caeab4f8c24e99d10f8e7faeebf76c078efc7c6caea54ba06a"))
+			Expect(policy.AccessControlList).To(Equal([]s3.Grant{
+				s3.NewUserGrant(
+					"75aa57f09aa0c8caeab4f8c24e99d10f8e7faeebf76c078efc7c6caea54ba06a",
+					"CustomersName@amazon.com",
+					s3.PermFull,
+				),
+			}))
+		})
 	})
 
 	Describe("BucketLoggingStatus", func() {
@@ -276,6 +290,165 @@ var _ = Describe("Responses", func() {
 		})
 	})
 
+	Describe("ListMultipartUploadsResult", func() {
+		Specify("Send", func() {
+			resp = s3.ListMultipartUploadsResult{
+				Bucket:             "bucket",
+				NextKeyMarker:      "my-movie.m2ts",
+				NextUploadIdMarker: "YW55IGlkZWEgd2h5IGVsdmluZydzIHVwbG9hZCBmYWlsZWQ",
+				MaxUploads:         3,
+				IsTruncated:        true,
+				Uploads: []s3.Upload{
+					{
+						Key:      "my-divisor",
+						UploadId: "XMgbGlrZSBlbHZpbmcncyBub3QgaGF2aW5nIG11Y2ggbHVjaw",
+						Initiator: s3.OwnerResult{
+							ID:          "arn:aws:iam::111122223333:user/user1-11111a31-17b5-4fb7-9df5-b111111f13de",
+							DisplayName: "user1-11111a31-17b5-4fb7-9df5-b111111f13de",
+						},
+						Owner: s3.OwnerResult{
+							ID:          "75aa57f09aa0c8caeab4f8c24e99d10f8e7faeebf76c078efc7c6caea54ba06a",
+							DisplayName: "OwnerDisplayName",
+						},
+						StorageClass: "STANDARD",
+						Initiated:    "2010-11-10T20:48:33.000Z",
+					},
+					{
+						Key:      "my-movie.m2ts",
+						UploadId: "VXBsb2FkIElEIGZvciBlbHZpbmcncyBteS1tb3ZpZS5tMnRzIHVwbG9hZA",
+						Initiator: s3.OwnerResult{
+							ID:          "b1d16700c70b0b05597d7acd6a3f92be",
+							DisplayName: "InitiatorDisplayName",
+						},
+						Owner: s3.OwnerResult{
+							ID:          "b1d16700c70b0b05597d7acd6a3f92be",
+							DisplayName: "OwnerDisplayName",
+						},
+						StorageClass: "STANDARD",
+						Initiated:    "2010-11-10T20:48:33.000Z",
+					},
+					{
+						Key:      "my-movie.m2ts",
+						UploadId: "YW55IGlkZWEgd2h5IGVsdmluZydzIHVwbG9hZCBmYWlsZWQ",
+						Initiator: s3.OwnerResult{
+							ID:          "arn:aws:iam::444455556666:user/user1-22222a31-17b5-4fb7-9df5-b222222f13de",
+							DisplayName: "user1-22222a31-17b5-4fb7-9df5-b222222f13de",
+						},
+						Owner: s3.OwnerResult{
+							ID:          "b1d16700c70b0b05597d7acd6a3f92be",
+							DisplayName: "OwnerDisplayName",
+						},
+						StorageClass: "STANDARD",
+						Initiated:    "2010-11-10T20:49:33.000Z",
+					},
+				},
+			}
+			Expect(resp.Send(capture)).NotTo(HaveOccurred())
+			Expect(getBody(capture)).To(Equal(fixture("ListMultipartUploadsResult")))
+		})
+	})
+
+	Describe("ListPartsResult", func() {
+		Specify("Send", func() {
+			resp = s3.ListPartsResult{
+				Bucket:   "example-bucket",
+				Key:      "example-object",
+				UploadId: "XXBsb2FkIElEIGZvciBlbHZpbmcncyVcdS1tb3ZpZS5tMnRzEEEwbG9hZA",
+				Initiator: s3.OwnerResult{
+					ID:          "arn:aws:iam::111122223333:user/some-user-11116a31-17b5-4fb7-9df5-b288870f11xx",
+					DisplayName: "umat-user-11116a31-17b5-4fb7-9df5-b288870f11xx",
+				},
+				Owner: s3.OwnerResult{
+					ID:          "75aa57f09aa0c8caeab4f8c24e99d10f8e7faeebf76c078efc7c6caea54ba06a",
+					DisplayName: "someName",
+				},
+				StorageClass:         "STANDARD",
+				PartNumberMarker:     1,
+				NextPartNumberMarker: 3,
+				MaxParts:             2,
+				IsTruncated:          true,
+				Parts: []s3.Part{
+					{
+						PartNumber:   2,
+						LastModified: "2010-11-10T20:48:34.000Z",
+						ETag:         s3.NewETag("7778aef83f66abc1fa1e8477f296d394"),
+						Size:         10485760,
+					},
+					{
+						PartNumber:   3,
+						LastModified: "2010-11-10T20:48:33.000Z",
+						ETag:         s3.NewETag("aaaa18db4cc2f85cedef654fccc4a4x8"),
+						Size:         10485760,
+					},
+				},
+			}
+			Expect(resp.Send(capture)).NotTo(HaveOccurred())
+			Expect(getBody(capture)).To(Equal(fixture("ListPartsResult")))
+		})
+	})
+
+	Describe("ListVersionsResult", func() {
+		Specify("Send", func() {
+			owner := s3.OwnerResult{
+				ID:          "75aa57f09aa0c8caeab4f8c24e99d10f8e7faeebf76c078efc7c6caea54ba06a",
+				DisplayName: "mtd@amazon.com",
+			}
+			resp = s3.ListVersionsResult{
+				Name:    "bucket",
+				Prefix:  "my",
+				MaxKeys: 5,
+				Versions: []s3.ObjectVersion{
+					{
+						Key:          "my-image.jpg",
+						VersionId:    "3/L4kqtJl40Nr8X8gdRQBpUMLUo",
+						IsLatest:     true,
+						LastModified: "2009-10-12T17:50:30.000Z",
+						ETag:         s3.NewETag("fba9dede5f27731c9771645a39863328"),
+						Size:         434234,
+						StorageClass: "STANDARD",
+						Owner:        owner,
+					},
+					{
+						DeleteMarker: true,
+						Key:          "my-second-image.jpg",
+						VersionId:    "03jpff543dhffds434rfdsFDN943fdsFkdmqnh892",
+						IsLatest:     true,
+						LastModified: "2009-11-12T17:50:30.000Z",
+						Owner:        owner,
+					},
+					{
+						Key:          "my-second-image.jpg",
+						VersionId:    "QUpfdndhfd8438MNFDN93jdnJFkdmqnh893",
+						LastModified: "2009-10-10T17:50:30.000Z",
+						ETag:         s3.NewETag("9b2cf535f27731c974343645a3985328"),
+						Size:         166434,
+						StorageClass: "STANDARD",
+						Owner:        owner,
+					},
+					{
+						DeleteMarker: true,
+						Key:          "my-third-image.jpg",
+						VersionId:    "03jpff543dhffds434rfdsFDN943fdsFkdmqnh892",
+						IsLatest:     true,
+						LastModified: "2009-10-15T17:50:30.000Z",
+						Owner:        owner,
+					},
+					{
+						Key:          "my-third-image.jpg",
+						VersionId:    "UIORUnfndfhnw89493jJFJ",
+						LastModified: "2009-10-11T12:50:30.000Z",
+						ETag:         s3.NewETag("772cf535f27731c974343645a3985328"),
+						Size:         64,
+						StorageClass: "STANDARD",
+						Owner:        owner,
+					},
+				},
+			}
+			Expect(resp.Send(capture)).NotTo(HaveOccurred())
+			Expect(getBody(capture)).To(Equal(fixture("ListVersionResult")))
+		})
+	})
+
 	Describe("LocationConstraint", func() {
 		Specify("Send", func() {
 			resp = s3.LocationConstraint{
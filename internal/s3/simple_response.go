@@ -33,3 +33,9 @@ func NoContent() SimpleResponse {
 		Status: http.StatusNoContent,
 	}
 }
+
+func OK() SimpleResponse {
+	return SimpleResponse{
+		Status: http.StatusOK,
+	}
+}
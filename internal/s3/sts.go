@@ -0,0 +1,56 @@
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+)
+
+const NSSTS = "https://sts.amazonaws.com/doc/2011-06-15/"
+
+// STSCredentials are the temporary credentials issued by STS.
+type STSCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      string
+}
+
+type AssumedRoleUser struct {
+	Arn           string
+	AssumedRoleId string
+}
+
+type AssumeRoleResponse struct {
+	XMLName xml.Name `xml:"AssumeRoleResponse"`
+	XMLNS
+	Credentials     STSCredentials  `xml:"AssumeRoleResult>Credentials"`
+	AssumedRoleUser AssumedRoleUser `xml:"AssumeRoleResult>AssumedRoleUser"`
+}
+
+func (results AssumeRoleResponse) Send(writer http.ResponseWriter) error {
+	results.NS = NSSTS
+	return sendXMLHeader(writer, results)
+}
+
+type GetSessionTokenResponse struct {
+	XMLName xml.Name `xml:"GetSessionTokenResponse"`
+	XMLNS
+	Credentials STSCredentials `xml:"GetSessionTokenResult>Credentials"`
+}
+
+func (results GetSessionTokenResponse) Send(writer http.ResponseWriter) error {
+	results.NS = NSSTS
+	return sendXMLHeader(writer, results)
+}
+
+func InvalidAction(message string) ErrorResponse {
+	return NewErrorResponse("InvalidAction", http.StatusBadRequest, message)
+}
+
+func MissingParameter(message string) ErrorResponse {
+	return NewErrorResponse("MissingParameter", http.StatusBadRequest, message)
+}
+
+func ValidationError(message string) ErrorResponse {
+	return NewErrorResponse("ValidationError", http.StatusBadRequest, message)
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ophymx/s3d/internal/auth"
+	"github.com/ophymx/s3d/internal/ops"
+	"github.com/ophymx/s3d/internal/policy"
+	"github.com/ophymx/s3d/internal/s3"
+)
+
+// conditionHeaders are the request headers available as s3: condition keys.
+var conditionHeaders = []string{
+	"x-amz-acl",
+	"x-amz-content-sha256",
+	"x-amz-copy-source",
+	"x-amz-metadata-directive",
+	"x-amz-server-side-encryption",
+	"x-amz-storage-class",
+}
+
+// action names the policy action of a request, such as s3:GetObject.
+// STS requests, which policies do not apply to, and multi-object deletes,
+// which are authorized object by object, have no action.
+func action(req *http.Request, resource s3.Resource) string {
+	if isSTS(resource, req) {
+		return ""
+	}
+	method, query := req.Method, req.URL.Query()
+	_, uploadID := query["uploadId"]
+	_, acl := query["acl"]
+	versionID := query.Get("versionId")
+	switch {
+	case resource.Key() != "":
+		switch method {
+		case MethodGET, MethodHEAD:
+			if acl && versionID != "" {
+				return "s3:GetObjectVersionAcl"
+			}
+			if acl {
+				return "s3:GetObjectAcl"
+			}
+			if uploadID {
+				return "s3:ListMultipartUploadParts"
+			}
+			if versionID != "" {
+				return "s3:GetObjectVersion"
+			}
+			return "s3:GetObject"
+		case MethodDELETE:
+			if uploadID {
+				return "s3:AbortMultipartUpload"
+			}
+			if versionID != "" {
+				return "s3:DeleteObjectVersion"
+			}
+			return "s3:DeleteObject"
+		default:
+			if acl && versionID != "" {
+				return "s3:PutObjectVersionAcl"
+			}
+			if acl {
+				return "s3:PutObjectAcl"
+			}
+			return "s3:PutObject"
+		}
+	case resource.Bucket() != "":
+		_, policy := query["policy"]
+		_, versioning := query["versioning"]
+		switch method {
+		case MethodGET, MethodHEAD:
+			if policy {
+				return "s3:GetBucketPolicy"
+			}
+			if versioning {
+				return "s3:GetBucketVersioning"
+			}
+			if _, found := query["location"]; found {
+				return "s3:GetBucketLocation"
+			}
+			if acl {
+				return "s3:GetBucketAcl"
+			}
+			if _, found := query["uploads"]; found {
+				return "s3:ListBucketMultipartUploads"
+			}
+			if _, found := query["versions"]; found {
+				return "s3:ListBucketVersions"
+			}
+			return "s3:ListBucket"
+		case MethodPUT:
+			if policy {
+				return "s3:PutBucketPolicy"
+			}
+			if acl {
+				return "s3:PutBucketAcl"
+			}
+			if versioning {
+				return "s3:PutBucketVersioning"
+			}
+			return "s3:CreateBucket"
+		case MethodDELETE:
+			if policy {
+				return "s3:DeleteBucketPolicy"
+			}
+			return "s3:DeleteBucket"
+		case MethodPOST:
+			if _, found := query["delete"]; found {
+				return ""
+			}
+		}
+	}
+	return "s3:ListAllMyBuckets"
+}
+
+// resourceARN is the policy resource of a bucket or object.
+func resourceARN(resource s3.Resource) string {
+	if resource.Key() == "" {
+		return policy.ResourcePrefix + resource.Bucket()
+	}
+	return policy.ResourcePrefix + resource.Bucket() + "/" + resource.Key()
+}
+
+// accessRequest describes req for authorization of action on resource.
+func accessRequest(req *http.Request, authorization auth.Authorization, cred s3.Credential, now time.Time, action string, resource s3.Resource) ops.AccessRequest {
+	access := ops.AccessRequest{
+		Bucket:        resource.Bucket(),
+		Key:           resource.Key(),
+		Authenticated: authorization != nil,
+		Request: policy.Request{
+			Action:     action,
+			Resource:   resourceARN(resource),
+			Conditions: conditionKeys(req, authorization, now),
+		},
+	}
+	if resource.Key() != "" {
+		access.VersionID = req.URL.Query().Get("versionId")
+	}
+	if authorization != nil {
+		access.CanonicalID = cred.CanonicalID
+		access.Policies = cred.Policies
+		access.Principals = []string{cred.AccessKeyID, cred.CanonicalID}
+	}
+	return access
+}
+
+func conditionKeys(req *http.Request, authorization auth.Authorization, now time.Time) map[string][]string {
+	keys := map[string][]string{
+		"aws:currenttime":     {now.UTC().Format(time.RFC3339)},
+		"aws:epochtime":       {strconv.FormatInt(now.Unix(), 10)},
+		"aws:securetransport": {strconv.FormatBool(req.TLS != nil)},
+	}
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		keys["aws:sourceip"] = []string{host}
+	}
+	if userAgent := req.UserAgent(); userAgent != "" {
+		keys["aws:useragent"] = []string{userAgent}
+	}
+	if referer := req.Referer(); referer != "" {
+		keys["aws:referer"] = []string{referer}
+	}
+
+	query := req.URL.Query()
+	for _, name := range []string{"prefix", "delimiter", "max-keys"} {
+		if values, found := query[name]; found {
+			keys["s3:"+name] = values
+		}
+	}
+	for _, name := range conditionHeaders {
+		if value := req.Header.Get(name); value != "" {
+			keys["s3:"+name] = []string{value}
+		}
+	}
+
+	switch authorization.(type) {
+	case auth.AuthorizationV4:
+		keys["s3:signatureversion"] = []string{auth.Aws4HmacSha256}
+	case auth.AuthorizationV2:
+		keys["s3:signatureversion"] = []string{auth.Aws2}
+	}
+	if authorization != nil {
+		keys["aws:principaltype"] = []string{"User"}
+	} else {
+		keys["aws:principaltype"] = []string{"Anonymous"}
+	}
+	return keys
+}
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"crypto/subtle"
+	"io"
 	"log"
 	"net/http"
 	"net/url"
@@ -33,9 +35,13 @@ type S3Handler struct {
 	objectService  Service
 	bucketService  Service
 	serviceService Service
+	stsService     Service
+	sts            ops.STSOperations
+	access         ops.AccessOperations
 	bucketParser   s3.BucketParser
 	credentials    map[string]s3.Credential
 	config         s3.Config
+	clock          clock.Clock
 	requestID      uint64
 }
 
@@ -45,16 +51,22 @@ func NewHandler(
 	bucketParser s3.BucketParser,
 	credentials map[string]s3.Credential,
 	config s3.Config,
+	clock clock.Clock,
 ) http.Handler {
 
+	sts := ops.NewSTS(clock)
 	return &S3Handler{
-		bucketService:  NewBucketService(ops.NewBucket(db, store, clock.Real)),
-		objectService:  NewObjectService(ops.NewObject(db, store, clock.Real)),
+		bucketService:  NewBucketService(ops.NewBucket(db, store, clock)),
+		objectService:  NewObjectService(ops.NewObject(db, store, clock)),
 		serviceService: NewServiceService(ops.NewService(db)),
+		stsService:     NewSTSService(sts),
+		sts:            sts,
+		access:         ops.NewAccess(db, config.EnforceAuth),
 		bucketParser:   bucketParser,
 		credentials:    credentials,
 		config:         config,
-		requestID:      uint64(time.Now().Unix()),
+		clock:          clock,
+		requestID:      uint64(clock.Now().Unix()),
 	}
 }
 
@@ -62,7 +74,8 @@ func (h *S3Handler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
 	start := time.Now()
 	requestID := h.getRequestID()
 	resource := h.getResource(req.Host, req.URL.Path)
-	response := h.serve(start, requestID, resource, req)
+	action := action(req, resource)
+	response := h.serve(start, requestID, resource, action, req)
 	if response == nil {
 		response = s3.InternalErrorf("no response")
 	}
@@ -72,12 +85,13 @@ func (h *S3Handler) ServeHTTP(writer http.ResponseWriter, req *http.Request) {
 	writer.Header().Add("Server", "s3d")
 	err := response.Send(writer)
 	log.Printf(
-		"[%s] (%s) %s %s %s %d %vµs",
+		"[%s] (%s) %s %s %s %s %d %vµs",
 		requestID,
 		resource.Bucket(),
 		req.RemoteAddr,
 		req.Method,
 		req.URL,
+		action,
 		response.HTTPStatus(),
 		int64(time.Since(start)/time.Microsecond),
 	)
@@ -90,6 +104,7 @@ func (h *S3Handler) serve(
 	start time.Time,
 	requestID string,
 	resource s3.Resource,
+	action string,
 	req *http.Request,
 ) (response s3.Response) {
 	values, err := url.ParseQuery(req.URL.RawQuery)
@@ -106,16 +121,31 @@ func (h *S3Handler) serve(
 	if authorization != nil {
 		var found bool
 		accessKeyID := authorization.GetAccessKeyID()
-		if cred, found = h.credentials[accessKeyID]; !found {
+		if cred, found = h.credential(accessKeyID); !found {
 			return s3.InvalidAccessKeyID(accessKeyID)
 		}
 
 		if err = authorization.Verify(cred.SecretKey, req); err != nil {
 			return s3.AuthError(err)
 		}
+		if err = authorization.CheckDate(h.clock.Now()); err != nil {
+			return s3.AuthError(err)
+		}
+		if response = h.checkToken(cred, req); response != nil {
+			return
+		}
+	}
+	if response = h.authorize(resource, action, req, authorization, cred); response != nil {
+		return
+	}
+
+	body, err := auth.DecodeBody(authorization, cred.SecretKey, req)
+	if err != nil {
+		return s3.AuthError(err)
 	}
+	req.Body = authBody{body}
 
-	return h.route(resource).Serve(s3.Request{
+	return h.route(resource, req).Serve(s3.Request{
 		ID:         requestID,
 		Method:     req.Method,
 		Auth:       authorization,
@@ -124,15 +154,83 @@ func (h *S3Handler) serve(
 		Query:      values,
 		Time:       start,
 		RawReq:     req,
+		Action:     action,
+		Authorize: func(action string, resource s3.Resource) s3.Response {
+			return h.authorize(resource, action, req, authorization, cred)
+		},
 	})
 }
 
+// credential looks up the static or temporary credential of an access key.
+func (h *S3Handler) credential(accessKeyID string) (s3.Credential, bool) {
+	if cred, found := h.credentials[accessKeyID]; found {
+		return cred, true
+	}
+	return h.sts.Session(accessKeyID)
+}
+
+// checkToken requires temporary credentials, and only those, to come with
+// their unexpired session token.
+func (h *S3Handler) checkToken(cred s3.Credential, req *http.Request) s3.Response {
+	token := req.Header.Get(s3.AmzSecurityToken)
+	if token == "" {
+		token = req.URL.Query().Get(auth.AmzSecurityToken)
+	}
+	if token == "" && cred.SessionToken == "" {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cred.SessionToken)) != 1 {
+		return s3.InvalidToken("The provided token is malformed or otherwise invalid.")
+	}
+	if h.clock.Now().After(cred.Expiration) {
+		return s3.ExpiredToken("The provided token has expired.")
+	}
+	return nil
+}
+
+// authorize checks that the caller may take action on resource and, when
+// copying, read the copy source.
+func (h *S3Handler) authorize(resource s3.Resource, action string, req *http.Request, authorization auth.Authorization, cred s3.Credential) s3.Response {
+	if action == "" {
+		return nil
+	}
+	now := h.clock.Now()
+	if resp := h.access.Authorize(accessRequest(req, authorization, cred, now, action, resource)); resp != nil {
+		return resp
+	}
+	if value := req.Header.Get(s3.AmzCopySource); value != "" && resource.Key() != "" {
+		src, versionID := copySource(value)
+		srcAction := "s3:GetObject"
+		if versionID != "" {
+			srcAction = "s3:GetObjectVersion"
+		}
+		return h.access.Authorize(accessRequest(req, authorization, cred, now, srcAction, src))
+	}
+	return nil
+}
+
+// authBody reports failures of a decoded body, such as a chunk signature
+// that does not match, as S3 errors.
+type authBody struct {
+	io.ReadCloser
+}
+
+func (body authBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	if _, ok := err.(auth.AuthError); ok {
+		err = s3.AuthError(err)
+	}
+	return n, err
+}
+
 func (h *S3Handler) getRequestID() string {
 	return strings.ToUpper(strconv.FormatUint(atomic.AddUint64(&h.requestID, 1), 16))
 }
 
-func (h *S3Handler) route(resource s3.Resource) Service {
+func (h *S3Handler) route(resource s3.Resource, req *http.Request) Service {
 	switch {
+	case isSTS(resource, req):
+		return h.stsService
 	case resource.Key() != "":
 		return h.objectService
 	case resource.Bucket() != "":
@@ -142,6 +240,12 @@ func (h *S3Handler) route(resource s3.Resource) Service {
 	}
 }
 
+// isSTS reports whether req is an STS action, which are posted to, or
+// named in the query of, the service root.
+func isSTS(resource s3.Resource, req *http.Request) bool {
+	return resource.Bucket() == "" && (req.Method == MethodPOST || req.URL.Query().Get("Action") != "")
+}
+
 func (h *S3Handler) getResource(host, path string) (resource s3.Resource) {
 	path = strings.TrimLeft(path, "/")
 	if idx := strings.Index(path, "?"); idx != -1 {
@@ -165,23 +269,218 @@ func NewObjectService(ops ops.ObjectOperations) ObjectService {
 func (srv ObjectService) Serve(req s3.Request) s3.Response {
 	switch req.Method {
 	case MethodGET:
-		return srv.Get(req.Resource)
+		if _, found := req.Query["acl"]; found {
+			return srv.GetACL(req.Resource, req.Query.Get("versionId"))
+		}
+		if uploadID := req.Query.Get("uploadId"); uploadID != "" {
+			return srv.ListParts(req.Resource, uploadID, req.Query)
+		}
+		return srv.Get(req.Resource, getOptions(req))
 	case MethodHEAD:
-		return srv.Head(req.Resource)
+		return srv.Head(req.Resource, getOptions(req))
 	case MethodDELETE:
-		return srv.Delete(req.Resource)
+		if uploadID := req.Query.Get("uploadId"); uploadID != "" {
+			return srv.AbortMultipartUpload(req.Resource, uploadID)
+		}
+		return srv.Delete(req.Resource, req.Query.Get("versionId"))
 	case MethodPOST:
+		if _, found := req.Query["uploads"]; found {
+			return srv.CreateMultipartUpload(req.Resource, metadata(req), req.RawReq.Header.Get(s3.AmzChecksumAlgorithm), ownership(req))
+		}
+		if uploadID := req.Query.Get("uploadId"); uploadID != "" {
+			return srv.CompleteMultipartUpload(req.Resource, uploadID, conditions(req), req.RawReq.Body)
+		}
 		return s3.MethodNotAllowed(req.Method + " method not allowed on bucket")
 	case MethodPUT:
-		if copySrc := req.RawReq.Header.Get(s3.AmzCopySource); copySrc != "" {
-			return srv.Copy(s3.ParseResource(copySrc), req.Resource)
+		if _, found := req.Query["acl"]; found {
+			return srv.PutACL(req.Resource, req.Query.Get("versionId"), acl(req), req.RawReq.Body)
+		}
+		header := req.RawReq.Header
+		copySrc := header.Get(s3.AmzCopySource)
+		if uploadID := req.Query.Get("uploadId"); uploadID != "" {
+			if copySrc != "" {
+				src, versionID := copySource(copySrc)
+				return srv.UploadPartCopy(
+					src,
+					req.Resource,
+					versionID,
+					copySourceConditions(req),
+					uploadID,
+					req.Query.Get("partNumber"),
+					req.RawReq.Header.Get(s3.AmzCopySourceRange),
+				)
+			}
+			return srv.UploadPart(req.Resource, uploadID, req.Query.Get("partNumber"), digests(req), req.RawReq.Body)
+		}
+		if copySrc != "" {
+			src, versionID := copySource(copySrc)
+			return srv.Copy(src, req.Resource, ops.CopyOptions{
+				SourceConditions:  copySourceConditions(req),
+				SourceVersionID:   versionID,
+				MetadataDirective: header.Get(s3.AmzMetadataDirective),
+				TaggingDirective:  header.Get(s3.AmzTaggingDirective),
+				Metadata:          metadata(req),
+				Ownership:         ownership(req),
+			})
 		}
-		return srv.Put(req.Resource, req.RawReq.Header.Get(s3.HdrContentType), req.RawReq.Body)
+		return srv.Put(req.Resource, ops.PutOptions{
+			Conditions: conditions(req),
+			Metadata:   metadata(req),
+			Digests:    digests(req),
+			Ownership:  ownership(req),
+		}, req.RawReq.Body)
 	default:
 		return s3.MethodNotAllowed(req.Method + " method not allowed on bucket")
 	}
 }
 
+func getOptions(req s3.Request) ops.GetOptions {
+	return ops.GetOptions{
+		Conditions:   conditions(req),
+		VersionID:    req.Query.Get("versionId"),
+		Range:        req.RawReq.Header.Get(s3.HdrRange),
+		PartNumber:   req.Query.Get("partNumber"),
+		ChecksumMode: req.RawReq.Header.Get(s3.AmzChecksumMode),
+	}
+}
+
+func metadata(req s3.Request) ops.Metadata {
+	header := req.RawReq.Header
+	md := ops.Metadata{
+		ContentType:        header.Get(s3.HdrContentType),
+		CacheControl:       header.Get(s3.HdrCacheControl),
+		ContentDisposition: header.Get(s3.HdrContentDisposition),
+		ContentEncoding:    contentEncoding(header.Get(s3.HdrContentEncoding)),
+		ContentLanguage:    header.Get(s3.HdrContentLanguage),
+		Expires:            header.Get(s3.HdrExpires),
+	}
+	for name, values := range header {
+		name = strings.ToLower(name)
+		if !strings.HasPrefix(name, s3.AmzMetaPrefix) {
+			continue
+		}
+		if md.UserDefined == nil {
+			md.UserDefined = make(map[string]string)
+		}
+		md.UserDefined[strings.TrimPrefix(name, s3.AmzMetaPrefix)] = strings.Join(values, ",")
+	}
+	if tagging, err := url.ParseQuery(header.Get(s3.AmzTagging)); err == nil && len(tagging) > 0 {
+		md.Tags = make(map[string]string, len(tagging))
+		for key := range tagging {
+			md.Tags[key] = tagging.Get(key)
+		}
+	}
+	return md
+}
+
+// contentEncoding drops aws-chunked, which only describes the framing of
+// a streaming upload, from a Content-Encoding header.
+func contentEncoding(value string) string {
+	var encodings []string
+	for _, encoding := range strings.Split(value, ",") {
+		if encoding = strings.TrimSpace(encoding); encoding != "" && encoding != "aws-chunked" {
+			encodings = append(encodings, encoding)
+		}
+	}
+	return strings.Join(encodings, ",")
+}
+
+// copySource parses an x-amz-copy-source header of the form
+// bucket/key?versionId=id, where the key may be URL encoded.
+func copySource(value string) (src s3.Resource, versionID string) {
+	if i := strings.IndexByte(value, '?'); i >= 0 {
+		if query, err := url.ParseQuery(value[i+1:]); err == nil {
+			versionID = query.Get("versionId")
+		}
+		value = value[:i]
+	}
+	if unescaped, err := url.PathUnescape(value); err == nil {
+		value = unescaped
+	}
+	return s3.ParseResource(value), versionID
+}
+
+func digests(req s3.Request) ops.Digests {
+	header := req.RawReq.Header
+	digests := ops.Digests{
+		ContentMD5:        header.Get(s3.HdrContentMD5),
+		ContentSHA256:     header.Get(s3.AmzContentSHA256),
+		ChecksumAlgorithm: header.Get(s3.AmzSdkChecksumAlgorithm),
+		Trailer:           req.RawReq.Trailer,
+	}
+	for _, algorithm := range s3.ChecksumAlgorithms {
+		if value := header.Get(s3.ChecksumHeader(algorithm)); value != "" {
+			if digests.Checksums == nil {
+				digests.Checksums = make(map[string]string)
+			}
+			digests.Checksums[algorithm] = value
+		}
+		if strings.EqualFold(header.Get(s3.AmzTrailer), s3.ChecksumHeader(algorithm)) && digests.ChecksumAlgorithm == "" {
+			digests.ChecksumAlgorithm = algorithm
+		}
+	}
+	return digests
+}
+
+// grantHeaders are the x-amz-grant-* headers of each permission.
+var grantHeaders = map[s3.Permission]string{
+	s3.PermRead:     s3.AmzGrantRead,
+	s3.PermWrite:    s3.AmzGrantWrite,
+	s3.PermReadACP:  s3.AmzGrantReadACP,
+	s3.PermWriteACP: s3.AmzGrantWriteACP,
+	s3.PermFull:     s3.AmzGrantFullControl,
+}
+
+// ownership makes the caller the owner of what req creates.
+func ownership(req s3.Request) ops.Ownership {
+	return ops.Ownership{Owner: owner(req), ACL: acl(req)}
+}
+
+// owner is the account of the caller, which is empty for anonymous
+// requests.
+func owner(req s3.Request) s3.OwnerResult {
+	if req.Auth == nil {
+		return s3.OwnerResult{}
+	}
+	return req.Credential.Owner()
+}
+
+func acl(req s3.Request) ops.ACL {
+	header := req.RawReq.Header
+	acl := ops.ACL{Canned: header.Get(s3.AmzACL)}
+	for permission, name := range grantHeaders {
+		if values, found := header[http.CanonicalHeaderKey(name)]; found {
+			if acl.Grants == nil {
+				acl.Grants = make(map[s3.Permission]string)
+			}
+			acl.Grants[permission] = strings.Join(values, ",")
+		}
+	}
+	return acl
+}
+
+func conditions(req s3.Request) ops.Conditions {
+	header := req.RawReq.Header
+	return ops.Conditions{
+		IfMatch:           header.Get(s3.HdrIfMatch),
+		IfNoneMatch:       header.Get(s3.HdrIfNoneMatch),
+		IfModifiedSince:   header.Get(s3.HdrIfModifiedSince),
+		IfUnmodifiedSince: header.Get(s3.HdrIfUnmodifiedSince),
+	}
+}
+
+// copySourceConditions are the x-amz-copy-source-if-* conditions on the
+// source of a copy.
+func copySourceConditions(req s3.Request) ops.Conditions {
+	header := req.RawReq.Header
+	return ops.Conditions{
+		IfMatch:           header.Get(s3.AmzCopySourceIfMatch),
+		IfNoneMatch:       header.Get(s3.AmzCopySourceIfNoneMatch),
+		IfModifiedSince:   header.Get(s3.AmzCopySourceIfModifiedSince),
+		IfUnmodifiedSince: header.Get(s3.AmzCopySourceIfUnmodifiedSince),
+	}
+}
+
 type BucketService struct {
 	ops.BucketOperations
 }
@@ -193,13 +492,51 @@ func NewBucketService(ops ops.BucketOperations) BucketService {
 func (srv BucketService) Serve(req s3.Request) s3.Response {
 	switch req.Method {
 	case MethodGET:
+		if _, found := req.Query["policy"]; found {
+			return srv.GetPolicy(req.Resource.Bucket())
+		}
+		if _, found := req.Query["acl"]; found {
+			return srv.GetACL(req.Resource.Bucket())
+		}
+		if _, found := req.Query["location"]; found {
+			return srv.GetLocation(req.Resource.Bucket())
+		}
+		if _, found := req.Query["versioning"]; found {
+			return srv.GetVersioning(req.Resource.Bucket())
+		}
+		if _, found := req.Query["versions"]; found {
+			return srv.ListObjectVersions(req.Resource.Bucket(), req.Query)
+		}
+		if _, found := req.Query["uploads"]; found {
+			return srv.ListMultipartUploads(req.Resource.Bucket(), req.Query)
+		}
+		if req.Query.Get("list-type") == "2" {
+			return srv.ListBucketV2(req.Resource.Bucket(), req.Query)
+		}
 		return srv.ListBucket(req.Resource.Bucket(), req.Query)
 	case MethodHEAD:
-		return srv.ListBucket(req.Resource.Bucket(), req.Query)
+		return srv.Head(req.Resource.Bucket())
 	case MethodPUT:
-		return srv.Create(req.Resource.Bucket())
+		if _, found := req.Query["policy"]; found {
+			return srv.PutPolicy(req.Resource.Bucket(), req.RawReq.Body)
+		}
+		if _, found := req.Query["acl"]; found {
+			return srv.PutACL(req.Resource.Bucket(), acl(req), req.RawReq.Body)
+		}
+		if _, found := req.Query["versioning"]; found {
+			return srv.PutVersioning(req.Resource.Bucket(), req.RawReq.Body)
+		}
+		return srv.Create(req.Resource.Bucket(), ownership(req), req.RawReq.Body)
 	case MethodDELETE:
+		if _, found := req.Query["policy"]; found {
+			return srv.DeletePolicy(req.Resource.Bucket())
+		}
 		return srv.Delete(req.Resource.Bucket())
+	case MethodPOST:
+		if _, found := req.Query["delete"]; found {
+			return srv.DeleteObjects(req.Resource.Bucket(), digests(req), req.Authorize, req.RawReq.Body)
+		}
+		return s3.MethodNotAllowed(req.Method + " method not allowed on bucket")
 	default:
 		return s3.MethodNotAllowed(req.Method + " method not allowed on bucket")
 	}
@@ -216,10 +553,36 @@ func NewServiceService(ops ops.ServiceOperations) (service ServiceService) {
 func (srv ServiceService) Serve(req s3.Request) s3.Response {
 	switch req.Method {
 	case MethodGET:
-		return srv.ListBuckets()
+		return srv.ListBuckets(owner(req))
 	case MethodHEAD:
-		return srv.ListBuckets()
+		return srv.ListBuckets(owner(req))
 	default:
 		return s3.MethodNotAllowed(req.Method + " not allowed on service")
 	}
 }
+
+type STSService struct {
+	ops.STSOperations
+}
+
+func NewSTSService(ops ops.STSOperations) STSService {
+	return STSService{ops}
+}
+
+func (srv STSService) Serve(req s3.Request) s3.Response {
+	if req.Auth == nil {
+		return s3.AccessDenied("Request is missing Authentication Token")
+	}
+	if err := req.RawReq.ParseForm(); err != nil {
+		return s3.InvalidRequest("invalid form")
+	}
+	form := req.RawReq.Form
+	switch form.Get("Action") {
+	case "AssumeRole":
+		return srv.AssumeRole(req.Credential, form.Get("RoleArn"), form.Get("RoleSessionName"), form.Get("DurationSeconds"))
+	case "GetSessionToken":
+		return srv.GetSessionToken(req.Credential, form.Get("DurationSeconds"))
+	default:
+		return s3.InvalidAction("Could not find operation " + form.Get("Action") + " for version " + form.Get("Version"))
+	}
+}
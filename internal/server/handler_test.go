@@ -0,0 +1,108 @@
+package server_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/ophymx/s3d/internal/auth"
+	"github.com/ophymx/s3d/internal/fakes"
+	"github.com/ophymx/s3d/internal/fixtures"
+	"github.com/ophymx/s3d/internal/meta"
+	"github.com/ophymx/s3d/internal/s3"
+	"github.com/ophymx/s3d/internal/server"
+)
+
+var _ = Describe("Handler", func() {
+	var db *fakes.DB
+	var store *fakes.Store
+	var credentials map[string]s3.Credential
+	BeforeEach(func() {
+		credentials = nil
+		db = fakes.NewDB()
+		store = fakes.NewStore()
+		store.Buckets["private"] = map[string]*bytes.Buffer{"a.txt": {}}
+		store.Buckets["public"] = map[string]*bytes.Buffer{}
+		db.Buckets["private"] = fakes.NewBucket(meta.BucketData{CreationDate: fixtures.Time1})
+		db.Buckets["private"].Objects["a.txt"] = meta.ObjectData{}
+		db.Buckets["public"] = fakes.NewBucket(meta.BucketData{
+			CreationDate: fixtures.Time1,
+			ACL:          []meta.Grant{{Type: "Group", Grantee: s3.AllUsersGroup, Permission: "READ"}},
+		})
+	})
+	handle := func(config s3.Config, req *http.Request) *httptest.ResponseRecorder {
+		handler := server.NewHandler(db, store, s3.NewBucketParser(nil), credentials, config, fakes.NewClock(fixtures.Time1))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	serve := func(config s3.Config, method, target string) *httptest.ResponseRecorder {
+		return handle(config, httptest.NewRequest(method, target, nil))
+	}
+	// sign signs req for the bucket it targets with the V2 signature of
+	// cred.
+	sign := func(req *http.Request, bucket string, cred s3.Credential) *http.Request {
+		req.Header.Set("Date", fixtures.Time1.Format(http.TimeFormat))
+		sts := auth.CanonicalRequestV2{
+			Method:   req.Method,
+			Date:     req.Header.Get("Date"),
+			Resource: s3.NewResource(bucket, ""),
+		}.StringToSign()
+		req.Header.Set("Authorization", "AWS "+cred.AccessKeyID+":"+auth.SigningKeyV2(cred.SecretKey).Sign(sts))
+		return req
+	}
+
+	Context("when authentication is enforced", func() {
+		config := s3.Config{EnforceAuth: true}
+
+		It("rejects unsigned requests with AccessDenied", func() {
+			for _, target := range []string{"/", "/private", "/private/a.txt", "/missing/a.txt"} {
+				recorder := serve(config, "GET", target)
+				Expect(recorder.Code).To(Equal(403), target)
+				Expect(recorder.Body.String()).To(ContainSubstring("<Code>AccessDenied</Code>"), target)
+			}
+			Expect(serve(config, "PUT", "/public/a.txt").Code).To(Equal(403))
+			Expect(db.Buckets["public"].Objects).NotTo(HaveKey("a.txt"))
+		})
+		It("allows unsigned requests a bucket grants to everyone", func() {
+			Expect(serve(config, "GET", "/public").Code).To(Equal(200))
+		})
+	})
+
+	Context("when authentication is not enforced", func() {
+		It("allows unsigned requests to buckets without an ACL", func() {
+			Expect(serve(s3.Config{}, "GET", "/private").Code).To(Equal(200))
+		})
+		It("only allows unsigned requests what a bucket ACL grants", func() {
+			Expect(serve(s3.Config{}, "GET", "/public").Code).To(Equal(200))
+			Expect(serve(s3.Config{}, "PUT", "/public/a.txt").Code).To(Equal(403))
+			Expect(db.Buckets["public"].Objects).NotTo(HaveKey("a.txt"))
+		})
+	})
+
+	Context("when an account creates a bucket that already exists", func() {
+		config := s3.Config{EnforceAuth: true}
+		owner := s3.Credential{AccessKeyID: "OWNER", SecretKey: "owner-secret", Account: s3.Account{CanonicalID: "owner-id"}}
+		other := s3.Credential{AccessKeyID: "OTHER", SecretKey: "other-secret", Account: s3.Account{CanonicalID: "other-id"}}
+		BeforeEach(func() {
+			credentials = map[string]s3.Credential{owner.AccessKeyID: owner, other.AccessKeyID: other}
+			db.Buckets["owned"] = fakes.NewBucket(meta.BucketData{
+				CreationDate: fixtures.Time1,
+				Owner:        meta.Owner{ID: owner.CanonicalID},
+			})
+		})
+
+		It("tells other accounts the bucket already exists", func() {
+			recorder := handle(config, sign(httptest.NewRequest("PUT", "/owned", nil), "owned", other))
+			Expect(recorder.Code).To(Equal(409))
+			Expect(recorder.Body.String()).To(ContainSubstring("<Code>BucketAlreadyExists</Code>"))
+		})
+		It("tells the owner it already owns the bucket", func() {
+			recorder := handle(config, sign(httptest.NewRequest("PUT", "/owned", nil), "owned", owner))
+			Expect(recorder.Code).To(Equal(409))
+			Expect(recorder.Body.String()).To(ContainSubstring("<Code>BucketAlreadyOwnedByYou</Code>"))
+		})
+	})
+})
@@ -9,31 +9,47 @@ import (
 	"strings"
 
 	"github.com/ophymx/s3d/internal/blob"
+	"github.com/ophymx/s3d/internal/clock"
 	"github.com/ophymx/s3d/internal/meta"
 	"github.com/ophymx/s3d/internal/meta/dbenc"
+	"github.com/ophymx/s3d/internal/ops"
 	"github.com/ophymx/s3d/internal/s3"
 	"github.com/ophymx/s3d/internal/server"
 )
 
 func main() {
 	config := defaultConfig()
-	var accessKey, secretKey, displayName, hosts string
+	var accessKey, secretKey, canonicalID, displayName, hosts, credentialsPath, forceDeleteBucket string
 
 	flag.StringVar(&config.DataRoot, "d", filepath.Join(os.TempDir(), "s3d"), "s3d data root")
 	flag.IntVar(&config.Port, "p", 8080, "port")
 	flag.StringVar(&accessKey, "a", "", "aws access key id")
 	flag.StringVar(&secretKey, "s", "", "aws secret access key")
-	flag.StringVar(&displayName, "n", "Example Account", "credential display name")
+	flag.StringVar(&canonicalID, "i", "", "account canonical user id (default derived from the access key)")
+	flag.StringVar(&displayName, "n", "Example Account", "account display name")
+	flag.StringVar(&credentialsPath, "c", "", "JSON file of credentials and their identity policies")
 	flag.StringVar(&hosts, "h", "", "additional hosts to use when parsing bucket names")
+	flag.BoolVar(&config.S3.EnforceAuth, "auth", false, "also reject anonymous requests to buckets without an ACL")
+	flag.StringVar(&forceDeleteBucket, "force-delete-bucket", "", "delete a bucket and everything in it, then exit, while s3d is not running")
 	flag.Parse()
 
+	if forceDeleteBucket != "" {
+		forceDelete(config, forceDeleteBucket)
+		return
+	}
+
 	if accessKey != "" && secretKey != "" {
 		config.Credentials = append(config.Credentials, s3.Credential{
 			AccessKeyID: accessKey,
 			SecretKey:   secretKey,
-			DisplayName: displayName,
+			Account:     s3.Account{CanonicalID: canonicalID, DisplayName: displayName},
 		})
 	}
+	if credentialsPath != "" {
+		if err := config.loadCredentials(credentialsPath); err != nil {
+			log.Fatal(err)
+		}
+	}
 	if hosts != "" {
 		config.Hostnames = append(config.Hostnames, strings.Split(hosts, ",")...)
 	}
@@ -54,16 +70,38 @@ func defaultConfig() config {
 	return c
 }
 
-func start(config config) {
-	bucketParser := s3.NewBucketParser(config.Hostnames)
-	credentials := config.getCredentialsMap()
+func open(config config) (blob.Store, meta.DB) {
 	store := blob.NewFsStore(filepath.Join(config.DataRoot, "buckets"))
-	db, err := meta.NewDB(filepath.Join(config.DataRoot, "meta.db"), dbenc.MsgPack)
-	if err != nil {
+	dbPath := filepath.Join(config.DataRoot, "meta.db")
+	db, err := meta.NewDB(dbPath, dbenc.MsgPack)
+	if err == meta.ErrLocked {
+		log.Fatalf("%s is in use, s3d is running on this data root and must be stopped first", dbPath)
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	return store, db
+}
+
+// forceDelete deletes bucket even when objects, versions or uploads remain
+// in it, which S3 requests to delete a bucket refuse to do.
+func forceDelete(config config, bucket string) {
+	store, db := open(config)
+	resp := ops.NewBucket(db, store, clock.Real).ForceDelete(bucket)
+	if err := db.Close(); err != nil {
 		log.Fatal(err)
 	}
+	if errResp, failed := resp.(s3.ErrorResponse); failed {
+		log.Fatal(errResp)
+	}
+	log.Printf("Deleted bucket: %s", bucket)
+}
+
+func start(config config) {
+	bucketParser := s3.NewBucketParser(config.Hostnames)
+	credentials := config.getCredentialsMap()
+	store, db := open(config)
 
-	handler := server.NewHandler(db, store, bucketParser, credentials, config.S3)
+	handler := server.NewHandler(db, store, bucketParser, credentials, config.S3, clock.Real)
 	log.Printf("Start server, port: %d, data: %s, hostID: %s", config.Port, config.DataRoot, config.S3.HostID)
 	http.ListenAndServe(config.listenAddr(), handler)
 }